@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RejectRequest is the optional body of a rejection
+type RejectRequest struct {
+	Reason string `json:"reason"`
+}
+
+// approveJob approves the job with the given ID if it is awaiting approval,
+// recording approver and reason, and queues it to run. It reports whether
+// the job was approved along with its updated state.
+func approveJob(id, approver, reason string) (Job, bool, error) {
+	var job Job
+	approved := false
+	approvedAt := time.Now().UTC()
+	err := store.Update(id, func(j *Job) {
+		if j.Status == statusPendingApproval {
+			j.Status = statusPending
+			j.ApprovedBy = approver
+			j.ApprovedAt = &approvedAt
+			if reason != "" {
+				j.Reason = reason
+			}
+			approved = true
+		}
+		job = *j
+	})
+	if err != nil || !approved {
+		return job, false, err
+	}
+
+	enqueue(job)
+	return job, true, nil
+}
+
+// rejectJob rejects the job with the given ID if it is awaiting approval,
+// recording rejecter and reason. It reports whether the job was rejected
+// along with its updated state.
+func rejectJob(id, rejecter, reason string) (Job, bool, error) {
+	var job Job
+	rejected := false
+	rejectedAt := time.Now().UTC()
+	err := store.Update(id, func(j *Job) {
+		if j.Status == statusPendingApproval {
+			j.Status = statusRejected
+			j.RejectedBy = rejecter
+			j.RejectedAt = &rejectedAt
+			j.FinishedAt = &rejectedAt
+			j.Reason = reason
+			rejected = true
+		}
+		job = *j
+	})
+	if err != nil || !rejected {
+		return job, false, err
+	}
+
+	notifyCompletion(job)
+	return job, true, nil
+}
+
+// handleApproveChange handles requests to approve a change held for
+// approval, which queues it to run
+func handleApproveChange(c *gin.Context) {
+	log := requestLogger(c)
+
+	id := c.Param("id")
+	approver := c.GetString(apiKeyContextKey)
+
+	job, approved, err := approveJob(id, approver, "")
+	if err != nil {
+		respondJobError(c, id, err)
+		return
+	}
+	if !approved {
+		respondNotApprovable(c, job)
+		return
+	}
+
+	log.Info("Change approved", "id", id, "approver", approver)
+
+	c.JSON(http.StatusOK, job)
+}
+
+// handleRejectChange handles requests to reject a change held for approval.
+// The body may give a reason, which is recorded on the change.
+func handleRejectChange(c *gin.Context) {
+	log := requestLogger(c)
+
+	id := c.Param("id")
+	rejecter := c.GetString(apiKeyContextKey)
+
+	var req RejectRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Error("Failed to bind rejection", "error", err)
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	job, rejected, err := rejectJob(id, rejecter, req.Reason)
+	if err != nil {
+		respondJobError(c, id, err)
+		return
+	}
+	if !rejected {
+		respondNotApprovable(c, job)
+		return
+	}
+
+	log.Info("Change rejected", "id", id, "approver", rejecter, "reason", req.Reason)
+
+	c.JSON(http.StatusOK, job)
+}
+
+// respondNotApprovable writes the 409 for an approval or rejection of job
+// while it isn't awaiting approval
+func respondNotApprovable(c *gin.Context, job Job) {
+	requestLogger(c).Warn("Change not awaiting approval", "id", job.ID, "status", job.Status)
+	respondError(c, http.StatusConflict, ErrorResponse{
+		Error:   "change_not_approvable",
+		Message: fmt.Sprintf("change %q is %s, not awaiting approval", job.ID, job.Status),
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// approvalRouter creates a router serving the approval endpoints as the API
+// key identity "key-1"
+func approvalRouter() *gin.Engine {
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set(apiKeyContextKey, "key-1") })
+	router.POST("/change/:id/approve", handleApproveChange)
+	router.POST("/change/:id/reject", handleRejectChange)
+	return router
+}
+
+// parkTestJob submits a job that requires approval and lets a worker park it
+func parkTestJob(t *testing.T) Job {
+	t.Helper()
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli", RequireApproval: true})
+	id, _ := queue.pop(context.Background())
+	processJob(context.Background(), id)
+
+	parked, _ := store.Get(job.ID)
+	if parked.Status != statusPendingApproval {
+		t.Fatalf("Expected status %s, got %s", statusPendingApproval, parked.Status)
+	}
+	if parked.StartedAt != nil {
+		t.Fatalf("Expected a parked change not to start")
+	}
+	return parked
+}
+
+func TestApproveChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	router := approvalRouter()
+
+	job := parkTestJob(t)
+
+	w := postJSON(router, "/change/"+job.ID+"/approve", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var approved Job
+	json.Unmarshal(w.Body.Bytes(), &approved)
+	if approved.Status != statusPending || approved.ApprovedBy != "key-1" || approved.ApprovedAt == nil {
+		t.Errorf("Unexpected approved change: %+v", approved)
+	}
+
+	id, _ := queue.pop(context.Background())
+	if id != job.ID {
+		t.Fatalf("Expected the approved change to be queued, got %q", id)
+	}
+	processJob(context.Background(), id)
+	if got, _ := store.Get(job.ID); got.Status != statusDone {
+		t.Errorf("Expected the approved change to run, got status %s", got.Status)
+	}
+
+	w = postJSON(router, "/change/"+job.ID+"/approve", nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 approving twice, got %d", w.Code)
+	}
+	var errResp ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &errResp)
+	if errResp.Error != "change_not_approvable" {
+		t.Errorf("Expected error 'change_not_approvable', got '%s'", errResp.Error)
+	}
+
+	w = postJSON(router, "/change/missing/approve", nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown change, got %d", w.Code)
+	}
+}
+
+func TestRejectChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	router := approvalRouter()
+
+	job := parkTestJob(t)
+
+	w := postJSON(router, "/change/"+job.ID+"/reject", RejectRequest{Reason: "touches billing"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	got, _ := store.Get(job.ID)
+	if got.Status != statusRejected || got.Reason != "touches billing" || got.RejectedBy != "key-1" || got.FinishedAt == nil {
+		t.Errorf("Unexpected rejected change: %+v", got)
+	}
+	if queue.len() != 0 {
+		t.Errorf("Expected a rejected change not to be queued")
+	}
+
+	w = postJSON(router, "/change/"+job.ID+"/approve", nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("Expected status 409 approving a rejected change, got %d", w.Code)
+	}
+
+	// The reason is optional
+	other := parkTestJob(t)
+	req, _ := http.NewRequest("POST", "/change/"+other.ID+"/reject", bytes.NewBuffer(nil))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 rejecting without a body, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestCancelChangeAwaitingApproval(t *testing.T) {
+	isolateJobs(t)
+
+	job := parkTestJob(t)
+
+	cancelled, ok, err := cancelJob(job.ID, "")
+	if err != nil || !ok {
+		t.Fatalf("Failed to cancel change: %v", err)
+	}
+	if cancelled.Status != statusCancelled || cancelled.FinishedAt == nil {
+		t.Errorf("Expected a parked change to finish once cancelled, got %+v", cancelled)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyContextKey is the gin.Context key holding the identity of the API
+// key that authenticated the request
+const apiKeyContextKey = "apiKey"
+
+// apiKeyIdentity returns a stable, non-secret identifier for key that is
+// safe to log
+func apiKeyIdentity(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "key-" + hex.EncodeToString(sum[:4])
+}
+
+// ginAuth is a middleware that requires a bearer token matching one of
+// config.APIKeys, rejecting the request with 401 otherwise. The identity of
+// the matching key is stored on the context under apiKeyContextKey.
+// Authentication is disabled when no keys are configured.
+func ginAuth() gin.HandlerFunc {
+	keys := config.APIKeys
+
+	return func(c *gin.Context) {
+		if len(keys) == 0 {
+			c.Next()
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			requestLogger(c).Warn("Missing API key", "ip", c.ClientIP())
+			respondError(c, http.StatusUnauthorized, ErrorResponse{
+				Error:   "unauthorized",
+				Message: "an API key is required in the Authorization header as 'Bearer <key>'",
+			})
+			c.Abort()
+			return
+		}
+
+		// Compare against every key so the response time doesn't reveal
+		// which key, if any, matched
+		matched := ""
+		for _, key := range keys {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(key)) == 1 {
+				matched = key
+			}
+		}
+		if matched == "" {
+			requestLogger(c).Warn("Invalid API key", "ip", c.ClientIP())
+			respondError(c, http.StatusUnauthorized, ErrorResponse{
+				Error:   "unauthorized",
+				Message: "the API key is not valid",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set(apiKeyContextKey, apiKeyIdentity(matched))
+		c.Next()
+	}
+}
+
+// adminTokenHeader carries the admin token. It is separate from
+// Authorization so admin endpoints can also sit behind ginAuth.
+const adminTokenHeader = "X-Admin-Token"
+
+// adminAuth is a middleware that requires the X-Admin-Token header to match
+// config.AdminToken. Admin endpoints are disabled with 403 when no token is
+// configured.
+func adminAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if config.AdminToken == "" {
+			respondError(c, http.StatusForbidden, ErrorResponse{
+				Error:   "admin_disabled",
+				Message: "admin endpoints are disabled, set ADMIN_TOKEN to enable them",
+			})
+			c.Abort()
+			return
+		}
+
+		token := c.GetHeader(adminTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(config.AdminToken)) != 1 {
+			requestLogger(c).Warn("Invalid admin token", "ip", c.ClientIP())
+			respondError(c, http.StatusUnauthorized, ErrorResponse{
+				Error:   "unauthorized",
+				Message: "a valid admin token is required in the " + adminTokenHeader + " header",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGinAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config
+	cfg.APIKeys = []string{"alpha", "bravo"}
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.GET("/protected", ginAuth(), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(apiKeyContextKey))
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantStatus    int
+	}{
+		{"missing header", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic alpha", http.StatusUnauthorized},
+		{"invalid key", "Bearer charlie", http.StatusUnauthorized},
+		{"valid key", "Bearer bravo", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/protected", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			if tt.wantStatus == http.StatusOK {
+				if got := w.Body.String(); got != apiKeyIdentity("bravo") {
+					t.Errorf("Expected key identity '%s' on the context, got '%s'", apiKeyIdentity("bravo"), got)
+				}
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Error != "unauthorized" {
+				t.Errorf("Expected error 'unauthorized', got '%s'", response.Error)
+			}
+		})
+	}
+}
+
+func TestGinAuthProbesUnauthenticated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config
+	cfg.APIKeys = []string{"alpha"}
+	setConfig(t, cfg)
+
+	router := newRouter()
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected /health to skip authentication, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/stats", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected /stats to require authentication, got %d", w.Code)
+	}
+
+	if w := postJSON(router, "/change", Change{}); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected /change to require authentication, got %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/change", strings.NewReader("{}"))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer alpha")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected an authenticated /change request to reach validation, got %d", w.Code)
+	}
+}
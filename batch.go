@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxBatchSize bounds how many changes a single batch update may touch
+const maxBatchSize = 100
+
+// Batch update actions
+const (
+	batchActionCancel  = "cancel"
+	batchActionApprove = "approve"
+)
+
+// BatchUpdateRequest applies action to every change in IDs
+type BatchUpdateRequest struct {
+	IDs    []string `json:"ids" binding:"required"`
+	Action string   `json:"action" binding:"required"`
+	Reason string   `json:"reason"`
+}
+
+// BatchUpdateResult reports the outcome of a batch action for one change
+type BatchUpdateResult struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+	// Status is the change's status after the action, when it exists
+	Status  string `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// handleBatchUpdate handles requests to apply an action to several changes at
+// once, reporting the outcome for each change with 207 Multi-Status
+func handleBatchUpdate(c *gin.Context) {
+	log := requestLogger(c)
+
+	var req BatchUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error("Failed to bind batch update", "error", err)
+		respondBindError(c, err)
+		return
+	}
+
+	if len(req.IDs) == 0 || len(req.IDs) > maxBatchSize {
+		log.Warn("Invalid batch size", "size", len(req.IDs))
+		respondError(c, http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_batch",
+			Message: fmt.Sprintf("ids must contain between 1 and %d change IDs", maxBatchSize),
+		})
+		return
+	}
+
+	var apply func(ctx context.Context, id, reason string) BatchUpdateResult
+	switch req.Action {
+	case batchActionCancel:
+		apply = batchCancel
+	case batchActionApprove:
+		approver := c.GetString(apiKeyContextKey)
+		apply = func(ctx context.Context, id, reason string) BatchUpdateResult {
+			return batchApprove(ctx, id, reason, approver)
+		}
+	default:
+		log.Warn("Invalid batch action", "action", req.Action)
+		respondError(c, http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_action",
+			Message: fmt.Sprintf("action %q is not supported, must be 'cancel' or 'approve'", req.Action),
+		})
+		return
+	}
+
+	results := make([]BatchUpdateResult, 0, len(req.IDs))
+	succeeded := 0
+	for _, id := range req.IDs {
+		result := apply(c.Request.Context(), id, req.Reason)
+		if result.Success {
+			succeeded++
+		}
+		results = append(results, result)
+	}
+
+	log.Info("Batch update applied",
+		"action", req.Action,
+		"reason", req.Reason,
+		"requested", len(req.IDs),
+		"succeeded", succeeded,
+	)
+
+	c.JSON(http.StatusMultiStatus, gin.H{
+		"action":  req.Action,
+		"results": results,
+	})
+}
+
+// batchCancel cancels the change id as part of a batch update
+func batchCancel(ctx context.Context, id, reason string) BatchUpdateResult {
+	job, cancelled, err := cancelJob(id, reason)
+	if err != nil {
+		return batchError(ctx, id, err)
+	}
+	if !cancelled {
+		return BatchUpdateResult{
+			ID:      id,
+			Status:  job.Status,
+			Error:   "change_not_cancellable",
+			Message: fmt.Sprintf("change %q is already %s", id, job.Status),
+		}
+	}
+	return BatchUpdateResult{ID: id, Success: true, Status: job.Status}
+}
+
+// batchApprove approves the change id on behalf of approver as part of a
+// batch update
+func batchApprove(ctx context.Context, id, reason, approver string) BatchUpdateResult {
+	job, approved, err := approveJob(id, approver, reason)
+	if err != nil {
+		return batchError(ctx, id, err)
+	}
+	if !approved {
+		return BatchUpdateResult{
+			ID:      id,
+			Status:  job.Status,
+			Error:   "change_not_approvable",
+			Message: fmt.Sprintf("change %q is %s, not awaiting approval", id, job.Status),
+		}
+	}
+	contextLogger(ctx).Info("Change approved", "id", id, "approver", approver)
+	return BatchUpdateResult{ID: id, Success: true, Status: job.Status}
+}
+
+// batchError converts a store error for the change id into a failed result,
+// logging unexpected errors against the request ctx belongs to
+func batchError(ctx context.Context, id string, err error) BatchUpdateResult {
+	if errors.Is(err, ErrJobNotFound) {
+		return BatchUpdateResult{
+			ID:      id,
+			Error:   "change_not_found",
+			Message: fmt.Sprintf("no change with id %q", id),
+		}
+	}
+	contextLogger(ctx).Error("Failed to update change in batch", "id", id, "error", err)
+	return BatchUpdateResult{
+		ID:      id,
+		Error:   "internal_error",
+		Message: "failed to update change",
+	}
+}
+
+// batchSubmitParam is the wildcard value that selects the batch submission
+// method on /changes; see newRouter
+const batchSubmitParam = ":batch"
+
+// batchSubmitRoute is a middleware for the /changes:batch route, which is
+// registered as a wildcard after /changes. Anything but the batch method
+// there is an unknown route, answered with 404 before rateLimiter charges
+// for it.
+func batchSubmitRoute(c *gin.Context) {
+	if c.Param("batch") != batchSubmitParam {
+		respondError(c, http.StatusNotFound, ErrorResponse{
+			Error:   "not_found",
+			Message: fmt.Sprintf("no route for %s %s", c.Request.Method, c.Request.URL.Path),
+		})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
+// BatchSubmitResult reports the outcome of submitting one change in a batch
+type BatchSubmitResult struct {
+	// Index is the position of the change in the submitted array
+	Index int `json:"index"`
+	// ID and Status are set once the change has been accepted. Dry runs
+	// report a status but no ID, as no change is created.
+	ID      string `json:"id,omitempty"`
+	Status  string `json:"status,omitempty"`
+	DryRun  bool   `json:"dryRun,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Errors lists every validation failure of a rejected change
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// handleBatchChange handles requests to submit up to config.MaxBatchSize
+// changes at once, at /changes/batch or /changes:batch. Each change is
+// validated and recorded independently, so one invalid change doesn't reject
+// the rest; the outcome for each is reported with 207 Multi-Status. An
+// X-Hotfix-Reason header applies to every hotfix change in the batch.
+func handleBatchChange(c *gin.Context) {
+	log := requestLogger(c)
+
+	var changes []Change
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		log.Error("Failed to bind batch submission", "error", err)
+		respondBindError(c, err)
+		return
+	}
+
+	// Each change costs a rate limit token, so a batch can't hold more
+	// than a client's burst
+	maxSize := min(config.MaxBatchSize, config.RateLimitBurst)
+	if len(changes) == 0 || len(changes) > maxSize {
+		log.Warn("Invalid batch size", "size", len(changes))
+		respondError(c, http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_batch",
+			Message: fmt.Sprintf("the request body must hold between 1 and %d changes", maxSize),
+		})
+		return
+	}
+
+	// Each change counts against the rate limit, and rateLimiter has
+	// already charged for the first
+	if !chargeRateLimit(c, len(changes)-1) {
+		return
+	}
+
+	hotfixReason := strings.TrimSpace(c.GetHeader(hotfixReasonHeader))
+	results := make([]BatchSubmitResult, 0, len(changes))
+	accepted := 0
+	for i, change := range changes {
+		result := submitBatchItem(c, change, hotfixReason)
+		result.Index = i
+		if result.ID != "" {
+			accepted++
+		}
+		results = append(results, result)
+	}
+
+	log.Info("Batch submission received",
+		"requested", len(changes),
+		"accepted", accepted,
+	)
+
+	c.JSON(http.StatusMultiStatus, gin.H{
+		"results": results,
+	})
+}
+
+// submitBatchItem validates and records one change of a batch submission
+func submitBatchItem(c *gin.Context, change Change, hotfixReason string) BatchSubmitResult {
+	applyChangeDefaults(&change)
+	errResp := validateChange(change)
+	if errResp == nil {
+		errResp = validateHotfix(change.Spec.Hotfix, hotfixReason)
+	}
+	if errResp != nil {
+		requestLogger(c).Warn("Invalid change in batch", "error", errResp.Error, "message", errResp.Message)
+		return BatchSubmitResult{Error: errResp.Error, Message: errResp.Message, Errors: errResp.Errors}
+	}
+
+	if change.Spec.DryRun {
+		return BatchSubmitResult{Status: dryRunStatus, DryRun: true}
+	}
+
+	job, _, errResp := createJob(c, change, hotfixReason)
+	if errResp != nil {
+		return BatchSubmitResult{Error: errResp.Error, Message: errResp.Message}
+	}
+	return BatchSubmitResult{ID: job.ID, Status: job.Status}
+}
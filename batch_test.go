@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postBatchUpdate sends body to the batch update endpoint with the given admin
+// token
+func postBatchUpdate(router *gin.Engine, token string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", "/change/batch-update", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set(adminTokenHeader, token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestBatchUpdateApprove(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	cfg := config
+	cfg.AdminToken = "s3cret"
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set(apiKeyContextKey, "key-1") })
+	router.POST("/change/batch-update", adminAuth(), handleBatchUpdate)
+
+	parked := parkTestJob(t)
+	pending := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+
+	w := postBatchUpdate(router, "s3cret", BatchUpdateRequest{
+		IDs:    []string{parked.ID, pending.ID},
+		Action: "approve",
+		Reason: "reviewed in CAB",
+	})
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Results []BatchUpdateResult `json:"results"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if len(response.Results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(response.Results))
+	}
+	if r := response.Results[0]; !r.Success || r.Status != statusPending {
+		t.Errorf("Expected the parked change to be approved, got %+v", r)
+	}
+	if r := response.Results[1]; r.Success || r.Error != "change_not_approvable" {
+		t.Errorf("Expected the pending change not to be approvable, got %+v", r)
+	}
+
+	got, _ := store.Get(parked.ID)
+	if got.ApprovedBy != "key-1" || got.Reason != "reviewed in CAB" {
+		t.Errorf("Unexpected approved change: %+v", got)
+	}
+}
+
+func TestBatchUpdateCancel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	cfg := config
+	cfg.AdminToken = "s3cret"
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.POST("/change/batch-update", adminAuth(), handleBatchUpdate)
+
+	pending := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	running := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	store.Update(running.ID, func(j *Job) { j.Status = statusRunning })
+	done := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	store.Update(done.ID, func(j *Job) { j.Status = statusDone })
+
+	w := postBatchUpdate(router, "s3cret", BatchUpdateRequest{
+		IDs:    []string{pending.ID, running.ID, done.ID, "missing"},
+		Action: "cancel",
+		Reason: "pipeline aborted",
+	})
+
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Results []BatchUpdateResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	want := []struct {
+		success bool
+		status  string
+		error   string
+	}{
+		{true, statusCancelled, ""},
+		{true, statusCancelled, ""},
+		{false, statusDone, "change_not_cancellable"},
+		{false, "", "change_not_found"},
+	}
+	if len(response.Results) != len(want) {
+		t.Fatalf("Expected %d results, got %d", len(want), len(response.Results))
+	}
+	for i, result := range response.Results {
+		if result.Success != want[i].success || result.Status != want[i].status || result.Error != want[i].error {
+			t.Errorf("Result %d: expected %+v, got %+v", i, want[i], result)
+		}
+	}
+
+	got, _ := store.Get(pending.ID)
+	if got.Reason != "pipeline aborted" || got.FinishedAt == nil {
+		t.Errorf("Expected cancelled pending change to record the reason and finish, got %+v", got)
+	}
+}
+
+func TestBatchUpdateValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	cfg := config
+	cfg.AdminToken = "s3cret"
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.POST("/change/batch-update", adminAuth(), handleBatchUpdate)
+
+	tests := []struct {
+		name       string
+		token      string
+		body       BatchUpdateRequest
+		wantStatus int
+		wantError  string
+	}{
+		{"missing token", "", BatchUpdateRequest{IDs: []string{"a"}, Action: "cancel"}, http.StatusUnauthorized, "unauthorized"},
+		{"wrong token", "guess", BatchUpdateRequest{IDs: []string{"a"}, Action: "cancel"}, http.StatusUnauthorized, "unauthorized"},
+		{"unknown action", "s3cret", BatchUpdateRequest{IDs: []string{"a"}, Action: "delete"}, http.StatusBadRequest, "invalid_action"},
+		{"empty ids", "s3cret", BatchUpdateRequest{IDs: []string{}, Action: "cancel"}, http.StatusBadRequest, "invalid_batch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postBatchUpdate(router, tt.token, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got '%s'", tt.wantError, response.Error)
+			}
+		})
+	}
+}
+
+func TestBatchUpdateDisabledWithoutAdminToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config
+	cfg.AdminToken = ""
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.POST("/change/batch-update", adminAuth(), handleBatchUpdate)
+
+	w := postBatchUpdate(router, "anything", BatchUpdateRequest{IDs: []string{"a"}, Action: "cancel"})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status 403, got %d", w.Code)
+	}
+}
+
+func TestBatchSubmit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/changes:batch", handleBatchChange)
+
+	valid := Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Add comprehensive error handling to all HTTP handlers",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "copilot-cli",
+		},
+	}
+	invalidKind := valid
+	invalidKind.Kind = "Other"
+	invalidAgent := valid
+	invalidAgent.Spec.Agent = "unknown-agent"
+	invalidRepo := valid
+	invalidRepo.Spec.Repos = repoRefs("not a url")
+	invalidBranch := valid
+	invalidBranch.Spec.Branch = "feature..x"
+
+	w := postJSON(router, "/changes:batch", []Change{valid, invalidKind, invalidAgent, valid, invalidRepo, invalidBranch})
+	if w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Results []BatchSubmitResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	want := []string{"", "invalid_kind", "invalid_agent", "", "invalid_repo", "invalid_branch"}
+	if len(response.Results) != len(want) {
+		t.Fatalf("Expected %d results, got %d", len(want), len(response.Results))
+	}
+	for i, result := range response.Results {
+		if result.Index != i {
+			t.Errorf("Result %d: expected index %d, got %d", i, i, result.Index)
+		}
+		if result.Error != want[i] {
+			t.Errorf("Result %d: expected error '%s', got '%s'", i, want[i], result.Error)
+		}
+		if want[i] != "" {
+			if result.ID != "" || result.Message == "" {
+				t.Errorf("Result %d: expected a message and no id for a rejected change, got %+v", i, result)
+			}
+			continue
+		}
+		if result.Status != statusPending {
+			t.Errorf("Result %d: expected status '%s', got '%s'", i, statusPending, result.Status)
+		}
+		job, err := store.Get(result.ID)
+		if err != nil {
+			t.Fatalf("Result %d: accepted change was not stored: %v", i, err)
+		}
+		if job.Change.Spec.Branch != "main" {
+			t.Errorf("Result %d: expected default branch 'main', got '%s'", i, job.Change.Spec.Branch)
+		}
+	}
+	if depth := queue.len(); depth != 2 {
+		t.Errorf("Expected 2 queued changes, got %d", depth)
+	}
+}
+
+func TestBatchSubmitRateLimitedPerChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	cfg := config
+	cfg.RateLimitBurst = 5
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.POST("/changes:batch", rateLimiter(newClientLimiters(1, cfg.RateLimitBurst)), handleBatchChange)
+
+	changes := func(n int) []Change {
+		batch := make([]Change, n)
+		for i := range batch {
+			batch[i] = validTestChange()
+			batch[i].Spec.DryRun = true
+		}
+		return batch
+	}
+
+	if w := postJSON(router, "/changes:batch", changes(3)); w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d: %s", w.Code, w.Body.String())
+	}
+	// Two of the five tokens are left, too few for another three changes
+	w := postJSON(router, "/changes:batch", changes(3))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBatchSubmitDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/changes:batch", handleBatchChange)
+
+	dryRun := Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Add retries",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "copilot-cli",
+			DryRun: true,
+		},
+	}
+
+	w := postJSON(router, "/changes:batch", []Change{dryRun})
+	var response struct {
+		Results []BatchSubmitResult `json:"results"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Results) != 1 || !response.Results[0].DryRun || response.Results[0].Status != dryRunStatus || response.Results[0].ID != "" || response.Results[0].Error != "" {
+		t.Errorf("Expected a dry run result without an id, got %+v", response.Results)
+	}
+	if depth := queue.len(); depth != 0 {
+		t.Errorf("Expected no changes to be queued, got %d", depth)
+	}
+}
+
+func TestBatchSubmitValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	cfg := config
+	cfg.MaxBatchSize = 3
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.POST("/changes/batch", handleBatchChange)
+	router.POST("/changes:batch", batchSubmitRoute, handleBatchChange)
+
+	tests := []struct {
+		name       string
+		path       string
+		body       interface{}
+		wantStatus int
+		wantError  string
+	}{
+		{"empty batch", "/changes:batch", []Change{}, http.StatusBadRequest, "invalid_batch"},
+		{"at the limit", "/changes:batch", make([]Change, 3), http.StatusMultiStatus, ""},
+		{"too many changes", "/changes:batch", make([]Change, 4), http.StatusBadRequest, "invalid_batch"},
+		{"not an array", "/changes:batch", Change{Kind: "Change"}, http.StatusBadRequest, "invalid_request"},
+		{"unknown method", "/changes:purge", []Change{}, http.StatusNotFound, "not_found"},
+		{"slash path", "/changes/batch", make([]Change, 3), http.StatusMultiStatus, ""},
+		{"slash path too many changes", "/changes/batch", make([]Change, 4), http.StatusBadRequest, "invalid_batch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, tt.path, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantError == "" {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got '%s'", tt.wantError, response.Error)
+			}
+		})
+	}
+}
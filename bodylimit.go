@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bodyLimit is a middleware that caps request bodies at limit bytes. Requests
+// declaring a larger Content-Length are rejected with a 413 before their body
+// is read; for the rest, reading past the limit fails with an
+// *http.MaxBytesError, which handlers report through respondBindError.
+func bodyLimit(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > limit {
+			respondBindError(c, &http.MaxBytesError{Limit: limit})
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
+
+// respondBindError writes the error response for a request body that could
+// not be bound: 413 when it exceeded the body limit, 400 otherwise
+func respondBindError(c *gin.Context, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		requestLogger(c).Warn("Request body too large", "limit", tooLarge.Limit)
+		respondError(c, http.StatusRequestEntityTooLarge, ErrorResponse{
+			Error:   "payload_too_large",
+			Message: fmt.Sprintf("request body must not exceed %d bytes", tooLarge.Limit),
+		})
+		return
+	}
+
+	respondError(c, http.StatusBadRequest, ErrorResponse{
+		Error:   "invalid_request",
+		Message: err.Error(),
+	})
+}
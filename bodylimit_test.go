@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBodyLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.Use(bodyLimit(1024))
+	router.POST("/change", handleChange)
+	router.POST("/change/simple", handleSimpleChange)
+
+	oversized := `{"kind":"Change","apiVersion":"v1","spec":{"prompt":"` + strings.Repeat("x", 2048) + `"}}`
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantError   string
+	}{
+		{
+			name:        "oversized JSON",
+			path:        "/change",
+			contentType: "application/json",
+			body:        oversized,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantError:   "payload_too_large",
+		},
+		{
+			name:        "oversized YAML",
+			path:        "/change",
+			contentType: "application/yaml",
+			body:        "kind: Change\nspec:\n  prompt: " + strings.Repeat("x", 2048) + "\n",
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantError:   "payload_too_large",
+		},
+		{
+			name:        "oversized form",
+			path:        "/change/simple",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "prompt=" + strings.Repeat("x", 2048),
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantError:   "payload_too_large",
+		},
+		{
+			name:        "malformed JSON under the limit",
+			path:        "/change",
+			contentType: "application/json",
+			body:        `{"kind":`,
+			wantStatus:  http.StatusBadRequest,
+			wantError:   "invalid_request",
+		},
+		{
+			name:        "valid JSON under the limit",
+			path:        "/change",
+			contentType: "application/json",
+			body:        `{"kind":"Change","apiVersion":"v1","spec":{"prompt":"Test","repos":["https://github.com/myorg/repo1"],"agent":"copilot-cli"}}`,
+			wantStatus:  http.StatusAccepted,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantError == "" {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got '%s'", tt.wantError, response.Error)
+			}
+		})
+	}
+}
+
+func TestBodyLimitRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config
+	cfg.MaxBodyBytes = 1024
+	cfg.APIKeys = nil
+	setConfig(t, cfg)
+
+	router := newRouter()
+
+	// A declared length over the limit is rejected before the body is read,
+	// and a body that hides its length is cut off while it is read
+	for _, chunked := range []bool{false, true} {
+		body := strings.NewReader(`{"kind":"Change","spec":{"prompt":"` + strings.Repeat("x", 4096) + `"}}`)
+		req, _ := http.NewRequest("POST", "/change", body)
+		req.Header.Set("Content-Type", "application/json")
+		if chunked {
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("chunked %v: expected status 413, got %d: %s", chunked, w.Code, w.Body.String())
+		}
+		var response ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Error != "payload_too_large" {
+			t.Errorf("chunked %v: expected error 'payload_too_large', got '%s'", chunked, response.Error)
+		}
+	}
+}
+
+func TestMaxBodyBytesConfig(t *testing.T) {
+	if got := loadConfig().MaxBodyBytes; got != 1<<20 {
+		t.Errorf("Expected a default limit of 1 MiB, got %d", got)
+	}
+
+	t.Setenv("MAX_REQUEST_BODY_BYTES", "2048")
+	if got := loadConfig().MaxBodyBytes; got != 2048 {
+		t.Errorf("Expected MAX_REQUEST_BODY_BYTES to set the limit, got %d", got)
+	}
+}
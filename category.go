@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultCategory is applied to changes that don't set spec.changeCategory
+// and is always valid
+const defaultCategory = "uncategorized"
+
+// CategoryRegistry holds the values accepted for spec.changeCategory
+type CategoryRegistry struct {
+	names []string
+	known map[string]bool
+}
+
+var categories = NewCategoryRegistry(nil)
+
+// NewCategoryRegistry creates a CategoryRegistry of defaultCategory followed
+// by names, ignoring duplicates
+func NewCategoryRegistry(names []string) *CategoryRegistry {
+	r := &CategoryRegistry{known: make(map[string]bool)}
+	for _, name := range append([]string{defaultCategory}, names...) {
+		if !r.known[name] {
+			r.known[name] = true
+			r.names = append(r.names, name)
+		}
+	}
+	return r
+}
+
+// Contains reports whether name is a registered category
+func (r *CategoryRegistry) Contains(name string) bool {
+	return r.known[name]
+}
+
+// List returns the registered categories in registration order
+func (r *CategoryRegistry) List() []string {
+	return append([]string(nil), r.names...)
+}
+
+// handleListCategories handles requests for the valid change categories
+func handleListCategories(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"categories": categories.List(),
+	})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setCategories replaces the category registry for the duration of a test
+func setCategories(t *testing.T, names ...string) {
+	t.Helper()
+
+	previous := categories
+	categories = NewCategoryRegistry(names)
+	t.Cleanup(func() { categories = previous })
+}
+
+func TestCategoryRegistry(t *testing.T) {
+	r := NewCategoryRegistry([]string{"security", "refactor", "security"})
+
+	if got, want := r.List(), []string{"uncategorized", "security", "refactor"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected categories %v, got %v", want, got)
+	}
+	if !r.Contains("uncategorized") || !r.Contains("refactor") {
+		t.Error("Expected registered categories to be found")
+	}
+	if r.Contains("Security") || r.Contains("") {
+		t.Error("Expected unregistered categories not to be found")
+	}
+}
+
+func TestListCategoriesEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	setCategories(t, "security", "dependency-bump")
+
+	router := gin.New()
+	router.GET("/categories", handleListCategories)
+
+	req, _ := http.NewRequest("GET", "/categories", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response struct {
+		Categories []string `json:"categories"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if want := []string{"uncategorized", "security", "dependency-bump"}; !reflect.DeepEqual(response.Categories, want) {
+		t.Errorf("Expected categories %v, got %v", want, response.Categories)
+	}
+}
+
+func TestChangeEndpointCategory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	isolateJobs(t)
+	setCategories(t, "security")
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+	router.GET("/changes", handleListChanges)
+
+	submit := func(category string) *httptest.ResponseRecorder {
+		return postJSON(router, "/change", Change{
+			Kind:       "Change",
+			APIVersion: "v1",
+			Spec: ChangeSpec{
+				Prompt:   "Test prompt " + category,
+				Repos:    repoRefs("https://github.com/myorg/repo1"),
+				Agent:    "claude-cli",
+				Category: category,
+			},
+		})
+	}
+
+	w := submit("")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", w.Code)
+	}
+	var accepted struct {
+		Change Change `json:"change"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &accepted); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if accepted.Change.Spec.Category != "uncategorized" {
+		t.Errorf("Expected default category 'uncategorized', got '%s'", accepted.Change.Spec.Category)
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := submit("security"); w.Code != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d", w.Code)
+		}
+	}
+
+	w = submit("marketing")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+	var errResp ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &errResp)
+	if errResp.Error != "unknown_category" {
+		t.Errorf("Expected error 'unknown_category', got '%s'", errResp.Error)
+	}
+
+	req, _ := http.NewRequest("GET", "/changes?category=security", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var response struct {
+		Total int          `json:"total"`
+		Items []JobSummary `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Total != 2 || len(response.Items) != 2 {
+		t.Errorf("Expected 2 security changes, got total %d with %d items", response.Total, len(response.Items))
+	}
+}
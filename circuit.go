@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// circuitFailureThreshold is how many consecutive failed changes open an
+// agent's circuit
+const circuitFailureThreshold = 5
+
+// circuitOpenDuration is how long an open circuit rejects changes before
+// letting one through as a probe. Tests shorten it.
+var circuitOpenDuration = 30 * time.Second
+
+// Circuit breaker states reported by GET /agents/status
+const (
+	circuitClosed   = "closed"
+	circuitOpen     = "open"
+	circuitHalfOpen = "half_open"
+)
+
+// circuitBreaker stops changes from being sent to an agent that keeps
+// failing. It opens after circuitFailureThreshold consecutive failures and
+// rejects changes for circuitOpenDuration, then goes half-open and lets a
+// single probe change through: the circuit closes if the probe succeeds and
+// opens again if it fails.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+	now      func() time.Time
+}
+
+// newCircuitBreaker creates a closed circuitBreaker
+func newCircuitBreaker() *circuitBreaker {
+	return &circuitBreaker{state: circuitClosed, now: time.Now}
+}
+
+// allow reports whether a change may run, claiming the probe when the
+// circuit is half-open. Every allowed change must be reported with record
+// or release.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitOpen && b.now().Sub(b.openedAt) >= circuitOpenDuration {
+		b.state = circuitHalfOpen
+	}
+	switch b.state {
+	case circuitOpen:
+		return false
+	case circuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+	}
+	return true
+}
+
+// record reports the outcome of an allowed change, err being nil when it
+// succeeded
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		b.state, b.failures = circuitClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= circuitFailureThreshold {
+		b.state, b.openedAt = circuitOpen, b.now()
+	}
+}
+
+// release reports that an allowed change ended without an outcome, such as
+// when it was cancelled, freeing the probe for another change
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// retryAt returns when an open circuit lets a probe through
+func (b *circuitBreaker) retryAt() time.Time {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.openedAt.Add(circuitOpenDuration)
+}
+
+// AgentCircuitStatus is an agent's circuit breaker state as reported by
+// GET /agents/status
+type AgentCircuitStatus struct {
+	Agent               string `json:"agent"`
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	// RetryAt is when an open circuit lets a probe change through
+	RetryAt *time.Time `json:"retryAt,omitempty"`
+}
+
+// status returns the breaker's state for agent
+func (b *circuitBreaker) status(agent string) AgentCircuitStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := AgentCircuitStatus{Agent: agent, State: b.state, ConsecutiveFailures: b.failures}
+	if b.state == circuitOpen {
+		if retryAt := b.openedAt.Add(circuitOpenDuration); b.now().Before(retryAt) {
+			retryAt = retryAt.UTC()
+			status.RetryAt = &retryAt
+		} else {
+			// The next change will be let through as a probe
+			status.State = circuitHalfOpen
+		}
+	}
+	return status
+}
+
+// circuitBreakers hands out a circuitBreaker per agent
+type circuitBreakers struct {
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+}
+
+// newCircuitBreakers creates an empty circuitBreakers
+func newCircuitBreakers() *circuitBreakers {
+	return &circuitBreakers{breakers: make(map[string]*circuitBreaker)}
+}
+
+// get returns the breaker for agent, creating it closed on first use
+func (c *circuitBreakers) get(agent string) *circuitBreaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.breakers[agent]
+	if !ok {
+		b = newCircuitBreaker()
+		c.breakers[agent] = b
+	}
+	return b
+}
+
+// agentBreakers holds the circuit breaker of each agent
+var agentBreakers = newCircuitBreakers()
+
+// handleAgentStatus handles requests for the circuit breaker state of each
+// agent in agentRegistry
+func handleAgentStatus(c *gin.Context) {
+	agents := agentRegistry.Names()
+
+	statuses := make([]AgentCircuitStatus, 0, len(agents))
+	for _, agent := range agents {
+		statuses = append(statuses, agentBreakers.get(agent).status(agent))
+	}
+	c.JSON(http.StatusOK, gin.H{"agents": statuses})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := newCircuitBreaker()
+	b.now = func() time.Time { return now }
+	failed := errors.New("agent failed")
+
+	// A success resets the consecutive failures
+	for i := 0; i < circuitFailureThreshold-1; i++ {
+		b.allow()
+		b.record(failed)
+	}
+	b.allow()
+	b.record(nil)
+	if status := b.status("copilot-cli"); status.State != circuitClosed || status.ConsecutiveFailures != 0 {
+		t.Fatalf("Expected a closed circuit after a success, got %+v", status)
+	}
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		if !b.allow() {
+			t.Fatalf("Expected change %d to be allowed", i+1)
+		}
+		b.record(failed)
+	}
+	if b.allow() {
+		t.Fatal("Expected an open circuit to reject changes")
+	}
+	status := b.status("copilot-cli")
+	if status.State != circuitOpen || status.RetryAt == nil || !status.RetryAt.Equal(now.Add(circuitOpenDuration)) {
+		t.Errorf("Expected an open circuit retrying in %s, got %+v", circuitOpenDuration, status)
+	}
+
+	// After the open duration a single probe is let through, and its
+	// failure opens the circuit again
+	now = now.Add(circuitOpenDuration)
+	if !b.allow() {
+		t.Fatal("Expected a probe once the open duration passed")
+	}
+	if b.allow() {
+		t.Error("Expected only one probe at a time")
+	}
+	b.record(failed)
+	if b.allow() {
+		t.Error("Expected a failed probe to open the circuit again")
+	}
+
+	// A released probe frees the slot, and a successful one closes the
+	// circuit
+	now = now.Add(circuitOpenDuration)
+	b.allow()
+	b.release()
+	if !b.allow() {
+		t.Fatal("Expected a released probe to let another through")
+	}
+	b.record(nil)
+	if status := b.status("copilot-cli"); status.State != circuitClosed || status.ConsecutiveFailures != 0 || status.RetryAt != nil {
+		t.Errorf("Expected a closed circuit after a successful probe, got %+v", status)
+	}
+}
+
+func TestProcessJobCircuitOpen(t *testing.T) {
+	isolateJobs(t)
+	calls := 0
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		calls++
+		return ChangeResult{}, errors.New("agent crashed")
+	})
+
+	for i := 0; i < circuitFailureThreshold; i++ {
+		job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+		processJob(context.Background(), job.ID)
+	}
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	processJob(context.Background(), job.ID)
+
+	got, _ := store.Get(job.ID)
+	if got.Status != statusFailed || got.Error != "agent_circuit_open" {
+		t.Errorf("Expected the change to fail with agent_circuit_open, got '%s' '%s'", got.Status, got.Error)
+	}
+	if calls != circuitFailureThreshold {
+		t.Errorf("Expected the agent to run %d times, got %d", circuitFailureThreshold, calls)
+	}
+
+	// Other agents are unaffected
+	setAgentRunner(t, "claude-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		return ChangeResult{}, nil
+	})
+	other := submitTestJob(t, ChangeSpec{Agent: "claude-cli"})
+	processJob(context.Background(), other.ID)
+	if got, _ := store.Get(other.ID); got.Status != statusDone {
+		t.Errorf("Expected claude-cli changes to run, got '%s' '%s'", got.Status, got.Error)
+	}
+}
+
+func TestAgentStatusEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	cfg := config
+	cfg.ValidAgents = []string{"gemini-cli", "copilot-cli"}
+	setConfig(t, cfg)
+
+	breaker := agentBreakers.get("copilot-cli")
+	for i := 0; i < circuitFailureThreshold; i++ {
+		breaker.allow()
+		breaker.record(errors.New("agent failed"))
+	}
+
+	router := gin.New()
+	router.GET("/agents/status", handleAgentStatus)
+	req, _ := http.NewRequest("GET", "/agents/status", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	var response struct {
+		Agents []AgentCircuitStatus `json:"agents"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if len(response.Agents) != 2 {
+		t.Fatalf("Expected 2 agents, got %+v", response.Agents)
+	}
+	if a := response.Agents[0]; a.Agent != "copilot-cli" || a.State != circuitOpen || a.ConsecutiveFailures != circuitFailureThreshold || a.RetryAt == nil {
+		t.Errorf("Expected copilot-cli's circuit to be open, got %+v", a)
+	}
+	if a := response.Agents[1]; a.Agent != "gemini-cli" || a.State != circuitClosed || a.RetryAt != nil {
+		t.Errorf("Expected gemini-cli's circuit to be closed, got %+v", a)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// maxCompletionAttempts is how many times a completion or acceptance webhook
+// is delivered before giving up
+const maxCompletionAttempts = 3
+
+// completionRetryDelay is the wait before the second delivery attempt; it
+// doubles for each attempt after that. Tests shorten it.
+var completionRetryDelay = time.Second
+
+// completionWebhooks tracks completion and acceptance deliveries still in
+// flight so shutdown can wait for them
+var completionWebhooks sync.WaitGroup
+
+// CompletionPayload is POSTed to spec.webhookURL once a change finishes
+type CompletionPayload struct {
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// AcceptancePayload is POSTed to WEBHOOK_URL once a change is accepted
+type AcceptancePayload struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Change Change `json:"change"`
+}
+
+// validateWebhookURL checks spec.webhookURL, returning nil when it is valid
+// or unset. Like repositories, webhooks must not target local or private
+// hosts.
+func validateWebhookURL(raw string) *ErrorResponse {
+	if raw == "" {
+		return nil
+	}
+
+	if u, err := url.Parse(raw); !isHTTPSURL(raw) || err != nil || isPrivateHost(u.Hostname()) {
+		return &ErrorResponse{
+			Error:   "invalid_webhook_url",
+			Message: fmt.Sprintf("spec.webhookURL %q must be an HTTPS URL on a public host", raw),
+		}
+	}
+
+	return nil
+}
+
+// notifyCompletion reports the final state of job to its spec.webhookURL, if
+// it has one. Delivery happens in the background and is retried with
+// exponential backoff up to maxCompletionAttempts times.
+func notifyCompletion(job Job) {
+	target := job.Change.Spec.WebhookURL
+	if target == "" {
+		return
+	}
+
+	payload := CompletionPayload{
+		ID:      job.ID,
+		Status:  job.Status,
+		Error:   job.Error,
+		Message: job.Message,
+	}
+
+	completionWebhooks.Add(1)
+	go func() {
+		defer completionWebhooks.Done()
+		deliverWebhook("Completion", target, job.ID, payload)
+	}()
+}
+
+// notifyAcceptance reports a newly accepted job to config.WebhookURL, if it
+// is set, delivering it in the background like notifyCompletion
+func notifyAcceptance(job Job) {
+	target := config.WebhookURL
+	if target == "" {
+		return
+	}
+
+	payload := AcceptancePayload{
+		ID:     job.ID,
+		Status: job.Status,
+		Change: job.Change,
+	}
+
+	completionWebhooks.Add(1)
+	go func() {
+		defer completionWebhooks.Done()
+		deliverWebhook("Acceptance", target, job.ID, payload)
+	}()
+}
+
+// deliverWebhook POSTs the payload for the job with the given ID to target,
+// retrying failed attempts. kind names the webhook in log messages.
+func deliverWebhook(kind, target, id string, payload interface{}) {
+	delay := completionRetryDelay
+	for attempt := 1; ; attempt++ {
+		err := postWebhook(context.Background(), target, payload)
+		if err == nil {
+			logger.Info(kind+" webhook delivered", "id", id, "attempt", attempt)
+			return
+		}
+		if attempt == maxCompletionAttempts {
+			logger.Error(kind+" webhook delivery failed", "id", id, "url", target, "attempts", attempt, "error", err)
+			return
+		}
+
+		logger.Warn(kind+" webhook attempt failed", "id", id, "url", target, "attempt", attempt, "retryIn", delay.String(), "error", err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// completionServer starts a TLS server that records the completion payloads
+// it receives, failing the first failures requests with 500. Webhook
+// deliveries are routed to it for the duration of the test.
+func completionServer(t *testing.T, failures int) (url string, received func() []CompletionPayload) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var payloads []CompletionPayload
+	attempts := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		attempts++
+		if attempts <= failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var payload CompletionPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+	}))
+	t.Cleanup(server.Close)
+
+	previousClient, previousDelay := webhookClient, completionRetryDelay
+	t.Cleanup(func() { webhookClient, completionRetryDelay = previousClient, previousDelay })
+	webhookClient = server.Client()
+	completionRetryDelay = time.Millisecond
+
+	return server.URL, func() []CompletionPayload {
+		completionWebhooks.Wait()
+		mu.Lock()
+		defer mu.Unlock()
+		return payloads
+	}
+}
+
+func TestValidateWebhookURL(t *testing.T) {
+	tests := []struct {
+		name  string
+		url   string
+		valid bool
+	}{
+		{"unset", "", true},
+		{"valid", "https://hooks.example.com/done", true},
+		{"plain HTTP", "http://hooks.example.com/done", false},
+		{"private host", "https://192.168.1.10/done", false},
+		{"localhost", "https://localhost/done", false},
+		{"not a URL", "hooks", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errResp := validateWebhookURL(tt.url)
+			if tt.valid && errResp != nil {
+				t.Errorf("Expected valid, got %+v", errResp)
+			}
+			if !tt.valid && (errResp == nil || errResp.Error != "invalid_webhook_url") {
+				t.Errorf("Expected invalid_webhook_url, got %+v", errResp)
+			}
+		})
+	}
+}
+
+func TestProcessJobNotifiesCompletion(t *testing.T) {
+	isolateJobs(t)
+	url, received := completionServer(t, 0)
+
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		if req.Spec.Prompt == "fail" {
+			return ChangeResult{}, errors.New("agent crashed")
+		}
+		return ChangeResult{}, nil
+	})
+
+	done := submitTestJob(t, ChangeSpec{Prompt: "succeed", Agent: "copilot-cli", WebhookURL: url})
+	processJob(context.Background(), done.ID)
+	failed := submitTestJob(t, ChangeSpec{Prompt: "fail", Agent: "copilot-cli", WebhookURL: url})
+	processJob(context.Background(), failed.ID)
+	quiet := submitTestJob(t, ChangeSpec{Prompt: "succeed", Agent: "copilot-cli"})
+	processJob(context.Background(), quiet.ID)
+
+	payloads := received()
+	if len(payloads) != 2 {
+		t.Fatalf("Expected 2 completion webhooks, got %d: %+v", len(payloads), payloads)
+	}
+	byID := map[string]CompletionPayload{payloads[0].ID: payloads[0], payloads[1].ID: payloads[1]}
+	if got := byID[done.ID]; got.Status != statusDone || got.Error != "" {
+		t.Errorf("Expected a done payload for %s, got %+v", done.ID, got)
+	}
+	if got := byID[failed.ID]; got.Status != statusFailed || got.Error == "" || got.Message == "" {
+		t.Errorf("Expected a failed payload with an error for %s, got %+v", failed.ID, got)
+	}
+}
+
+func TestCancelJobNotifiesCompletion(t *testing.T) {
+	isolateJobs(t)
+	url, received := completionServer(t, 0)
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli", WebhookURL: url})
+	if _, cancelled, err := cancelJob(job.ID, "no longer needed"); err != nil || !cancelled {
+		t.Fatalf("Expected the change to be cancelled, got cancelled=%v err=%v", cancelled, err)
+	}
+
+	payloads := received()
+	if len(payloads) != 1 || payloads[0].ID != job.ID || payloads[0].Status != statusCancelled {
+		t.Errorf("Expected one cancelled payload for %s, got %+v", job.ID, payloads)
+	}
+}
+
+func TestCompletionWebhookRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		delivered bool
+	}{
+		{"succeeds after retries", maxCompletionAttempts - 1, true},
+		{"gives up", maxCompletionAttempts, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateJobs(t)
+			url, received := completionServer(t, tt.failures)
+
+			notifyCompletion(Job{ID: "abc", Status: statusDone, Change: Change{Spec: ChangeSpec{WebhookURL: url}}})
+
+			if got := len(received()) == 1; got != tt.delivered {
+				t.Errorf("Expected delivered %v, got %v", tt.delivered, got)
+			}
+		})
+	}
+}
+
+func TestChangeEndpointNotifiesAcceptance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	var mu sync.Mutex
+	var payloads []AcceptancePayload
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Fail the first attempt so the delivery is retried
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var payload AcceptancePayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+	}))
+	t.Cleanup(server.Close)
+
+	previousDelay := completionRetryDelay
+	t.Cleanup(func() { completionRetryDelay = previousDelay })
+	completionRetryDelay = time.Millisecond
+
+	cfg := config
+	cfg.WebhookURL = server.URL
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	change := validTestChange()
+	w := postJSON(router, "/change", change)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	completionWebhooks.Wait()
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 2 || len(payloads) != 1 {
+		t.Fatalf("Expected one payload delivered on the second attempt, got %d attempts: %+v", attempts, payloads)
+	}
+	got := payloads[0]
+	if got.ID != response.ID || got.Status != statusPending || got.Change.Spec.Prompt != change.Spec.Prompt {
+		t.Errorf("Expected the accepted change %s, got %+v", response.ID, got)
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default values for settings that can be overridden via the config file or
+// the environment
+const (
+	defaultConfigFile        = "config.yaml"
+	defaultPort              = "8080"
+	defaultMaxPromptLength   = 4096
+	defaultMaxRepos          = 50
+	defaultReadinessCacheTTL = 2 * time.Second
+	defaultNamespace         = "default"
+	defaultBranch            = "main"
+	defaultShutdownTimeout   = 30 * time.Second
+	defaultAgentMaxAttempts  = 1
+	defaultMaxRetries        = 3
+	defaultWorkerPoolSize    = 4
+	defaultRepoConcurrency   = 4
+	defaultMaxBodyBytes      = 1 << 20
+	defaultGzipLevel         = gzip.DefaultCompression
+	defaultWorkspaceMaxGB    = 10
+	defaultRateLimitRPM      = 60
+	defaultRateLimitBurst    = 20
+	defaultResultCacheTTL    = time.Hour
+	defaultWebhookTimeout    = 10 * time.Second
+	defaultMaxBatchSize      = 50
+	defaultRequestTimeout    = 30 * time.Second
+	defaultIdempotencyTTL    = 24 * time.Hour
+	defaultDedupWindow       = 60 * time.Second
+	defaultSchedulerInterval = 10 * time.Second
+)
+
+// Config holds runtime settings read from the config file and the
+// environment at startup
+type Config struct {
+	// Port is the port the API server listens on
+	Port string
+	// BindAddress is the host or IP address the API server listens on; it
+	// listens on all interfaces when empty
+	BindAddress string
+	// LogFormat and LogLevel configure the logger, see newLogger
+	LogFormat string
+	LogLevel  string
+	// MaxPromptLength is the maximum number of runes allowed in spec.prompt
+	MaxPromptLength int
+	// MaxRepos is the maximum number of entries allowed in spec.repos
+	MaxRepos int
+	// ReadinessCacheTTL is how long successful readiness checks are reused
+	ReadinessCacheTTL time.Duration
+	// DefaultNamespace is applied to named changes that don't set metadata.namespace
+	DefaultNamespace string
+	// DefaultBranch is applied to changes that don't set spec.branch
+	DefaultBranch string
+	// ReuseTerminalNames allows a name to be reused once the change holding
+	// it has reached a terminal state
+	ReuseTerminalNames bool
+	// ShutdownTimeout is how long in-flight requests get to finish on shutdown
+	ShutdownTimeout time.Duration
+	// DBPath is the SQLite database file jobs are persisted to; jobs are kept
+	// in memory when it is empty
+	DBPath string
+	// DatabaseURL is the SQLite database jobs are persisted to, such as
+	// sqlite:///var/lib/demo-app/jobs.db; it takes precedence over DBPath
+	DatabaseURL string `config:"secret"`
+	// AgentMaxAttempts is how many times a failing agent run is attempted
+	AgentMaxAttempts int
+	// MaxRetries is how many times a failed change, and in turn each of its
+	// failed retries, may be retried through POST /change/:id/retry
+	MaxRetries int
+	// WorkerPoolSize is how many workers process changes concurrently
+	WorkerPoolSize int
+	// RepoConcurrency is how many repositories of a parallel change the
+	// agent runs in at once
+	RepoConcurrency int
+	// WorkspaceDir is the directory agent workspaces are created under
+	WorkspaceDir string
+	// WorkspaceMaxGB is the disk budget for workspaces before the least
+	// recently used ones are evicted
+	WorkspaceMaxGB int
+	// RateLimitRPM is the sustained number of change submissions per minute
+	// allowed from a single client IP
+	RateLimitRPM int
+	// RateLimitBurst is how many requests a client IP may make in a burst
+	// before being limited to RateLimitRPM
+	RateLimitBurst int
+	// ErrorHelpBaseURL is the documentation base URL error codes are appended
+	// to for ErrorResponse.HelpURL; no links are added when it is empty
+	ErrorHelpBaseURL string
+	// APIKeys are the bearer tokens accepted by ginAuth; authentication is
+	// disabled when it is empty
+	APIKeys []string `config:"secret"`
+	// ResultCacheTTL is how long the result of a completed change is reused
+	// for identical specs; 0 disables the cache
+	ResultCacheTTL time.Duration
+	// PKCS11ModulePath is the PKCS#11 library used to sign commits with
+	// hardware keys; pkcs11 signing is rejected when it is empty
+	PKCS11ModulePath string
+	// ValidAgents are the values accepted for spec.agent
+	ValidAgents []string
+	// AgentRequiredOptions maps agents to the spec.options keys changes
+	// using them must set
+	AgentRequiredOptions map[string][]string
+	// AgentTimeouts and AgentMaxConcurrency hold the AgentConfig.Timeout and
+	// AgentConfig.MaxConcurrency of the agents that set them
+	AgentTimeouts       map[string]time.Duration
+	AgentMaxConcurrency map[string]int
+	// AdminToken guards admin endpoints such as batch updates; they are
+	// disabled when it is empty
+	AdminToken string `config:"secret"`
+	// ChangeCategories are the values accepted for spec.changeCategory in
+	// addition to "uncategorized"
+	ChangeCategories []string
+	// OTLPEndpoint is the OTLP/HTTP endpoint traces are exported to; traces
+	// are not exported when it is empty
+	OTLPEndpoint string `config:"secret"`
+	// EnableHotfixBypass allows changes to be submitted as hotfixes
+	EnableHotfixBypass bool
+	// MaxBodyBytes caps the size of request bodies
+	MaxBodyBytes int64
+	// GzipLevel is the compression level of gzipped responses, from 1
+	// (fastest) to 9 (smallest)
+	GzipLevel int
+	// TLSCertFile and TLSKeyFile are the certificate and private key the
+	// server uses for HTTPS; the server listens on plain HTTP when both are
+	// empty
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSMinVersion is the oldest TLS version accepted, such as "Tls12"
+	TLSMinVersion string
+	// CORSAllowedOrigins are the origins browsers may call the API from; "*"
+	// allows any origin
+	CORSAllowedOrigins []string
+	// WebhookTimeout bounds each webhook delivery attempt
+	WebhookTimeout time.Duration
+	// WebhookURL is notified of every accepted change; no notifications are
+	// sent when it is empty
+	WebhookURL string `config:"secret"`
+	// MaxBatchSize is the most changes a batch submission may hold
+	MaxBatchSize int
+	// RequestTimeout bounds how long an API request may take before it is
+	// answered with a 503; 0 disables the limit
+	RequestTimeout time.Duration
+	// SchedulerInterval is how often scheduled changes are checked for ones
+	// that have fallen due
+	SchedulerInterval time.Duration
+	// IdempotencyTTL is how long the response to a request carrying an
+	// Idempotency-Key is replayed for retries with the same key
+	IdempotencyTTL time.Duration
+	// DedupWindow is how long after a change is submitted another change
+	// with the same spec is rejected as a duplicate while the first is
+	// unfinished; 0 disables duplicate detection
+	DedupWindow time.Duration
+}
+
+var config Config
+
+// loadConfig builds a Config from the config file and environment variables,
+// falling back to defaults for anything unset or invalid
+func loadConfig() Config {
+	cfg := Config{
+		Port:               envString("PORT", defaultPort),
+		BindAddress:        setting("BIND_ADDRESS"),
+		LogFormat:          setting("LOG_FORMAT"),
+		LogLevel:           setting("LOG_LEVEL"),
+		MaxPromptLength:    envInt("MAX_PROMPT_LENGTH", defaultMaxPromptLength),
+		MaxRepos:           envInt("MAX_REPOS", defaultMaxRepos),
+		ReadinessCacheTTL:  envDuration("READINESS_CACHE_TTL", defaultReadinessCacheTTL),
+		DefaultNamespace:   envString("DEFAULT_NAMESPACE", defaultNamespace),
+		DefaultBranch:      envString("DEFAULT_BRANCH", defaultBranch),
+		ReuseTerminalNames: envBool("REUSE_TERMINAL_NAMES", true),
+		ShutdownTimeout:    time.Duration(envInt("SHUTDOWN_TIMEOUT_SECONDS", int(defaultShutdownTimeout/time.Second))) * time.Second,
+		DBPath:             setting("DB_PATH"),
+		DatabaseURL:        setting("DATABASE_URL"),
+		AgentMaxAttempts:   envInt("AGENT_MAX_ATTEMPTS", defaultAgentMaxAttempts),
+		MaxRetries:         envInt("MAX_RETRIES", defaultMaxRetries),
+		RepoConcurrency:    envInt("REPO_CONCURRENCY", defaultRepoConcurrency),
+		WorkspaceDir:       envString("WORKSPACE_DIR", filepath.Join(os.TempDir(), "demo-app-workspaces")),
+		WorkspaceMaxGB:     envInt("WORKSPACE_MAX_GB", defaultWorkspaceMaxGB),
+		RateLimitRPM:       envInt("RATE_LIMIT_RPM", defaultRateLimitRPM),
+		RateLimitBurst:     envInt("RATE_LIMIT_BURST", defaultRateLimitBurst),
+		ErrorHelpBaseURL:   setting("ERROR_HELP_BASE_URL"),
+		APIKeys:            envList("API_KEYS"),
+		ResultCacheTTL:     envDuration("RESULT_CACHE_TTL", defaultResultCacheTTL),
+		PKCS11ModulePath:   setting("PKCS11_MODULE_PATH"),
+		ValidAgents:        envList("VALID_AGENTS"),
+		AdminToken:         setting("ADMIN_TOKEN"),
+		ChangeCategories:   envList("CHANGE_CATEGORIES"),
+		OTLPEndpoint:       setting("OTEL_EXPORTER_OTLP_ENDPOINT"),
+		EnableHotfixBypass: envBool("ENABLE_HOTFIX_BYPASS", false),
+		MaxBodyBytes:       int64(envInt("MAX_REQUEST_BODY_BYTES", defaultMaxBodyBytes)),
+		GzipLevel:          envInt("GZIP_LEVEL", defaultGzipLevel),
+		TLSCertFile:        setting("TLS_CERT_FILE"),
+		TLSKeyFile:         setting("TLS_KEY_FILE"),
+		TLSMinVersion:      envString("TLS_MIN_VERSION", defaultTLSMinVersion),
+		CORSAllowedOrigins: envList("CORS_ALLOWED_ORIGINS"),
+		WebhookTimeout:     time.Duration(envInt("WEBHOOK_TIMEOUT_SECONDS", int(defaultWebhookTimeout/time.Second))) * time.Second,
+		WebhookURL:         setting("WEBHOOK_URL"),
+		MaxBatchSize:       envInt("MAX_BATCH_SIZE", defaultMaxBatchSize),
+		RequestTimeout:     envDuration("REQUEST_TIMEOUT", defaultRequestTimeout),
+		SchedulerInterval:  time.Duration(envInt("SCHEDULER_INTERVAL_SECONDS", int(defaultSchedulerInterval/time.Second))) * time.Second,
+		IdempotencyTTL:     envDuration("IDEMPOTENCY_TTL", defaultIdempotencyTTL),
+		DedupWindow:        time.Duration(envNonNegativeInt("DEDUP_WINDOW_SECONDS", int(defaultDedupWindow/time.Second))) * time.Second,
+	}
+
+	// WORKER_POOL_SIZE is checked at startup rather than falling back to the
+	// default, so a mistyped size stops the server; unparsable values become
+	// 0 and fail that check.
+	cfg.WorkerPoolSize = defaultWorkerPoolSize
+	if value := setting("WORKER_POOL_SIZE"); value != "" {
+		cfg.WorkerPoolSize, _ = strconv.Atoi(value)
+	}
+
+	if len(cfg.ValidAgents) == 0 {
+		cfg.ValidAgents = defaultAgents()
+	}
+	cfg.AgentRequiredOptions = parseAgentRequiredOptions(envList("AGENT_REQUIRED_OPTIONS"))
+	cfg.AgentTimeouts = parseAgentTimeouts(envList("AGENT_TIMEOUTS"))
+	cfg.AgentMaxConcurrency = parseAgentMaxConcurrency(envList("AGENT_MAX_CONCURRENCY"))
+
+	if len(cfg.CORSAllowedOrigins) == 0 {
+		cfg.CORSAllowedOrigins = []string{"*"}
+	}
+
+	if cfg.GzipLevel != defaultGzipLevel && cfg.GzipLevel > gzip.BestCompression {
+		logger.Warn("Invalid GZIP_LEVEL, using default", "value", cfg.GzipLevel)
+		cfg.GzipLevel = defaultGzipLevel
+	}
+
+	if u, err := url.Parse(cfg.WebhookURL); cfg.WebhookURL != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+		logger.Warn("Invalid WEBHOOK_URL, acceptance notifications disabled", "value", cfg.WebhookURL)
+		cfg.WebhookURL = ""
+	}
+
+	// Every change without spec.branch would otherwise be rejected
+	if validateBranchName(cfg.DefaultBranch) != nil {
+		cfg.DefaultBranch = defaultBranch
+	}
+
+	return cfg
+}
+
+// fileSettings holds the settings read from the config file, keyed by the
+// names of the environment variables that override them
+var fileSettings map[string]string
+
+// loadConfigFile reads settings from the YAML file at path: a mapping from
+// setting names, the same as their environment variables, to scalar values
+// or, for list settings, sequences of them. A missing file yields no settings
+// unless required is set.
+func loadConfigFile(path string, required bool) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	settings := make(map[string]string, len(doc))
+	for key, value := range doc {
+		switch v := value.(type) {
+		case nil:
+		case []interface{}:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				if _, ok := item.(map[string]interface{}); ok {
+					return nil, fmt.Errorf("%s: %s must be a scalar or a list of scalars", path, key)
+				}
+				items = append(items, fmt.Sprint(item))
+			}
+			settings[key] = strings.Join(items, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("%s: %s must be a scalar or a list of scalars", path, key)
+		default:
+			settings[key] = fmt.Sprint(v)
+		}
+	}
+	return settings, nil
+}
+
+// setting returns the value of the setting key: its environment variable
+// when set, otherwise its value in the config file
+func setting(key string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fileSettings[key]
+}
+
+// envString reads the setting key, returning def when it is unset or empty
+func envString(key, def string) string {
+	if value := setting(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// envList reads a comma-separated list from the setting key,
+// trimming whitespace and dropping empty entries
+func envList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(setting(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// envBool reads a boolean such as "true" or "0" from the setting key,
+// returning def when it is unset or invalid
+func envBool(key string, def bool) bool {
+	value := setting(key)
+	if value == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Warn("Invalid boolean setting, using default",
+			"key", key,
+			"value", value,
+			"default", def,
+		)
+		return def
+	}
+
+	return b
+}
+
+// envInt reads a positive integer from the setting key, returning def when
+// it is unset or invalid
+func envInt(key string, def int) int {
+	value := setting(key)
+	if value == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		logger.Warn("Invalid integer setting, using default",
+			"key", key,
+			"value", value,
+			"default", def,
+		)
+		return def
+	}
+
+	return n
+}
+
+// envNonNegativeInt reads an integer of 0 or more from the setting key, for
+// settings where 0 turns a feature off, returning def when it is unset or
+// invalid
+func envNonNegativeInt(key string, def int) int {
+	value := strings.TrimSpace(setting(key))
+	if value == "" {
+		return def
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		logger.Warn("Invalid integer setting, using default",
+			"key", key,
+			"value", value,
+			"default", def,
+		)
+		return def
+	}
+
+	return n
+}
+
+// envDuration reads a non-negative duration such as "5s" from the setting
+// key, returning def when it is unset or invalid
+func envDuration(key string, def time.Duration) time.Duration {
+	value := setting(key)
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		logger.Warn("Invalid duration setting, using default",
+			"key", key,
+			"value", value,
+			"default", def.String(),
+		)
+		return def
+	}
+
+	return d
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	t.Setenv("MAX_PROMPT_LENGTH", "")
+	t.Setenv("MAX_REPOS", "")
+
+	cfg := loadConfig()
+	if cfg.MaxPromptLength != defaultMaxPromptLength {
+		t.Errorf("Expected MaxPromptLength %d, got %d", defaultMaxPromptLength, cfg.MaxPromptLength)
+	}
+	if cfg.MaxRepos != 50 {
+		t.Errorf("Expected MaxRepos 50, got %d", cfg.MaxRepos)
+	}
+}
+
+func TestLoadConfigValidAgentsDefault(t *testing.T) {
+	t.Setenv("VALID_AGENTS", "")
+
+	cfg := loadConfig()
+	want := []string{"claude-cli", "copilot-cli", "gemini-cli"}
+	if strings.Join(cfg.ValidAgents, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected ValidAgents %v, got %v", want, cfg.ValidAgents)
+	}
+}
+
+func TestLoadConfigCORSAllowedOrigins(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "")
+	if cfg := loadConfig(); strings.Join(cfg.CORSAllowedOrigins, ",") != "*" {
+		t.Errorf("Expected CORSAllowedOrigins [*], got %v", cfg.CORSAllowedOrigins)
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	want := []string{"https://a.example.com", "https://b.example.com"}
+	if cfg := loadConfig(); strings.Join(cfg.CORSAllowedOrigins, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected CORSAllowedOrigins %v, got %v", want, cfg.CORSAllowedOrigins)
+	}
+}
+
+func TestLoadConfigDefaultBranch(t *testing.T) {
+	t.Setenv("DEFAULT_BRANCH", "")
+	if cfg := loadConfig(); cfg.DefaultBranch != "main" {
+		t.Errorf("Expected DefaultBranch 'main', got '%s'", cfg.DefaultBranch)
+	}
+
+	t.Setenv("DEFAULT_BRANCH", "trunk")
+	cfg := loadConfig()
+	if cfg.DefaultBranch != "trunk" {
+		t.Fatalf("Expected DefaultBranch 'trunk', got '%s'", cfg.DefaultBranch)
+	}
+
+	setConfig(t, cfg)
+	change := Change{}
+	applyChangeDefaults(&change)
+	if change.Spec.Branch != "trunk" {
+		t.Errorf("Expected an empty spec.branch to default to 'trunk', got '%s'", change.Spec.Branch)
+	}
+
+	t.Setenv("DEFAULT_BRANCH", "bad..branch")
+	if cfg := loadConfig(); cfg.DefaultBranch != "main" {
+		t.Errorf("Expected an invalid DEFAULT_BRANCH to fall back to 'main', got '%s'", cfg.DefaultBranch)
+	}
+}
+
+func TestLoadConfigWebhookURL(t *testing.T) {
+	t.Setenv("WEBHOOK_URL", "https://hooks.example.com/changes")
+	if cfg := loadConfig(); cfg.WebhookURL != "https://hooks.example.com/changes" {
+		t.Errorf("Expected WebhookURL to be set, got '%s'", cfg.WebhookURL)
+	}
+
+	t.Setenv("WEBHOOK_URL", "hooks.example.com")
+	if cfg := loadConfig(); cfg.WebhookURL != "" {
+		t.Errorf("Expected an invalid WEBHOOK_URL to be ignored, got '%s'", cfg.WebhookURL)
+	}
+}
+
+func TestLoadConfigDedupWindow(t *testing.T) {
+	if got := loadConfig().DedupWindow; got != defaultDedupWindow {
+		t.Errorf("Expected DedupWindow %s, got %s", defaultDedupWindow, got)
+	}
+
+	for _, value := range []string{"0", "00", " 0"} {
+		t.Setenv("DEDUP_WINDOW_SECONDS", value)
+		if got := loadConfig().DedupWindow; got != 0 {
+			t.Errorf("Expected DEDUP_WINDOW_SECONDS=%q to disable duplicate detection, got %s", value, got)
+		}
+	}
+
+	t.Setenv("DEDUP_WINDOW_SECONDS", "-5")
+	if got := loadConfig().DedupWindow; got != defaultDedupWindow {
+		t.Errorf("Expected a negative DEDUP_WINDOW_SECONDS to fall back to %s, got %s", defaultDedupWindow, got)
+	}
+}
+
+func TestLoadConfigWorkerPoolSize(t *testing.T) {
+	tests := []struct {
+		name      string
+		poolSize  string
+		want      int
+		wantValid bool
+	}{
+		{"default", "", defaultWorkerPoolSize, true},
+		{"pool size", "8", 8, true},
+		{"maximum", "32", 32, true},
+		{"too large", "33", 33, false},
+		{"zero", "0", 0, false},
+		{"not a number", "four", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("WORKER_POOL_SIZE", tt.poolSize)
+
+			cfg := loadConfig()
+			if cfg.WorkerPoolSize != tt.want {
+				t.Errorf("Expected WorkerPoolSize %d, got %d", tt.want, cfg.WorkerPoolSize)
+			}
+			if err := validateWorkerPoolSize(cfg.WorkerPoolSize); (err == nil) != tt.wantValid {
+				t.Errorf("Expected valid %v, got error %v", tt.wantValid, err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+MAX_PROMPT_LENGTH: 2048
+DEFAULT_BRANCH: trunk
+REQUEST_TIMEOUT: 5s
+ENABLE_HOTFIX_BYPASS: true
+VALID_AGENTS:
+  - copilot-cli
+  - in-house-agent
+OTEL_EXPORTER_OTLP_ENDPOINT:
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	settings, err := loadConfigFile(path, true)
+	if err != nil {
+		t.Fatalf("Failed to load config file: %v", err)
+	}
+	setFileSettings(t, settings)
+
+	// The environment overrides the file
+	t.Setenv("MAX_PROMPT_LENGTH", "")
+	t.Setenv("DEFAULT_BRANCH", "develop")
+	t.Setenv("VALID_AGENTS", "")
+
+	cfg := loadConfig()
+	if cfg.MaxPromptLength != 2048 {
+		t.Errorf("Expected MaxPromptLength 2048 from the file, got %d", cfg.MaxPromptLength)
+	}
+	if cfg.DefaultBranch != "develop" {
+		t.Errorf("Expected DEFAULT_BRANCH from the environment to win, got '%s'", cfg.DefaultBranch)
+	}
+	if cfg.RequestTimeout != 5*time.Second || !cfg.EnableHotfixBypass {
+		t.Errorf("Expected RequestTimeout 5s and EnableHotfixBypass, got %s and %v", cfg.RequestTimeout, cfg.EnableHotfixBypass)
+	}
+	if want := []string{"copilot-cli", "in-house-agent"}; strings.Join(cfg.ValidAgents, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected ValidAgents %v, got %v", want, cfg.ValidAgents)
+	}
+	if cfg.OTLPEndpoint != "" {
+		t.Errorf("Expected an empty setting to stay unset, got '%s'", cfg.OTLPEndpoint)
+	}
+}
+
+func TestLoadConfigFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	missing := filepath.Join(dir, "missing.yaml")
+	if settings, err := loadConfigFile(missing, false); err != nil || settings != nil {
+		t.Errorf("Expected an optional missing file to yield no settings, got %v, %v", settings, err)
+	}
+	if _, err := loadConfigFile(missing, true); err == nil {
+		t.Error("Expected a required missing file to be an error")
+	}
+
+	for name, data := range map[string]string{
+		"invalid.yaml": "MAX_REPOS: [unclosed",
+		"nested.yaml":  "TLS:\n  CERT_FILE: cert.pem\n",
+		"list.yaml":    "- MAX_REPOS\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("Failed to write config file: %v", err)
+		}
+		if _, err := loadConfigFile(path, true); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadConfigInvalidValueFallsBack(t *testing.T) {
+	t.Setenv("MAX_PROMPT_LENGTH", "not-a-number")
+
+	cfg := loadConfig()
+	if cfg.MaxPromptLength != defaultMaxPromptLength {
+		t.Errorf("Expected MaxPromptLength %d, got %d", defaultMaxPromptLength, cfg.MaxPromptLength)
+	}
+}
+
+// setFileSettings replaces the settings read from the config file for the
+// duration of a test
+func setFileSettings(t *testing.T, settings map[string]string) {
+	t.Helper()
+
+	previous := fileSettings
+	fileSettings = settings
+	t.Cleanup(func() { fileSettings = previous })
+}
+
+// setConfig replaces the package config, and agentRegistry with its agents,
+// for the duration of a test
+func setConfig(t *testing.T, cfg Config) {
+	t.Helper()
+
+	previous, previousAgents := config, agentRegistry
+	config, agentRegistry = cfg, loadAgentRegistry(cfg)
+	t.Cleanup(func() { config, agentRegistry = previous, previousAgents })
+}
+
+func TestShutdownTimeoutSeconds(t *testing.T) {
+	if got := loadConfig().ShutdownTimeout; got != 30*time.Second {
+		t.Errorf("Expected a default shutdown timeout of 30s, got %s", got)
+	}
+
+	t.Setenv("SHUTDOWN_TIMEOUT_SECONDS", "45")
+	if got := loadConfig().ShutdownTimeout; got != 45*time.Second {
+		t.Errorf("Expected SHUTDOWN_TIMEOUT_SECONDS to set the timeout, got %s", got)
+	}
+}
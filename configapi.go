@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+)
+
+// redacted replaces the values of secret settings in GET /config
+const redacted = "<redacted>"
+
+// sanitizedConfig returns cfg as a JSON-friendly map keyed by camelCase field
+// name. Durations are written like "30s", and fields tagged config:"secret"
+// are replaced with redacted when they are set.
+func sanitizedConfig(cfg Config) map[string]interface{} {
+	v := reflect.ValueOf(cfg)
+	t := v.Type()
+
+	out := make(map[string]interface{}, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		name := lowerCamel(field.Name)
+		switch {
+		case field.Tag.Get("config") == "secret":
+			if value.IsZero() {
+				out[name] = value.Interface()
+			} else {
+				out[name] = redacted
+			}
+		case field.Type == reflect.TypeOf(time.Duration(0)):
+			out[name] = time.Duration(value.Int()).String()
+		default:
+			out[name] = value.Interface()
+		}
+	}
+	return out
+}
+
+// lowerCamel lower-cases the leading initialism or word of a Go identifier,
+// such as "APIKeys" to "apiKeys" and "MaxRepos" to "maxRepos"
+func lowerCamel(name string) string {
+	runes := []rune(name)
+	for i := range runes {
+		if !unicode.IsUpper(runes[i]) {
+			break
+		}
+		// The last capital of an initialism starts the next word
+		if i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1]) {
+			break
+		}
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+// handleConfig handles requests for the active configuration, with secrets
+// redacted
+func handleConfig(c *gin.Context) {
+	c.JSON(http.StatusOK, sanitizedConfig(config))
+}
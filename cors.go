@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS response headers advertised to browsers
+var (
+	corsAllowedMethods = strings.Join([]string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodOptions}, ", ")
+	corsAllowedHeaders = strings.Join([]string{"Authorization", "Content-Type", requestIDHeader, adminTokenHeader, hotfixReasonHeader, idempotencyKeyHeader}, ", ")
+	corsExposedHeaders = strings.Join([]string{requestIDHeader, idempotencyReplayedHeader, "Retry-After"}, ", ")
+)
+
+// corsMiddleware is a middleware that lets browsers on allowedOrigins call
+// the API. An origin of "*" allows every origin. Preflight OPTIONS requests
+// are answered with 204 directly, so they never reach authentication or the
+// routes themselves.
+func corsMiddleware(allowedOrigins []string) gin.HandlerFunc {
+	allowAll := false
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		if origin == "*" {
+			allowAll = true
+		}
+		allowed[origin] = true
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		switch {
+		case allowAll:
+			c.Header("Access-Control-Allow-Origin", "*")
+		case allowed[origin]:
+			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Vary", "Origin")
+		default:
+			// Without the CORS headers the browser blocks the response
+			if c.Request.Method == http.MethodOptions {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+		c.Header("Access-Control-Allow-Methods", corsAllowedMethods)
+		c.Header("Access-Control-Allow-Headers", corsAllowedHeaders)
+		c.Header("Access-Control-Expose-Headers", corsExposedHeaders)
+
+		if c.Request.Method == http.MethodOptions {
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		allowed    []string
+		method     string
+		origin     string
+		wantStatus int
+		wantOrigin string
+	}{
+		{"wildcard", []string{"*"}, "GET", "https://app.example.com", http.StatusOK, "*"},
+		{"listed origin", []string{"https://app.example.com"}, "GET", "https://app.example.com", http.StatusOK, "https://app.example.com"},
+		{"unlisted origin", []string{"https://app.example.com"}, "GET", "https://evil.example.com", http.StatusOK, ""},
+		{"no origin", []string{"*"}, "GET", "", http.StatusOK, ""},
+		{"preflight", []string{"https://app.example.com"}, "OPTIONS", "https://app.example.com", http.StatusNoContent, "https://app.example.com"},
+		{"preflight unlisted origin", []string{"https://app.example.com"}, "OPTIONS", "https://evil.example.com", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.Use(corsMiddleware(tt.allowed))
+			router.GET("/stats", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+			req := httptest.NewRequest(tt.method, "/stats", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Expected Access-Control-Allow-Origin '%s', got '%s'", tt.wantOrigin, got)
+			}
+			if tt.wantOrigin != "" && w.Header().Get("Access-Control-Allow-Methods") == "" {
+				t.Error("Expected Access-Control-Allow-Methods to be set")
+			}
+		})
+	}
+}
+
+func TestCORSPreflightSkipsAuthentication(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config
+	cfg.APIKeys = []string{"alpha"}
+	cfg.CORSAllowedOrigins = []string{"https://app.example.com"}
+	setConfig(t, cfg)
+
+	router := newRouter()
+
+	req := httptest.NewRequest("OPTIONS", "/change", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Headers"); got == "" {
+		t.Error("Expected Access-Control-Allow-Headers to be set")
+	}
+	if got := w.Header().Get("Access-Control-Allow-Methods"); !strings.Contains(got, "PUT") {
+		t.Errorf("Expected PUT to be an allowed method, got '%s'", got)
+	}
+	if got := w.Header().Get("Access-Control-Expose-Headers"); !strings.Contains(got, "Retry-After") {
+		t.Errorf("Expected Retry-After to be exposed, got '%s'", got)
+	}
+}
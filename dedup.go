@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// dedupMu serialises each submission's findDuplicate with the Save of its
+// job, see createJob
+var dedupMu sync.Mutex
+
+// findDuplicate returns the earliest job with the given content hash created
+// within config.DedupWindow before now that hasn't finished, reporting
+// whether there is one. Finished jobs don't count, so a resubmission gets
+// the cached result or a fresh run instead. A DedupWindow of 0 disables the
+// check.
+func findDuplicate(hash string, now time.Time) (Job, bool, error) {
+	if config.DedupWindow == 0 {
+		return Job{}, false, nil
+	}
+
+	filter := JobFilter{
+		ContentHash:  hash,
+		CreatedAfter: now.Add(-config.DedupWindow),
+	}
+	_, total, err := store.List(0, 0, filter)
+	if err != nil || total == 0 {
+		return Job{}, false, err
+	}
+	jobs, _, err := store.List(0, total, filter)
+	if err != nil {
+		return Job{}, false, err
+	}
+	for _, job := range jobs {
+		if !isTerminal(job.Status) {
+			return job, true, nil
+		}
+	}
+	return Job{}, false, nil
+}
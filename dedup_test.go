@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestContentHashIsCanonical(t *testing.T) {
+	a := ChangeSpec{Prompt: "Bump deps", Agent: "copilot-cli", Labels: map[string]string{"team": "infra", "env": "prod"}}
+	b := ChangeSpec{Prompt: "Bump deps", Agent: "copilot-cli", Labels: map[string]string{"env": "prod", "team": "infra"}}
+	if contentHash(a) != contentHash(b) {
+		t.Error("Expected specs differing only in key order to share a hash")
+	}
+
+	b.Prompt = "Bump other deps"
+	if contentHash(a) == contentHash(b) {
+		t.Error("Expected different specs to have different hashes")
+	}
+}
+
+func TestChangeEndpointRejectsDuplicates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	cfg := config
+	cfg.DedupWindow = time.Minute
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	w := postJSON(router, "/change", validTestChange())
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var first struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &first); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	// The same spec under a different name is still a duplicate
+	duplicate := validTestChange()
+	duplicate.Metadata = &ObjectMeta{Name: "retry"}
+	w = postJSON(router, "/change", duplicate)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409, got %d: %s", w.Code, w.Body.String())
+	}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("Failed to unmarshal error: %v", err)
+	}
+	if errResp.Error != "duplicate_change" || errResp.ExistingJobID != first.ID {
+		t.Errorf("Expected duplicate_change of %s, got %+v", first.ID, errResp)
+	}
+
+	different := validTestChange()
+	different.Spec.Prompt = "Something else entirely"
+	if w := postJSON(router, "/change", different); w.Code != http.StatusAccepted {
+		t.Errorf("Expected a different spec to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Once the first change has finished, a resubmission isn't a duplicate
+	if err := store.Update(first.ID, func(job *Job) { job.Status = statusFailed }); err != nil {
+		t.Fatalf("Failed to fail change: %v", err)
+	}
+	if w := postJSON(router, "/change", duplicate); w.Code != http.StatusAccepted {
+		t.Errorf("Expected a resubmission of a finished change to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Once the window has passed the spec may be submitted again
+	cfg.DedupWindow = time.Nanosecond
+	setConfig(t, cfg)
+	time.Sleep(time.Millisecond)
+	if w := postJSON(router, "/change", validTestChange()); w.Code != http.StatusAccepted {
+		t.Errorf("Expected a resubmission after the window to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestChangeEndpointRejectsConcurrentDuplicates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	cfg := config
+	cfg.DedupWindow = time.Minute
+	setConfig(t, cfg)
+	slowListing(t)
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	const submissions = 10
+	codes := make(chan int, submissions)
+	var wg sync.WaitGroup
+	for i := 0; i < submissions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- postJSON(router, "/change", validTestChange()).Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	accepted := 0
+	for code := range codes {
+		if code == http.StatusAccepted {
+			accepted++
+		} else if code != http.StatusConflict {
+			t.Errorf("Expected status 202 or 409, got %d", code)
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("Expected exactly 1 of %d identical submissions to be accepted, got %d", submissions, accepted)
+	}
+}
+
+func TestStoreListFiltersByContentHash(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		base := time.Now().UTC()
+		jobs := []Job{
+			{ID: "old", Status: statusDone, CreatedAt: base.Add(-2 * time.Minute), ContentHash: "abc"},
+			{ID: "recent", Status: statusPending, CreatedAt: base.Add(-10 * time.Second), ContentHash: "abc"},
+			{ID: "other", Status: statusPending, CreatedAt: base.Add(-5 * time.Second), ContentHash: "def"},
+		}
+		for _, job := range jobs {
+			if err := s.Save(job); err != nil {
+				t.Fatalf("Failed to save %s: %v", job.ID, err)
+			}
+		}
+
+		page, total, err := s.List(0, 10, JobFilter{ContentHash: "abc", CreatedAfter: base.Add(-time.Minute)})
+		if err != nil {
+			t.Fatalf("List failed: %v", err)
+		}
+		if total != 1 || len(page) != 1 || page[0].ID != "recent" {
+			t.Errorf("Expected only 'recent', got %d: %+v", total, page)
+		}
+	})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Values of spec.execution, which decides how a change spanning several
+// repositories runs through them
+const (
+	executionParallel   = "parallel"
+	executionSequential = "sequential"
+)
+
+// Outcomes recorded for each repository in Job.RepoResults. Repositories
+// are pending until the agent starts in them and running until it finishes.
+const (
+	repoStatusPending = "pending"
+	repoStatusRunning = "running"
+	repoStatusDone    = "done"
+	repoStatusFailed  = "failed"
+	repoStatusSkipped = "skipped"
+)
+
+// RepoResult is the outcome of a change in one of its repositories
+type RepoResult struct {
+	Repo   string `json:"repo"`
+	Status string `json:"status"`
+	// Error and Message describe why the repository failed
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+	// CommitSHA and PRURL are the commit and pull request the agent
+	// produced in the repository, when it reported them
+	CommitSHA  string     `json:"commitSHA,omitempty"`
+	PRURL      string     `json:"prURL,omitempty"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// repoProgress tracks a job's RepoResults while runRepos works through its
+// repositories, saving them to the store as each repository starts and
+// finishes so GET /change/:id shows progress before the change completes
+type repoProgress struct {
+	mu      sync.Mutex
+	jobID   string
+	results []RepoResult
+}
+
+// update applies fn to the result for repository i and saves the results.
+// A failure to save is logged rather than returned, since the final update
+// in processJob records them again.
+func (p *repoProgress) update(i int, fn func(r *RepoResult)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fn(&p.results[i])
+	results := append([]RepoResult(nil), p.results...)
+	if err := store.Update(p.jobID, func(job *Job) { job.RepoResults = results }); err != nil {
+		logger.Warn("Failed to record repository progress", "id", p.jobID, "repo", p.results[i].Repo, "error", err)
+	}
+}
+
+// snapshot returns a copy of the results
+func (p *repoProgress) snapshot() []RepoResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]RepoResult(nil), p.results...)
+}
+
+// validateExecution checks spec.execution, returning nil when it is valid.
+// Defaults are expected to have been applied, so it must be set.
+func validateExecution(execution string) *ErrorResponse {
+	if execution != executionParallel && execution != executionSequential {
+		return &ErrorResponse{
+			Error:   "invalid_execution",
+			Message: fmt.Sprintf("spec.execution %q is not supported, must be 'parallel' or 'sequential'", execution),
+		}
+	}
+	return nil
+}
+
+// runRepos runs job through its agent once per repository in spec.repos,
+// returning their combined result and the outcome in each repository. In
+// parallel mode up to config.RepoConcurrency repositories run at once; in
+// sequential mode they run in order, stopping at the first failure when
+// spec.failFast is set. The job's RepoResults are updated in the store as
+// each repository starts and finishes. Repositories that never ran, because
+// of failFast or because ctx ended first, are reported as skipped. The error
+// is that of the first failed repository.
+func runRepos(ctx context.Context, job Job) (ChangeResult, []RepoResult, error) {
+	repos := job.Change.Spec.Repos
+	if len(repos) == 0 {
+		result, err := runAttempts(ctx, job, job.ID)
+		return result, nil, err
+	}
+
+	progress := &repoProgress{jobID: job.ID, results: make([]RepoResult, len(repos))}
+	for i, repo := range repos {
+		progress.results[i] = RepoResult{Repo: repo.URL, Status: repoStatusPending}
+	}
+	results := make([]ChangeResult, len(repos))
+	errs := make([]error, len(repos))
+	run := func(i int) {
+		// Each repository gets its own workspaces, named after the job when
+		// there is only one
+		workspaceID := job.ID
+		if len(repos) > 1 {
+			workspaceID = fmt.Sprintf("%s-repo%d", job.ID, i)
+		}
+		repoJob := job
+		repoJob.Change.Spec.Repos = []RepoRef{repos[i]}
+		startedAt := time.Now().UTC()
+		progress.update(i, func(r *RepoResult) {
+			r.Status, r.StartedAt = repoStatusRunning, &startedAt
+		})
+		results[i], errs[i] = runAttempts(ctx, repoJob, workspaceID)
+		finishedAt := time.Now().UTC()
+		progress.update(i, func(r *RepoResult) {
+			r.Status, r.FinishedAt = repoStatusDone, &finishedAt
+			r.CommitSHA, r.PRURL = results[i].CommitSHA, results[i].PRURL
+			if errs[i] != nil {
+				r.Status = repoStatusFailed
+				r.Error, r.Message = errorCode(errs[i]), errs[i].Error()
+			}
+		})
+	}
+
+	if job.Change.Spec.Execution == executionSequential {
+		for i := range repos {
+			if ctx.Err() != nil {
+				break
+			}
+			run(i)
+			if errs[i] != nil && job.Change.Spec.FailFast {
+				break
+			}
+		}
+	} else {
+		slots := make(chan struct{}, config.RepoConcurrency)
+		var wg sync.WaitGroup
+		for i := range repos {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+				defer func() { <-slots }()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	var merged ChangeResult
+	var err error
+	outcomes := progress.snapshot()
+	for i, repo := range repos {
+		if outcomes[i].Status == repoStatusPending {
+			outcomes[i].Status = repoStatusSkipped
+		}
+		if errs[i] != nil && err == nil {
+			err = errs[i]
+			if len(repos) > 1 {
+				err = &codedError{Code: errorCode(errs[i]), Message: fmt.Sprintf("%s: %s", repo.URL, errs[i])}
+			}
+		}
+		merged = mergeResults(merged, results[i])
+	}
+	return merged, outcomes, err
+}
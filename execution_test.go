@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunReposParallel(t *testing.T) {
+	isolateJobs(t)
+	cfg := config
+	cfg.RepoConcurrency = 2
+	setConfig(t, cfg)
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+
+		repo := req.Spec.Repos[0].URL
+		if strings.HasSuffix(repo, "repo2") {
+			return ChangeResult{}, errors.New("tests failed")
+		}
+		return ChangeResult{Diff: "diff for " + repo}, nil
+	})
+
+	job := submitTestJob(t, ChangeSpec{
+		Agent: "copilot-cli",
+		Repos: repoRefs("https://github.com/myorg/repo1", "https://github.com/myorg/repo2", "https://github.com/myorg/repo3", "https://github.com/myorg/repo4"),
+	})
+	processJob(context.Background(), job.ID)
+
+	if peak != 2 {
+		t.Errorf("Expected at most 2 repos to run at once, got %d", peak)
+	}
+
+	got, _ := store.Get(job.ID)
+	if got.Status != statusFailed || got.Error != "agent_failed" || got.Message != "https://github.com/myorg/repo2: tests failed" {
+		t.Errorf("Expected the failed repo to fail the change, got '%s' '%s' %q", got.Status, got.Error, got.Message)
+	}
+	want := []string{repoStatusDone, repoStatusFailed, repoStatusDone, repoStatusDone}
+	if statuses := repoStatuses(got.RepoResults); !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Expected repo statuses %v, got %+v", want, got.RepoResults)
+	}
+	if r := got.RepoResults[1]; r.Repo != "https://github.com/myorg/repo2" || r.Error != "agent_failed" || r.Message != "tests failed" {
+		t.Errorf("Expected the repo2 failure to be recorded, got %+v", r)
+	}
+	if got.Result == nil || !strings.Contains(got.Result.Diff, "diff for https://github.com/myorg/repo4") {
+		t.Errorf("Expected the repos' diffs to be combined, got %+v", got.Result)
+	}
+}
+
+func TestRunReposSequential(t *testing.T) {
+	tests := []struct {
+		name     string
+		failFast bool
+		want     []string
+		wantRuns []string
+	}{
+		{"continues past failures", false, []string{repoStatusDone, repoStatusFailed, repoStatusDone}, []string{"repo1", "repo2", "repo3"}},
+		{"fail fast", true, []string{repoStatusDone, repoStatusFailed, repoStatusSkipped}, []string{"repo1", "repo2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateJobs(t)
+
+			var runs []string
+			setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+				repo := req.Spec.Repos[0].URL
+				runs = append(runs, repo[strings.LastIndex(repo, "/")+1:])
+				if strings.HasSuffix(repo, "repo2") {
+					return ChangeResult{}, &codedError{Code: "token_budget_exceeded", Message: "too many tokens"}
+				}
+				return ChangeResult{}, nil
+			})
+
+			job := submitTestJob(t, ChangeSpec{
+				Agent:     "copilot-cli",
+				Repos:     repoRefs("https://github.com/myorg/repo1", "https://github.com/myorg/repo2", "https://github.com/myorg/repo3"),
+				Execution: executionSequential,
+				FailFast:  tt.failFast,
+			})
+			processJob(context.Background(), job.ID)
+
+			if !reflect.DeepEqual(runs, tt.wantRuns) {
+				t.Errorf("Expected repos to run in order %v, got %v", tt.wantRuns, runs)
+			}
+			got, _ := store.Get(job.ID)
+			if got.Status != statusFailed || got.Error != "token_budget_exceeded" {
+				t.Errorf("Expected the change to fail with the repo's error code, got '%s' '%s'", got.Status, got.Error)
+			}
+			if statuses := repoStatuses(got.RepoResults); !reflect.DeepEqual(statuses, tt.want) {
+				t.Errorf("Expected repo statuses %v, got %+v", tt.want, got.RepoResults)
+			}
+		})
+	}
+}
+
+func TestRunReposSingleRepo(t *testing.T) {
+	isolateJobs(t)
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		return ChangeResult{}, errors.New("clone failed")
+	})
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli", Repos: repoRefs("https://github.com/myorg/repo1")})
+	processJob(context.Background(), job.ID)
+
+	// A single repository's error is reported unchanged, in a workspace
+	// named after the job
+	got, _ := store.Get(job.ID)
+	if got.Message != "clone failed" || !strings.HasPrefix(got.WorkspaceID, job.ID+"-") || strings.Contains(got.WorkspaceID, "repo") {
+		t.Errorf("Expected the unwrapped error and a job workspace, got %q in '%s'", got.Message, got.WorkspaceID)
+	}
+	if len(got.RepoResults) != 1 || got.RepoResults[0].StartedAt == nil || got.RepoResults[0].FinishedAt == nil {
+		t.Fatalf("Expected a timed result for the repo, got %+v", got.RepoResults)
+	}
+	got.RepoResults[0].StartedAt, got.RepoResults[0].FinishedAt = nil, nil
+	want := []RepoResult{{Repo: "https://github.com/myorg/repo1", Status: repoStatusFailed, Error: "agent_failed", Message: "clone failed"}}
+	if !reflect.DeepEqual(got.RepoResults, want) {
+		t.Errorf("Expected repo results %+v, got %+v", want, got.RepoResults)
+	}
+}
+
+func TestRunReposRecordsProgress(t *testing.T) {
+	isolateJobs(t)
+	release := make(chan struct{})
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		repo := req.Spec.Repos[0].URL
+		if strings.HasSuffix(repo, "repo2") {
+			<-release
+		}
+		return ChangeResult{CommitSHA: "sha-" + repo[len(repo)-5:], PRURL: repo + "/pull/1"}, nil
+	})
+
+	job := submitTestJob(t, ChangeSpec{
+		Agent:     "copilot-cli",
+		Execution: executionSequential,
+		Repos:     repoRefs("https://github.com/myorg/repo1", "https://github.com/myorg/repo2", "https://github.com/myorg/repo3"),
+	})
+	done := make(chan struct{})
+	go func() {
+		processJob(context.Background(), job.ID)
+		close(done)
+	}()
+
+	// While repo2 runs, repo1's outcome is already recorded
+	want := []string{repoStatusDone, repoStatusRunning, repoStatusPending}
+	deadline := time.Now().Add(time.Second)
+	var got Job
+	for {
+		got, _ = store.Get(job.ID)
+		if reflect.DeepEqual(repoStatuses(got.RepoResults), want) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if statuses := repoStatuses(got.RepoResults); !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("Expected repo statuses %v while running, got %+v", want, got.RepoResults)
+	}
+	if r := got.RepoResults[0]; r.CommitSHA != "sha-repo1" || r.PRURL != "https://github.com/myorg/repo1/pull/1" || r.FinishedAt == nil {
+		t.Errorf("Expected repo1's commit and pull request, got %+v", r)
+	}
+	if r := got.RepoResults[1]; r.StartedAt == nil || r.FinishedAt != nil {
+		t.Errorf("Expected repo2 to be started but not finished, got %+v", r)
+	}
+
+	close(release)
+	<-done
+	got, _ = store.Get(job.ID)
+	want = []string{repoStatusDone, repoStatusDone, repoStatusDone}
+	if statuses := repoStatuses(got.RepoResults); !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Expected repo statuses %v, got %+v", want, got.RepoResults)
+	}
+	// Commits and pull requests are reported per repository only
+	if got.Result.CommitSHA != "" || got.Result.PRURL != "" {
+		t.Errorf("Expected no commit or pull request in the merged result, got %+v", got.Result)
+	}
+}
+
+// repoStatuses returns the status of each repository in results
+func repoStatuses(results []RepoResult) []string {
+	statuses := make([]string, len(results))
+	for i, result := range results {
+		statuses[i] = result.Status
+	}
+	return statuses
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipEncoding is a middleware that decompresses gzip request bodies and
+// compresses responses of at least gzipMinSize bytes, at level, for clients
+// that accept gzip. Decompressed bodies are capped at limit bytes, like
+// bodyLimit caps compressed ones, so a small compressed body can't expand
+// without bound; exceeding it fails binding with an *http.MaxBytesError.
+func gzipEncoding(limit int64, level int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := requestLogger(c)
+
+		switch encoding := strings.ToLower(strings.TrimSpace(c.GetHeader("Content-Encoding"))); encoding {
+		case "", "identity":
+		case "gzip":
+			zr, err := gzip.NewReader(c.Request.Body)
+			if err != nil {
+				log.Warn("Invalid gzip request body", "error", err)
+				respondBindError(c, fmt.Errorf("invalid gzip body: %w", err))
+				c.Abort()
+				return
+			}
+			defer zr.Close()
+
+			c.Request.Body = http.MaxBytesReader(c.Writer, zr, limit)
+			c.Request.Header.Del("Content-Encoding")
+			c.Request.ContentLength = -1
+		default:
+			log.Warn("Unsupported content encoding", "contentEncoding", encoding)
+			respondError(c, http.StatusUnsupportedMediaType, ErrorResponse{
+				Error:   "unsupported_media_type",
+				Message: fmt.Sprintf("content encoding %q is not supported, use gzip", encoding),
+			})
+			c.Abort()
+			return
+		}
+
+		if !acceptsGzip(c.GetHeader("Accept-Encoding")) {
+			c.Next()
+			return
+		}
+
+		gw := &gzipWriter{ResponseWriter: c.Writer, level: level}
+		c.Writer = gw
+		defer func() {
+			gw.close()
+			c.Writer = gw.ResponseWriter
+		}()
+
+		c.Next()
+	}
+}
+
+// acceptsGzip reports whether an Accept-Encoding header value allows gzip
+func acceptsGzip(header string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		// gzip;q=0 explicitly refuses gzip
+		if name, value, ok := strings.Cut(params, "="); ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			return err == nil && q > 0
+		}
+		return true
+	}
+	return false
+}
+
+// gzipMinSize is the smallest response body worth compressing; smaller
+// bodies gain little and can even grow
+const gzipMinSize = 1024
+
+// gzipWriter compresses the response body once it reaches gzipMinSize. The
+// body is buffered until then, so smaller responses are sent as they are and
+// responses without a body, such as 204s, are left untouched.
+type gzipWriter struct {
+	gin.ResponseWriter
+
+	level   int
+	buf     bytes.Buffer
+	decided bool
+	zw      *gzip.Writer
+}
+
+// Write implements http.ResponseWriter
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.zw != nil {
+			return w.zw.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+
+	w.buf.Write(data)
+	if w.buf.Len() >= gzipMinSize {
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *gzipWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush implements http.Flusher. Flushing commits to the choice made so far,
+// so a body still under gzipMinSize is sent uncompressed.
+func (w *gzipWriter) Flush() {
+	if !w.decided && w.buf.Len() > 0 {
+		w.decide(false)
+	}
+	if w.zw != nil {
+		w.zw.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// decide sends the buffered body, compressed if compress is set and the
+// handler hasn't encoded the response itself
+func (w *gzipWriter) decide(compress bool) error {
+	w.decided = true
+	header := w.ResponseWriter.Header()
+	header.Add("Vary", "Accept-Encoding")
+	if compress && header.Get("Content-Encoding") == "" {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		zw, err := gzip.NewWriterLevel(w.ResponseWriter, w.level)
+		if err != nil {
+			return err
+		}
+		w.zw = zw
+		_, err = w.zw.Write(w.buf.Bytes())
+		return err
+	}
+	_, err := w.ResponseWriter.Write(w.buf.Bytes())
+	return err
+}
+
+// close sends any body still buffered and writes the end of the compressed
+// stream, if one was started
+func (w *gzipWriter) close() {
+	if !w.decided && w.buf.Len() > 0 {
+		w.decide(false)
+	}
+	if w.zw != nil {
+		w.zw.Close()
+	}
+}
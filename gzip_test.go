@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// gzipBytes compresses data
+func gzipBytes(t *testing.T, data []byte) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("Failed to compress body: %v", err)
+	}
+	zw.Close()
+	return &buf
+}
+
+func TestGzipEncoding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.Use(bodyLimit(1<<20), gzipEncoding(1<<20, gzip.DefaultCompression))
+	router.POST("/change", handleChange)
+
+	// The echoed change makes the response large enough to compress
+	change := validTestChange()
+	change.Spec.Prompt = strings.Repeat("Add retries to every HTTP client. ", 40)
+	body, _ := json.Marshal(change)
+	req := httptest.NewRequest("POST", "/change", gzipBytes(t, body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "gzip")
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d", w.Code)
+	}
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzip-encoded response, got headers %v", w.Header())
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding, got %q", w.Header().Get("Vary"))
+	}
+
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip response: %v", err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress response: %v", err)
+	}
+	var response struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(decoded, &response); err != nil {
+		t.Fatalf("Failed to parse response %q: %v", decoded, err)
+	}
+	if response.ID == "" || response.Status != statusPending {
+		t.Errorf("Unexpected response: %s", decoded)
+	}
+}
+
+func TestGzipEncodingPlainResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(gzipEncoding(1<<20, gzip.DefaultCompression))
+	router.GET("/stats", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	router.DELETE("/stats", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, accept := range []string{"", "deflate", "gzip;q=0"} {
+		req := httptest.NewRequest("GET", "/stats", nil)
+		req.Header.Set("Accept-Encoding", accept)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Header().Get("Content-Encoding") != "" || w.Body.String() != `{"ok":true}` {
+			t.Errorf("Accept-Encoding %q: expected a plain response, got %v %q", accept, w.Header(), w.Body.String())
+		}
+	}
+
+	req := httptest.NewRequest("DELETE", "/stats", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected an unencoded empty 204, got %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+
+	// Bodies under gzipMinSize aren't worth compressing
+	req = httptest.NewRequest("GET", "/stats", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Header().Get("Content-Encoding") != "" || w.Body.String() != `{"ok":true}` {
+		t.Errorf("Expected a small response to be sent plain, got %v %q", w.Header(), w.Body.String())
+	}
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Expected Vary: Accept-Encoding on a plain response, got %q", w.Header().Get("Vary"))
+	}
+}
+
+func TestGzipEncodingLevel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	payload := strings.Repeat("abcdefghij", gzipMinSize)
+	sizes := make(map[int]int)
+	for _, level := range []int{gzip.BestSpeed, gzip.BestCompression} {
+		router := gin.New()
+		router.Use(gzipEncoding(1<<20, level))
+		// Written in small pieces so the threshold is crossed mid-response
+		router.GET("/data", func(c *gin.Context) {
+			for i := 0; i < len(payload); i += 128 {
+				c.Writer.WriteString(payload[i : i+128])
+			}
+		})
+
+		req := httptest.NewRequest("GET", "/data", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Header().Get("Content-Encoding") != "gzip" {
+			t.Fatalf("level %d: expected a gzip-encoded response, got headers %v", level, w.Header())
+		}
+		sizes[level] = w.Body.Len()
+
+		zr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatalf("level %d: failed to open gzip response: %v", level, err)
+		}
+		if decoded, _ := io.ReadAll(zr); string(decoded) != payload {
+			t.Errorf("level %d: expected the payload back, got %d bytes", level, len(decoded))
+		}
+	}
+	if sizes[gzip.BestCompression] > sizes[gzip.BestSpeed] {
+		t.Errorf("Expected level 9 to compress at least as well as level 1, got %v", sizes)
+	}
+}
+
+func TestGzipLevelConfig(t *testing.T) {
+	t.Setenv("GZIP_LEVEL", "")
+	if got := loadConfig().GzipLevel; got != gzip.DefaultCompression {
+		t.Errorf("Expected the default compression level, got %d", got)
+	}
+
+	t.Setenv("GZIP_LEVEL", "9")
+	if got := loadConfig().GzipLevel; got != gzip.BestCompression {
+		t.Errorf("Expected GZIP_LEVEL to set the level, got %d", got)
+	}
+
+	t.Setenv("GZIP_LEVEL", "12")
+	if got := loadConfig().GzipLevel; got != gzip.DefaultCompression {
+		t.Errorf("Expected an invalid GZIP_LEVEL to fall back to the default, got %d", got)
+	}
+}
+
+func TestGzipEncodingErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.Use(bodyLimit(1<<20), gzipEncoding(1024, gzip.DefaultCompression))
+	router.POST("/change", handleChange)
+
+	// Well within the compressed limit, but far beyond the decompressed one
+	bomb := `{"kind":"Change","apiVersion":"v1","spec":{"prompt":"` + strings.Repeat("x", 1<<20) + `"}}`
+
+	tests := []struct {
+		name       string
+		encoding   string
+		body       io.Reader
+		wantStatus int
+		wantError  string
+	}{
+		{"decompression bomb", "gzip", gzipBytes(t, []byte(bomb)), http.StatusRequestEntityTooLarge, "payload_too_large"},
+		{"invalid gzip", "gzip", strings.NewReader("not gzip"), http.StatusBadRequest, "invalid_request"},
+		{"unsupported encoding", "br", strings.NewReader("{}"), http.StatusUnsupportedMediaType, "unsupported_media_type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/change", tt.body)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Content-Encoding", tt.encoding)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			var response ErrorResponse
+			json.Unmarshal(w.Body.Bytes(), &response)
+			if response.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got '%s'", tt.wantError, response.Error)
+			}
+		})
+	}
+}
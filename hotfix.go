@@ -0,0 +1,34 @@
+package main
+
+import "fmt"
+
+// hotfixReasonHeader carries the justification for a hotfix change
+const hotfixReasonHeader = "X-Hotfix-Reason"
+
+// minHotfixReasonLength is the shortest hotfix justification accepted, in
+// characters
+const minHotfixReasonLength = 20
+
+// validateHotfix checks that a change marked as a hotfix is allowed and
+// justified by reason, returning nil when it is valid or not a hotfix
+func validateHotfix(hotfix bool, reason string) *ErrorResponse {
+	if !hotfix {
+		return nil
+	}
+
+	if !config.EnableHotfixBypass {
+		return &ErrorResponse{
+			Error:   "hotfix_bypass_disabled",
+			Message: "spec.changeHotfix requires the server to be configured with ENABLE_HOTFIX_BYPASS=true",
+		}
+	}
+
+	if n := len([]rune(reason)); n < minHotfixReasonLength {
+		return &ErrorResponse{
+			Error:   "missing_hotfix_reason",
+			Message: fmt.Sprintf("spec.changeHotfix requires a %s header of at least %d characters, got %d", hotfixReasonHeader, minHotfixReasonLength, n),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateHotfix(t *testing.T) {
+	const reason = "Outage: payments API returning 500s"
+
+	tests := []struct {
+		name      string
+		hotfix    bool
+		enabled   string
+		reason    string
+		wantError string
+	}{
+		{name: "not a hotfix", hotfix: false, enabled: "false"},
+		{name: "bypass disabled", hotfix: true, enabled: "false", reason: reason, wantError: "hotfix_bypass_disabled"},
+		{name: "bypass unset", hotfix: true, enabled: "", reason: reason, wantError: "hotfix_bypass_disabled"},
+		{name: "missing reason", hotfix: true, enabled: "true", wantError: "missing_hotfix_reason"},
+		{name: "short reason", hotfix: true, enabled: "true", reason: "urgent fix", wantError: "missing_hotfix_reason"},
+		{name: "reason at minimum", hotfix: true, enabled: "true", reason: strings.Repeat("x", minHotfixReasonLength)},
+		{name: "valid", hotfix: true, enabled: "true", reason: reason},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ENABLE_HOTFIX_BYPASS", tt.enabled)
+			setConfig(t, loadConfig())
+
+			errResp := validateHotfix(tt.hotfix, tt.reason)
+			if tt.wantError == "" {
+				if errResp != nil {
+					t.Fatalf("Expected no error, got %+v", errResp)
+				}
+				return
+			}
+			if errResp == nil || errResp.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got %+v", tt.wantError, errResp)
+			}
+		})
+	}
+}
+
+func TestChangeEndpointHotfix(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	t.Setenv("ENABLE_HOTFIX_BYPASS", "true")
+	setConfig(t, loadConfig())
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	submit := func(reason string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(Change{
+			Kind:       "Change",
+			APIVersion: "v1",
+			Spec: ChangeSpec{
+				Prompt: "Roll back the broken migration",
+				Repos:  repoRefs("https://github.com/myorg/repo1"),
+				Agent:  "claude-cli",
+				Hotfix: true,
+			},
+		})
+		req, _ := http.NewRequest("POST", "/change", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		if reason != "" {
+			req.Header.Set(hotfixReasonHeader, reason)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := submit("")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 without a reason, got %d", w.Code)
+	}
+	var errResp ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &errResp)
+	if errResp.Error != "missing_hotfix_reason" {
+		t.Errorf("Expected error 'missing_hotfix_reason', got '%s'", errResp.Error)
+	}
+
+	const reason = "Outage: payments API returning 500s"
+	w = submit(reason)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	job, err := store.Get(response.ID)
+	if err != nil {
+		t.Fatalf("Failed to load job: %v", err)
+	}
+	if job.HotfixReason != reason {
+		t.Errorf("Expected hotfix reason '%s' to be stored, got '%s'", reason, job.HotfixReason)
+	}
+}
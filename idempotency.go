@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Idempotency request and response headers
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotency-Replayed"
+)
+
+// maxIdempotencyKeyLength bounds the keys clients may send
+const maxIdempotencyKeyLength = 255
+
+// IdempotencyRecord is the response recorded for an Idempotency-Key
+type IdempotencyRecord struct {
+	Key string
+	// RequestHash is the SHA-256 of the request body the response was
+	// recorded for; it is empty for records saved before it was tracked
+	RequestHash string
+	Status      int
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// idempotencyInFlight holds the keys whose original request is still being
+// handled. A retry racing the original is rejected rather than submitting
+// the change twice, and requests for other keys never wait on each other.
+var idempotencyInFlight = struct {
+	sync.Mutex
+	keys map[string]bool
+}{keys: make(map[string]bool)}
+
+// idempotencyScope returns the key records are stored under for the
+// Idempotency-Key key sent by the client c authenticated as, so one client's
+// key can't replay another client's response
+func idempotencyScope(c *gin.Context, key string) string {
+	if identity := c.GetString(apiKeyContextKey); identity != "" {
+		return identity + ":" + key
+	}
+	return key
+}
+
+// responseRecorder is a gin.ResponseWriter that keeps a copy of the body
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotency is a middleware that makes requests carrying an
+// Idempotency-Key safe to retry. The first response for a key is recorded in
+// the store and replayed verbatim, with Idempotency-Replayed: true, for
+// repeats within config.IdempotencyTTL. Keys are scoped to the API key
+// that authenticated the request. A repeat whose body differs from the
+// original, or that arrives while the original is still being handled, is
+// rejected with a 409 rather than replayed. Server errors are not recorded,
+// so a retry after one is processed afresh.
+func idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		log := requestLogger(c)
+		if len(key) > maxIdempotencyKeyLength {
+			log.Warn("Invalid idempotency key", "length", len(key))
+			respondError(c, http.StatusBadRequest, ErrorResponse{
+				Error:   "invalid_idempotency_key",
+				Message: fmt.Sprintf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength),
+			})
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			log.Warn("Failed to read idempotent request body", "error", err)
+			respondBindError(c, err)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		requestHash := hex.EncodeToString(sum[:])
+
+		scoped := idempotencyScope(c, key)
+		idempotencyInFlight.Lock()
+		if idempotencyInFlight.keys[scoped] {
+			idempotencyInFlight.Unlock()
+			log.Warn("Idempotency key already in progress", "idempotencyKey", key)
+			respondError(c, http.StatusConflict, ErrorResponse{
+				Error:   "idempotency_in_progress",
+				Message: fmt.Sprintf("a request with %s %q is still being handled", idempotencyKeyHeader, key),
+			})
+			c.Abort()
+			return
+		}
+		record, err := store.GetIdempotencyRecord(scoped)
+		if err == nil {
+			idempotencyInFlight.Unlock()
+		} else if errors.Is(err, ErrIdempotencyRecordNotFound) {
+			// Reserve the key until the response has been recorded
+			idempotencyInFlight.keys[scoped] = true
+			idempotencyInFlight.Unlock()
+			defer func() {
+				idempotencyInFlight.Lock()
+				delete(idempotencyInFlight.keys, scoped)
+				idempotencyInFlight.Unlock()
+			}()
+		} else {
+			idempotencyInFlight.Unlock()
+		}
+
+		if err == nil && record.RequestHash != "" && record.RequestHash != requestHash {
+			log.Warn("Idempotency key reused with a different body", "idempotencyKey", key)
+			respondError(c, http.StatusConflict, ErrorResponse{
+				Error:   "idempotency_conflict",
+				Message: fmt.Sprintf("%s %q was already used for a request with a different body", idempotencyKeyHeader, key),
+			})
+			c.Abort()
+			return
+		}
+		if err == nil {
+			log.Info("Replaying idempotent response", "idempotencyKey", key, "status", record.Status)
+			c.Header(idempotencyReplayedHeader, "true")
+			c.Data(record.Status, "application/json; charset=utf-8", record.Body)
+			c.Abort()
+			return
+		}
+		if !errors.Is(err, ErrIdempotencyRecordNotFound) {
+			log.Error("Failed to look up idempotency key", "error", err)
+			respondError(c, http.StatusInternalServerError, ErrorResponse{
+				Error:   "internal_error",
+				Message: "failed to look up idempotency key",
+			})
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if status := recorder.Status(); status < http.StatusInternalServerError {
+			now := time.Now().UTC()
+			err := store.SaveIdempotencyRecord(IdempotencyRecord{
+				Key:         scoped,
+				RequestHash: requestHash,
+				Status:      status,
+				Body:        recorder.body.Bytes(),
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(config.IdempotencyTTL),
+			})
+			if err != nil {
+				log.Error("Failed to record idempotent response", "idempotencyKey", key, "error", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// postIdempotent submits change to /change with the given Idempotency-Key
+func postIdempotent(router *gin.Engine, key string, change Change) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(change)
+	req, _ := http.NewRequest("POST", "/change", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/change", idempotency(), handleChange)
+
+	change := Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Add retries",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "copilot-cli",
+		},
+	}
+
+	first := postIdempotent(router, "retry-1", change)
+	if first.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", first.Code, first.Body.String())
+	}
+	if first.Header().Get(idempotencyReplayedHeader) != "" {
+		t.Error("Expected the first response not to be marked as replayed")
+	}
+
+	second := postIdempotent(router, "retry-1", change)
+	if second.Code != http.StatusAccepted {
+		t.Fatalf("Expected replayed status 202, got %d", second.Code)
+	}
+	if second.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Errorf("Expected %s: true, got '%s'", idempotencyReplayedHeader, second.Header().Get(idempotencyReplayedHeader))
+	}
+	if second.Body.String() != first.Body.String() {
+		t.Errorf("Expected the replayed body to match the original\nfirst:  %s\nsecond: %s", first.Body.String(), second.Body.String())
+	}
+	if depth := queue.len(); depth != 1 {
+		t.Errorf("Expected the change to be queued once, got %d", depth)
+	}
+
+	third := postIdempotent(router, "retry-2", change)
+	if third.Code != http.StatusAccepted || third.Header().Get(idempotencyReplayedHeader) != "" {
+		t.Errorf("Expected a new key to submit a new change, got %d", third.Code)
+	}
+	if depth := queue.len(); depth != 2 {
+		t.Errorf("Expected 2 queued changes, got %d", depth)
+	}
+}
+
+func TestIdempotencyConflictingBody(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/change", idempotency(), handleChange)
+
+	change := validTestChange()
+	if w := postIdempotent(router, "retry-1", change); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	change.Spec.Prompt = "Something else entirely"
+	w := postIdempotent(router, "retry-1", change)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Error != "idempotency_conflict" {
+		t.Errorf("Expected error 'idempotency_conflict', got '%s'", response.Error)
+	}
+	if depth := queue.len(); depth != 1 {
+		t.Errorf("Expected only the original change to be queued, got %d", depth)
+	}
+}
+
+func TestIdempotencyKeysExpire(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	cfg := config
+	cfg.IdempotencyTTL = 10 * time.Millisecond
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.POST("/change", idempotency(), handleChange)
+
+	if w := postIdempotent(router, "retry-1", validTestChange()); w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	w := postIdempotent(router, "retry-1", validTestChange())
+	if w.Code != http.StatusAccepted || w.Header().Get(idempotencyReplayedHeader) != "" {
+		t.Errorf("Expected an expired key to submit a new change, got %d with %s '%s'", w.Code, idempotencyReplayedHeader, w.Header().Get(idempotencyReplayedHeader))
+	}
+	if depth := queue.len(); depth != 2 {
+		t.Errorf("Expected 2 queued changes, got %d", depth)
+	}
+}
+
+func TestIdempotencyReplaysValidationErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/change", idempotency(), handleChange)
+
+	invalid := Change{Kind: "Change", APIVersion: "v1", Spec: ChangeSpec{Prompt: "Add retries", Repos: repoRefs("https://github.com/myorg/repo1"), Agent: "unknown-agent"}}
+	if w := postIdempotent(router, "retry-1", invalid); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+
+	w := postIdempotent(router, "retry-1", invalid)
+	if w.Code != http.StatusBadRequest || w.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Errorf("Expected a replayed 400, got %d with %s '%s'", w.Code, idempotencyReplayedHeader, w.Header().Get(idempotencyReplayedHeader))
+	}
+}
+
+func TestIdempotencySkipsServerErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	calls := 0
+	router := gin.New()
+	router.POST("/change", idempotency(), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+	})
+
+	postIdempotent(router, "retry-1", Change{})
+	w := postIdempotent(router, "retry-1", Change{})
+	if calls != 2 {
+		t.Errorf("Expected the handler to run again after a server error, ran %d times", calls)
+	}
+	if w.Header().Get(idempotencyReplayedHeader) != "" {
+		t.Error("Expected a server error not to be replayed")
+	}
+}
+
+func TestIdempotencyKeyTooLong(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/change", idempotency(), handleChange)
+
+	w := postIdempotent(router, string(bytes.Repeat([]byte("k"), maxIdempotencyKeyLength+1)), Change{})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Error != "invalid_idempotency_key" {
+		t.Errorf("Expected error 'invalid_idempotency_key', got '%s'", response.Error)
+	}
+}
+
+func TestIdempotencyKeysDontBlockEachOther(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	router := gin.New()
+	router.POST("/change", idempotency(), func(c *gin.Context) {
+		if c.GetHeader(idempotencyKeyHeader) == "slow" {
+			close(started)
+			<-release
+		}
+		c.JSON(http.StatusAccepted, gin.H{"status": statusPending})
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- postIdempotent(router, "slow", Change{}) }()
+	<-started
+
+	// Other keys proceed while the slow request is handled, and a retry of
+	// the slow one is turned away rather than submitted twice
+	fast := make(chan *httptest.ResponseRecorder)
+	go func() { fast <- postIdempotent(router, "fast", Change{}) }()
+	select {
+	case w := <-fast:
+		if w.Code != http.StatusAccepted {
+			t.Errorf("Expected status 202 for another key, got %d", w.Code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected another key not to wait for the slow request")
+	}
+	if w := postIdempotent(router, "slow", Change{}); w.Code != http.StatusConflict || !bytes.Contains(w.Body.Bytes(), []byte("idempotency_in_progress")) {
+		t.Errorf("Expected 409 idempotency_in_progress for a racing retry, got %d: %s", w.Code, w.Body.String())
+	}
+
+	close(release)
+	if w := <-done; w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202 for the slow request, got %d", w.Code)
+	}
+	if w := postIdempotent(router, "slow", Change{}); w.Header().Get(idempotencyReplayedHeader) != "true" {
+		t.Errorf("Expected a retry after the original finished to be replayed, got %d", w.Code)
+	}
+}
+
+func TestIdempotencyKeysScopedToAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	calls := 0
+	router := gin.New()
+	router.POST("/change", func(c *gin.Context) {
+		c.Set(apiKeyContextKey, c.GetHeader("X-Test-Client"))
+	}, idempotency(), func(c *gin.Context) {
+		calls++
+		c.JSON(http.StatusAccepted, gin.H{"call": calls})
+	})
+
+	post := func(client string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/change", bytes.NewBufferString(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(idempotencyKeyHeader, "shared")
+		req.Header.Set("X-Test-Client", client)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	post("key-a")
+	if w := post("key-b"); w.Header().Get(idempotencyReplayedHeader) != "" || calls != 2 {
+		t.Errorf("Expected another client's key not to replay the response, got %d calls", calls)
+	}
+	if w := post("key-a"); w.Header().Get(idempotencyReplayedHeader) != "true" || calls != 2 {
+		t.Errorf("Expected the same client's retry to be replayed, got %d calls", calls)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// inFlightRequests counts the requests being handled at once, for capacity
+// planning
+type inFlightRequests struct {
+	current atomic.Int64
+	peak    atomic.Int64
+}
+
+// inFlight counts the requests handled by the router, reported by /stats
+var inFlight = &inFlightRequests{}
+
+// start counts a request as in flight, raising the high-water mark when it
+// is exceeded
+func (r *inFlightRequests) start() {
+	n := r.current.Add(1)
+	for {
+		peak := r.peak.Load()
+		if n <= peak || r.peak.CompareAndSwap(peak, n) {
+			return
+		}
+	}
+}
+
+// finish stops counting a request as in flight
+func (r *inFlightRequests) finish() {
+	r.current.Add(-1)
+}
+
+// Current returns the number of requests in flight
+func (r *inFlightRequests) Current() int64 {
+	return r.current.Load()
+}
+
+// Peak returns the most requests that have been in flight at once
+func (r *inFlightRequests) Peak() int64 {
+	return r.peak.Load()
+}
+
+// countInFlight is a middleware that counts each request in requests while
+// the rest of the chain handles it
+func countInFlight(requests *inFlightRequests) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requests.start()
+		defer requests.finish()
+		c.Next()
+	}
+}
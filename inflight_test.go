@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestInFlightRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := inFlight
+	inFlight = &inFlightRequests{}
+	t.Cleanup(func() { inFlight = saved })
+
+	const slow = 8
+	started := make(chan struct{}, slow)
+	release := make(chan struct{})
+	router := gin.New()
+	router.Use(countInFlight(inFlight))
+	router.GET("/slow", func(c *gin.Context) {
+		started <- struct{}{}
+		<-release
+		c.Status(http.StatusNoContent)
+	})
+	router.GET("/stats", handleStats)
+
+	var wg sync.WaitGroup
+	for i := 0; i < slow; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("GET", "/slow", nil)
+			router.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+	for i := 0; i < slow; i++ {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatalf("Only %d of %d slow requests started", i, slow)
+		}
+	}
+
+	getStats := func() map[string]float64 {
+		req, _ := http.NewRequest("GET", "/stats", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]float64
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return response
+	}
+
+	// The stats request is itself in flight
+	stats := getStats()
+	if stats["inFlightRequests"] != slow+1 || stats["inFlightPeak"] != slow+1 {
+		t.Errorf("Expected %d requests in flight and peak, got %v", slow+1, stats)
+	}
+
+	close(release)
+	wg.Wait()
+
+	stats = getStats()
+	if stats["inFlightRequests"] != 1 {
+		t.Errorf("Expected only the stats request in flight, got %v", stats["inFlightRequests"])
+	}
+	if stats["inFlightPeak"] != slow+1 {
+		t.Errorf("Expected the peak to stay at %d, got %v", slow+1, stats["inFlightPeak"])
+	}
+	if n := inFlight.Current(); n != 0 {
+		t.Errorf("Expected no requests in flight, got %d", n)
+	}
+}
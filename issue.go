@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// linkedIssueKeywords maps each spec.linkedIssue.action to the keyword the
+// agent writes into the PR description
+var linkedIssueKeywords = map[string]string{
+	"fixes":      "Fixes",
+	"closes":     "Closes",
+	"references": "Refs",
+}
+
+// LinkedIssueConfig links a change's PR to an existing issue or PR
+type LinkedIssueConfig struct {
+	URL    string `json:"url"`
+	Action string `json:"action"`
+}
+
+// validateLinkedIssue checks cfg, returning nil when it is valid or unset
+func validateLinkedIssue(cfg *LinkedIssueConfig) *ErrorResponse {
+	if cfg == nil {
+		return nil
+	}
+
+	if _, ok := linkedIssueKeywords[cfg.Action]; !ok {
+		return &ErrorResponse{
+			Error:   "invalid_issue_action",
+			Message: fmt.Sprintf("spec.linkedIssue.action %q is not supported, must be 'fixes', 'closes' or 'references'", cfg.Action),
+		}
+	}
+
+	if _, err := parseIssueLink(cfg.URL); err != nil {
+		return &ErrorResponse{
+			Error:   "invalid_issue_url",
+			Message: fmt.Sprintf("spec.linkedIssue.url %q: %v", cfg.URL, err),
+		}
+	}
+
+	return nil
+}
+
+// issueLink is an issue, pull request or merge request parsed from its URL
+type issueLink struct {
+	// Host and Project locate the repository holding it, such as
+	// "github.com" and "myorg/repo1"
+	Host    string
+	Project string
+	// MergeRequest is set for GitLab merge requests, which are referenced
+	// with "!" rather than "#"
+	MergeRequest bool
+	Number       int
+}
+
+// parseIssueLink parses a GitHub (.../issues/123, .../pull/123) or GitLab
+// (.../-/issues/123, .../-/merge_requests/123) issue or PR URL
+func parseIssueLink(raw string) (issueLink, error) {
+	if !isHTTPSURL(raw) {
+		return issueLink{}, errors.New("must be an HTTPS URL")
+	}
+
+	u, _ := url.Parse(raw)
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 4 {
+		return issueLink{}, errors.New("not an issue or pull request URL")
+	}
+
+	kind, number := segments[len(segments)-2], segments[len(segments)-1]
+	switch kind {
+	case "issues", "pull", "merge_requests":
+	default:
+		return issueLink{}, errors.New("not an issue or pull request URL")
+	}
+
+	n, err := strconv.Atoi(number)
+	if err != nil || n <= 0 {
+		return issueLink{}, fmt.Errorf("invalid issue number %q", number)
+	}
+
+	project := segments[:len(segments)-2]
+	if project[len(project)-1] == "-" {
+		project = project[:len(project)-1]
+	}
+	return issueLink{
+		Host:         strings.ToLower(u.Hostname()),
+		Project:      strings.Join(project, "/"),
+		MergeRequest: kind == "merge_requests",
+		Number:       n,
+	}, nil
+}
+
+// linkedIssueReference returns the line the agent adds to the PR description
+// it opens in repo for cfg, such as "Closes #123". GitLab merge requests are
+// referenced as "!123", issues in another project on the same host as
+// "myorg/other#123", and those on another host by their URL.
+func linkedIssueReference(cfg LinkedIssueConfig, repo string) (string, error) {
+	link, err := parseIssueLink(cfg.URL)
+	if err != nil {
+		return "", err
+	}
+
+	keyword, ok := linkedIssueKeywords[cfg.Action]
+	if !ok {
+		return "", fmt.Errorf("unsupported action %q", cfg.Action)
+	}
+
+	host, project := repoHostProject(repo)
+	if host != link.Host {
+		return fmt.Sprintf("%s %s", keyword, cfg.URL), nil
+	}
+	ref := fmt.Sprintf("#%d", link.Number)
+	if link.MergeRequest {
+		ref = fmt.Sprintf("!%d", link.Number)
+	}
+	if !strings.EqualFold(project, link.Project) {
+		ref = link.Project + ref
+	}
+	return fmt.Sprintf("%s %s", keyword, ref), nil
+}
+
+// repoHostProject splits a repository URL, such as
+// https://github.com/myorg/repo1 or git@github.com:myorg/repo1.git, into its
+// lowercased host and its project path
+func repoHostProject(repo string) (string, string) {
+	repo = normalizeRepoURL(repo)
+	if !strings.Contains(repo, "://") {
+		// scp-like git@host:path
+		authority, path, _ := strings.Cut(repo, ":")
+		return authority[strings.LastIndex(authority, "@")+1:], strings.Trim(path, "/")
+	}
+	u, err := url.Parse(repo)
+	if err != nil {
+		return "", ""
+	}
+	return strings.ToLower(u.Hostname()), strings.Trim(u.Path, "/")
+}
+
+// changeLinkedIssue returns the linkedIssueReference for spec's first
+// repository, or "" when spec.linkedIssue is unset
+func changeLinkedIssue(spec ChangeSpec) string {
+	if spec.LinkedIssue == nil {
+		return ""
+	}
+
+	repo := ""
+	if len(spec.Repos) > 0 {
+		repo = spec.Repos[0].URL
+	}
+	ref, err := linkedIssueReference(*spec.LinkedIssue, repo)
+	if err != nil {
+		// Submissions are validated, so only changes stored before a rule
+		// tightened get here
+		logger.Warn("Invalid linked issue, not linking it", "url", spec.LinkedIssue.URL, "error", err)
+		return ""
+	}
+	return ref
+}
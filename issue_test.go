@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseIssueLink(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		want    int
+		wantErr bool
+	}{
+		{name: "GitHub issue", url: "https://github.com/myorg/repo1/issues/123", want: 123},
+		{name: "GitHub pull request", url: "https://github.com/myorg/repo1/pull/45", want: 45},
+		{name: "GitHub trailing slash", url: "https://github.com/myorg/repo1/issues/7/", want: 7},
+		{name: "GitLab issue", url: "https://gitlab.com/group/project/-/issues/88", want: 88},
+		{name: "GitLab nested group merge request", url: "https://gitlab.com/group/sub/project/-/merge_requests/9", want: 9},
+		{name: "plain HTTP", url: "http://github.com/myorg/repo1/issues/123", wantErr: true},
+		{name: "repository URL", url: "https://github.com/myorg/repo1", wantErr: true},
+		{name: "non-numeric number", url: "https://github.com/myorg/repo1/issues/abc", wantErr: true},
+		{name: "zero number", url: "https://github.com/myorg/repo1/issues/0", wantErr: true},
+		{name: "wrong kind", url: "https://github.com/myorg/repo1/commits/123", wantErr: true},
+		{name: "empty", url: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseIssueLink(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if got.Number != tt.want {
+				t.Errorf("Expected issue number %d, got %d", tt.want, got.Number)
+			}
+		})
+	}
+}
+
+func TestValidateLinkedIssue(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       *LinkedIssueConfig
+		wantError string
+	}{
+		{name: "unset", cfg: nil},
+		{name: "valid", cfg: &LinkedIssueConfig{URL: "https://github.com/myorg/repo1/issues/1", Action: "closes"}},
+		{name: "invalid action", cfg: &LinkedIssueConfig{URL: "https://github.com/myorg/repo1/issues/1", Action: "resolves"}, wantError: "invalid_issue_action"},
+		{name: "invalid URL", cfg: &LinkedIssueConfig{URL: "https://github.com/myorg/repo1", Action: "fixes"}, wantError: "invalid_issue_url"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errResp := validateLinkedIssue(tt.cfg)
+			if tt.wantError == "" {
+				if errResp != nil {
+					t.Fatalf("Expected no error, got %+v", errResp)
+				}
+				return
+			}
+			if errResp == nil || errResp.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got %+v", tt.wantError, errResp)
+			}
+		})
+	}
+}
+
+func TestLinkedIssueReference(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		action string
+		repo   string
+		want   string
+	}{
+		{"fixes", "https://github.com/myorg/repo1/issues/123", "fixes", "https://github.com/myorg/repo1", "Fixes #123"},
+		{"closes", "https://github.com/myorg/repo1/issues/123", "closes", "https://github.com/myorg/repo1", "Closes #123"},
+		{"references", "https://github.com/myorg/repo1/pull/123", "references", "https://github.com/myorg/repo1", "Refs #123"},
+		{"SSH repository", "https://github.com/myorg/repo1/issues/123", "closes", "git@github.com:myorg/repo1.git", "Closes #123"},
+		{"other repository", "https://github.com/myorg/tracker/issues/123", "closes", "https://github.com/myorg/repo1", "Closes myorg/tracker#123"},
+		{"GitLab merge request", "https://gitlab.com/group/sub/project/-/merge_requests/9", "references", "https://gitlab.com/group/sub/project", "Refs !9"},
+		{"GitLab issue in another project", "https://gitlab.com/group/tracker/-/issues/88", "fixes", "https://gitlab.com/group/sub/project", "Fixes group/tracker#88"},
+		{"other host", "https://gitlab.com/group/tracker/-/issues/88", "fixes", "https://github.com/myorg/repo1", "Fixes https://gitlab.com/group/tracker/-/issues/88"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := linkedIssueReference(LinkedIssueConfig{URL: tt.url, Action: tt.action}, tt.repo)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Expected '%s', got '%s'", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestProcessJobPassesLinkedIssue(t *testing.T) {
+	isolateJobs(t)
+	var got string
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		got = req.LinkedIssue
+		return ChangeResult{}, nil
+	})
+
+	job := submitTestJob(t, ChangeSpec{
+		Agent:       "copilot-cli",
+		Repos:       repoRefs("https://github.com/myorg/repo1"),
+		LinkedIssue: &LinkedIssueConfig{URL: "https://github.com/myorg/repo1/issues/42", Action: "closes"},
+	})
+	processJob(context.Background(), job.ID)
+
+	if got != "Closes #42" {
+		t.Errorf("Expected the agent to be asked to add 'Closes #42', got '%s'", got)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Job status values
+const (
+	statusPending         = "pending"
+	statusPendingApproval = "pending_approval"
+	statusScheduled       = "scheduled"
+	statusAwaitingLock    = "awaiting_lock"
+	statusRunning         = "running"
+	statusDone            = "done"
+	statusFailed          = "failed"
+	statusCancelled       = "cancelled"
+	statusRejected        = "rejected"
+)
+
+// Job tracks the lifecycle of a submitted change
+type Job struct {
+	ID          string     `json:"id"`
+	Status      string     `json:"status"`
+	Change      Change     `json:"change"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+	CancelledAt *time.Time `json:"cancelledAt,omitempty"`
+	// Error and Message describe why a failed job failed
+	Error   string        `json:"error,omitempty"`
+	Message string        `json:"message,omitempty"`
+	Result  *ChangeResult `json:"result,omitempty"`
+	// RepoResults holds the outcome of the change in each of its
+	// repositories, in spec.repos order, once it has run
+	RepoResults []RepoResult `json:"repoResults,omitempty"`
+	// WorkspaceID identifies the agent working directory last used for the job
+	WorkspaceID string `json:"workspaceId,omitempty"`
+	// Reason is the operator's explanation for a batch action applied to
+	// the job
+	Reason string `json:"reason,omitempty"`
+	// ContentHash identifies the change's spec, so identical specs share it
+	ContentHash string `json:"contentHash"`
+	// TraceContext is the propagated trace context of the submitting request,
+	// so processing the job continues its trace
+	TraceContext map[string]string `json:"traceContext,omitempty"`
+	// HotfixReason is the justification given for a hotfix change
+	HotfixReason string `json:"hotfixReason,omitempty"`
+	// ApprovedBy and ApprovedAt record who approved a change that required
+	// approval, and when
+	ApprovedBy string     `json:"approvedBy,omitempty"`
+	ApprovedAt *time.Time `json:"approvedAt,omitempty"`
+	// RejectedBy and RejectedAt record who rejected a change that required
+	// approval, and when; the reason given is kept in Reason
+	RejectedBy string     `json:"rejectedBy,omitempty"`
+	RejectedAt *time.Time `json:"rejectedAt,omitempty"`
+	// ParentJobID is the failed job this job retries
+	ParentJobID string `json:"parentJobId,omitempty"`
+}
+
+// isTerminal reports whether status is a final job state
+func isTerminal(status string) bool {
+	switch status {
+	case statusDone, statusFailed, statusCancelled, statusRejected:
+		return true
+	}
+	return false
+}
+
+// JobSummary is the abbreviated form of a Job returned when listing changes
+type JobSummary struct {
+	ID        string            `json:"id"`
+	Status    string            `json:"status"`
+	CreatedAt time.Time         `json:"createdAt"`
+	Agent     string            `json:"agent"`
+	Repos     []string          `json:"repos"`
+	Priority  int               `json:"priority,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+	// RunAt is when a scheduled change is due to run
+	RunAt *time.Time `json:"runAt,omitempty"`
+}
+
+// summary returns the JobSummary for job
+func (job Job) summary() JobSummary {
+	return JobSummary{
+		ID:        job.ID,
+		Status:    job.Status,
+		CreatedAt: job.CreatedAt,
+		Agent:     job.Change.Spec.Agent,
+		Repos:     repoURLs(job.Change.Spec.Repos),
+		Priority:  job.Change.Spec.Priority,
+		Labels:    job.Change.Spec.Labels,
+		RunAt:     job.Change.Spec.RunAt,
+	}
+}
+
+// newJob creates a pending job for change with a freshly generated ID
+func newJob(change Change) Job {
+	return Job{
+		ID:          newID(),
+		Status:      statusPending,
+		Change:      change,
+		CreatedAt:   time.Now().UTC(),
+		ContentHash: contentHash(change.Spec),
+	}
+}
+
+// contentHash returns the hex SHA-256 of spec's canonical JSON encoding,
+// with object keys sorted
+func contentHash(spec ChangeSpec) string {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		panic(fmt.Sprintf("failed to encode spec: %v", err))
+	}
+	// Struct fields are encoded in declaration order, so decode into generic
+	// values and encode again, which sorts the keys of every object
+	var canonical interface{}
+	if err := json.Unmarshal(data, &canonical); err != nil {
+		panic(fmt.Sprintf("failed to decode spec: %v", err))
+	}
+	if data, err = json.Marshal(canonical); err != nil {
+		panic(fmt.Sprintf("failed to encode spec: %v", err))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// newID returns a random (version 4) UUID
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to generate ID: %v", err))
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+// uuidPattern matches a lowercase version 4 UUID
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNewIDIsUUIDv4(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		id := newID()
+		if !uuidPattern.MatchString(id) {
+			t.Fatalf("Expected UUIDv4, got %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("Duplicate ID generated: %q", id)
+		}
+		seen[id] = true
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxLabels is the most key-value pairs spec.labels may hold
+	maxLabels = 20
+	// maxLabelKeyLength and maxLabelValueLength limit the characters in
+	// each label key and value
+	maxLabelKeyLength   = 63
+	maxLabelValueLength = 256
+)
+
+// labelKeyPattern matches label keys: letters, digits, '.', '_', '-' and
+// '/', starting and ending with a letter or digit
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+
+// validateLabelKey checks a label key, returning a description of the
+// problem or "" when it is valid
+func validateLabelKey(key string) string {
+	if len(key) > maxLabelKeyLength {
+		return fmt.Sprintf("must be at most %d characters", maxLabelKeyLength)
+	}
+	if !labelKeyPattern.MatchString(key) {
+		return "must start and end with a letter or digit and contain only letters, digits, '.', '_', '-' and '/'"
+	}
+	return ""
+}
+
+// validateLabels checks spec.labels, returning nil when it is valid. Keys
+// are checked in sorted order so the reported error is stable.
+func validateLabels(labels map[string]string) *ErrorResponse {
+	if len(labels) > maxLabels {
+		return &ErrorResponse{
+			Error:   "invalid_labels",
+			Message: fmt.Sprintf("spec.labels has %d labels, maximum allowed is %d", len(labels), maxLabels),
+		}
+	}
+
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if problem := validateLabelKey(key); problem != "" {
+			return &ErrorResponse{
+				Error:   "invalid_labels",
+				Message: fmt.Sprintf("spec.labels key %q %s", key, problem),
+			}
+		}
+		if utf8.RuneCountInString(labels[key]) > maxLabelValueLength {
+			return &ErrorResponse{
+				Error:   "invalid_labels",
+				Message: fmt.Sprintf("spec.labels[%q] must be at most %d characters", key, maxLabelValueLength),
+			}
+		}
+	}
+	return nil
+}
+
+// parseLabelSelectors parses label query parameters of the form key=value
+// into the labels a job must carry to be listed
+func parseLabelSelectors(selectors []string) (map[string]string, *ErrorResponse) {
+	if len(selectors) == 0 {
+		return nil, nil
+	}
+
+	labels := make(map[string]string, len(selectors))
+	for _, selector := range selectors {
+		key, value, ok := strings.Cut(selector, "=")
+		if !ok {
+			return nil, &ErrorResponse{
+				Error:   "invalid_label_selector",
+				Message: fmt.Sprintf("label %q must have the form key=value", selector),
+			}
+		}
+		if problem := validateLabelKey(key); problem != "" {
+			return nil, &ErrorResponse{
+				Error:   "invalid_label_selector",
+				Message: fmt.Sprintf("label key %q %s", key, problem),
+			}
+		}
+		if existing, ok := labels[key]; ok && existing != value {
+			return nil, &ErrorResponse{
+				Error:   "invalid_label_selector",
+				Message: fmt.Sprintf("label %q is given more than once with different values", key),
+			}
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// hasLabels reports whether labels includes every key-value pair in want
+func hasLabels(labels, want map[string]string) bool {
+	for key, value := range want {
+		if got, ok := labels[key]; !ok || got != value {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestListChangesByLabel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+	router.GET("/changes", handleListChanges)
+
+	for _, labels := range []map[string]string{
+		{"team": "payments", "ticket": "PAY-1"},
+		{"team": "payments", "ticket": "PAY-2"},
+		{"team": "search"},
+	} {
+		change := validTestChange()
+		change.Spec.Labels = labels
+		if w := postJSON(router, "/change", change); w.Code != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+
+	tests := []struct {
+		query     url.Values
+		wantTotal int
+	}{
+		{url.Values{"label": {"team=payments"}}, 2},
+		{url.Values{"label": {"team=payments", "ticket=PAY-2"}}, 1},
+		{url.Values{"label": {"team=search", "ticket=PAY-2"}}, 0},
+		{url.Values{"label": {"env=prod"}}, 0},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/changes?"+tt.query.Encode(), nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", tt.query.Encode(), w.Code)
+		}
+
+		var response struct {
+			Total int          `json:"total"`
+			Items []JobSummary `json:"items"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		if response.Total != tt.wantTotal || len(response.Items) != tt.wantTotal {
+			t.Errorf("%s: expected %d changes, got total %d with %d items", tt.query.Encode(), tt.wantTotal, response.Total, len(response.Items))
+		}
+		for _, item := range response.Items {
+			if !hasLabels(item.Labels, mustParseLabels(t, tt.query["label"])) {
+				t.Errorf("%s: listed change %s with labels %v", tt.query.Encode(), item.ID, item.Labels)
+			}
+		}
+	}
+}
+
+func TestListChangesInvalidLabelSelector(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/changes", handleListChanges)
+
+	for _, selectors := range [][]string{{"team"}, {"=payments"}, {`te"am=payments`}, {"team=a", "team=b"}} {
+		query := url.Values{"label": selectors}.Encode()
+		req, _ := http.NewRequest("GET", "/changes?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+			continue
+		}
+
+		var response ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: failed to unmarshal response: %v", query, err)
+		}
+		if response.Error != "invalid_label_selector" {
+			t.Errorf("%s: expected error 'invalid_label_selector', got '%s'", query, response.Error)
+		}
+	}
+}
+
+// mustParseLabels parses label selectors that are known to be valid
+func mustParseLabels(t *testing.T, selectors []string) map[string]string {
+	t.Helper()
+
+	labels, errResp := parseLabelSelectors(selectors)
+	if errResp != nil {
+		t.Fatalf("Failed to parse labels %v: %s", selectors, errResp.Message)
+	}
+	return labels
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// FileLockManager hands out exclusive locks on file paths to changes, so two
+// changes declaring the same spec.lockFiles entry never run at once. Paths
+// are locked across all repos, and a change acquires all of its paths at
+// once or none of them.
+type FileLockManager struct {
+	mu      sync.Mutex
+	holders map[string]string
+	held    map[string][]string
+	waiting []string
+}
+
+var fileLocks = NewFileLockManager()
+
+// NewFileLockManager creates a FileLockManager with no locks held
+func NewFileLockManager() *FileLockManager {
+	return &FileLockManager{
+		holders: make(map[string]string),
+		held:    make(map[string][]string),
+	}
+}
+
+// Acquire locks paths for the change id, returning false without locking
+// anything if another change holds any of them. Changes that fail to acquire
+// their locks are remembered until the next call to takeWaiters.
+func (m *FileLockManager) Acquire(paths []string, id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range paths {
+		if holder, ok := m.holders[path.Clean(p)]; ok && holder != id {
+			m.addWaiter(id)
+			return false
+		}
+	}
+
+	for _, p := range paths {
+		p = path.Clean(p)
+		if _, ok := m.holders[p]; !ok {
+			m.holders[p] = id
+			m.held[id] = append(m.held[id], p)
+		}
+	}
+	return true
+}
+
+// addWaiter records id as waiting for a lock. The caller must hold m.mu.
+func (m *FileLockManager) addWaiter(id string) {
+	for _, waiter := range m.waiting {
+		if waiter == id {
+			return
+		}
+	}
+	m.waiting = append(m.waiting, id)
+}
+
+// Release frees every lock held by the change id
+func (m *FileLockManager) Release(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, p := range m.held[id] {
+		delete(m.holders, p)
+	}
+	delete(m.held, id)
+}
+
+// takeWaiters returns the changes that have failed to acquire their locks
+// since the last call, in the order they first tried, and forgets them
+func (m *FileLockManager) takeWaiters() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	waiting := m.waiting
+	m.waiting = nil
+	return waiting
+}
+
+// validateLockFiles checks that every spec.lockFiles entry is a non-empty
+// path inside the repository and that no path is listed twice
+func validateLockFiles(paths []string) *ErrorResponse {
+	seen := make(map[string]int, len(paths))
+	for i, p := range paths {
+		clean := path.Clean(p)
+		if p == "" || path.IsAbs(p) || clean == ".." || strings.HasPrefix(clean, "../") {
+			return &ErrorResponse{
+				Error:   "invalid_lock_files",
+				Message: fmt.Sprintf("spec.lockFiles[%d] %q must be a non-empty path relative to the repository root", i, p),
+			}
+		}
+		if first, ok := seen[clean]; ok {
+			return &ErrorResponse{
+				Error:   "invalid_lock_files",
+				Message: fmt.Sprintf("spec.lockFiles[%d] %q duplicates spec.lockFiles[%d]", i, p, first),
+			}
+		}
+		seen[clean] = i
+	}
+	return nil
+}
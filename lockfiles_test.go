@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFileLockManagerContention(t *testing.T) {
+	m := NewFileLockManager()
+
+	if !m.Acquire([]string{"go.mod", "main.go"}, "a") {
+		t.Fatal("Expected free locks to be acquired")
+	}
+	if !m.Acquire([]string{"go.mod"}, "a") {
+		t.Error("Expected a holder to re-acquire its own lock")
+	}
+	if m.Acquire([]string{"README.md", "./main.go"}, "b") {
+		t.Fatal("Expected acquisition of a held path to fail")
+	}
+	if !m.Acquire([]string{"README.md"}, "c") {
+		t.Fatal("Expected locks on unrelated paths to be acquired")
+	}
+
+	// A failed acquisition must not hold any of the paths it asked for
+	m.Release("c")
+	if !m.Acquire([]string{"README.md"}, "d") {
+		t.Error("Expected a failed acquisition not to keep partial locks")
+	}
+
+	if got := m.takeWaiters(); !reflect.DeepEqual(got, []string{"b"}) {
+		t.Errorf("Expected waiters [b], got %v", got)
+	}
+	if got := m.takeWaiters(); len(got) != 0 {
+		t.Errorf("Expected waiters to be cleared, got %v", got)
+	}
+
+	m.Release("a")
+	if !m.Acquire([]string{"main.go"}, "b") {
+		t.Error("Expected released locks to be acquirable")
+	}
+}
+
+func TestValidateLockFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		valid bool
+	}{
+		{"none", nil, true},
+		{"relative paths", []string{"go.mod", "internal/api/handler.go"}, true},
+		{"empty path", []string{""}, false},
+		{"absolute path", []string{"/etc/passwd"}, false},
+		{"escapes repo", []string{"../other/go.mod"}, false},
+		{"duplicate after cleaning", []string{"docs/api.md", "docs/../docs/api.md"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errResp := validateLockFiles(tt.paths)
+			if tt.valid && errResp != nil {
+				t.Errorf("Expected %v to be valid, got %s", tt.paths, errResp.Message)
+			}
+			if !tt.valid && (errResp == nil || errResp.Error != "invalid_lock_files") {
+				t.Errorf("Expected invalid_lock_files for %v, got %+v", tt.paths, errResp)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Log output formats accepted in LOG_FORMAT
+const (
+	logFormatJSON = "json"
+	logFormatText = "text"
+)
+
+// atomicLevel is a slog.Leveler whose level can be changed while loggers
+// are using it. The zero value is at info level.
+type atomicLevel struct {
+	v atomic.Value
+}
+
+// Level implements slog.Leveler
+func (l *atomicLevel) Level() slog.Level {
+	if level, ok := l.v.Load().(slog.Level); ok {
+		return level
+	}
+	return slog.LevelInfo
+}
+
+// set changes the level of every logger using l
+func (l *atomicLevel) set(level slog.Level) {
+	l.v.Store(level)
+}
+
+// logLevel is the level of the package logger, which PUT /admin/log-level
+// changes at runtime
+var logLevel = &atomicLevel{}
+
+// parseLogLevel parses "debug", "info", "warn" or "error", in any case
+func parseLogLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("log level %q is not supported, must be debug, info, warn or error", level)
+}
+
+// newLogger returns a logger writing to w in format, "json" or "text", at
+// level, one of "debug", "info", "warn" or "error", which is stored in
+// leveler so it can be changed later. Empty values select JSON at info level.
+// An unrecognised value falls back to the same default and is reported in the
+// returned error, so the caller can log it with the logger that is still
+// returned.
+func newLogger(w io.Writer, format, level string, leveler *atomicLevel) (*slog.Logger, error) {
+	var errs []string
+
+	leveler.set(slog.LevelInfo)
+	if level != "" {
+		if l, err := parseLogLevel(level); err != nil {
+			errs = append(errs, fmt.Sprintf("LOG_LEVEL %q is not supported, must be debug, info, warn or error", level))
+		} else {
+			leveler.set(l)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: leveler}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", logFormatJSON:
+		handler = slog.NewJSONHandler(w, opts)
+	case logFormatText:
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		errs = append(errs, fmt.Sprintf("LOG_FORMAT %q is not supported, must be json or text", format))
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	if len(errs) > 0 {
+		return slog.New(handler), errors.New(strings.Join(errs, "; "))
+	}
+	return slog.New(handler), nil
+}
+
+// LogLevelRequest is the body of PUT /admin/log-level
+type LogLevelRequest struct {
+	Level string `json:"level" binding:"required"`
+}
+
+// handleSetLogLevel handles requests to change the log level at runtime
+func handleSetLogLevel(c *gin.Context) {
+	log := requestLogger(c)
+
+	var req LogLevelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error("Failed to bind log level", "error", err)
+		respondBindError(c, err)
+		return
+	}
+
+	level, err := parseLogLevel(req.Level)
+	if err != nil {
+		log.Warn("Invalid log level", "level", req.Level)
+		respondError(c, http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_log_level",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	previous := logLevel.Level()
+	logLevel.set(level)
+	// Warn rather than info, so lowering the verbosity to warn still leaves a
+	// record of who lowered it
+	log.Warn("Log level changed", "from", previous.String(), "to", level.String())
+
+	c.JSON(http.StatusOK, gin.H{"level": strings.ToLower(level.String())})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewLoggerFormat(t *testing.T) {
+	tests := []struct {
+		format   string
+		wantJSON bool
+	}{
+		{"", true},
+		{"json", true},
+		{"text", false},
+		{"TEXT", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			log, err := newLogger(&buf, tt.format, "", &atomicLevel{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			log.Info("Change request received", "id", "abc")
+
+			var entry map[string]interface{}
+			isJSON := json.Unmarshal(buf.Bytes(), &entry) == nil
+			if isJSON != tt.wantJSON {
+				t.Errorf("Expected JSON output %v, got %q", tt.wantJSON, buf.String())
+			}
+			if !strings.Contains(buf.String(), "Change request received") {
+				t.Errorf("Expected the message to be logged, got %q", buf.String())
+			}
+		})
+	}
+}
+
+func TestNewLoggerLevel(t *testing.T) {
+	tests := []struct {
+		level     string
+		wantDebug bool
+		wantInfo  bool
+	}{
+		{"", false, true},
+		{"debug", true, true},
+		{"info", false, true},
+		{"warn", false, false},
+		{"error", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			var buf bytes.Buffer
+			log, err := newLogger(&buf, "json", tt.level, &atomicLevel{})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			log.Debug("debug line")
+			log.Info("info line")
+
+			if got := strings.Contains(buf.String(), "debug line"); got != tt.wantDebug {
+				t.Errorf("Expected debug line logged %v, got %v", tt.wantDebug, got)
+			}
+			if got := strings.Contains(buf.String(), "info line"); got != tt.wantInfo {
+				t.Errorf("Expected info line logged %v, got %v", tt.wantInfo, got)
+			}
+		})
+	}
+}
+
+func TestNewLoggerInvalidValues(t *testing.T) {
+	var buf bytes.Buffer
+	log, err := newLogger(&buf, "xml", "verbose", &atomicLevel{})
+	if err == nil {
+		t.Fatal("Expected an error for unsupported values")
+	}
+	if !strings.Contains(err.Error(), "LOG_FORMAT") || !strings.Contains(err.Error(), "LOG_LEVEL") {
+		t.Errorf("Expected both values to be reported, got %v", err)
+	}
+
+	// The defaults are used instead: JSON at info level
+	log.Debug("debug line")
+	log.Info("info line")
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("Expected a single JSON info line, got %q", buf.String())
+	}
+	if entry["msg"] != "info line" {
+		t.Errorf("Expected 'info line', got %v", entry["msg"])
+	}
+}
+
+func TestSetLogLevelEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previous := logLevel.Level()
+	t.Cleanup(func() { logLevel.set(previous) })
+
+	var buf bytes.Buffer
+	log, err := newLogger(&buf, "json", "info", logLevel)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	router := gin.New()
+	router.PUT("/admin/log-level", handleSetLogLevel)
+	put := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", "/admin/log-level", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := put(`{"level":"DEBUG"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"level":"debug"`) {
+		t.Errorf("Expected the new level in the response, got %s", w.Body.String())
+	}
+
+	// Loggers created earlier pick up the change
+	log.Debug("debug line")
+	if !strings.Contains(buf.String(), "debug line") {
+		t.Errorf("Expected debug logging after the change, got %q", buf.String())
+	}
+
+	for _, body := range []string{`{"level":"verbose"}`, `{"level":"info+2"}`, `{}`} {
+		w := put(body)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", body, w.Code)
+		}
+	}
+	if logLevel.Level() != slog.LevelDebug {
+		t.Errorf("Expected invalid requests to keep the level, got %s", logLevel.Level())
+	}
+}
+
+func TestSetLogLevelRequiresAdminToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previous := logLevel.Level()
+	t.Cleanup(func() { logLevel.set(previous) })
+	cfg := config
+	cfg.AdminToken = "s3cret"
+	setConfig(t, cfg)
+
+	router := newRouter()
+	put := func(token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", "/admin/log-level", strings.NewReader(`{"level":"debug"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set(adminTokenHeader, token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := put(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 without an admin token, got %d", w.Code)
+	}
+	if logLevel.Level() != previous {
+		t.Errorf("Expected an unauthenticated request to keep the level, got %s", logLevel.Level())
+	}
+	if w := put("s3cret"); w.Code != http.StatusOK {
+		t.Errorf("Expected status 200 with the admin token, got %d: %s", w.Code, w.Body.String())
+	}
+}
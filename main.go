@@ -1,73 +1,423 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // ChangeSpec defines the specification for a change request
 type ChangeSpec struct {
-	Prompt string   `json:"prompt" binding:"required"`
-	Repos  []string `json:"repos" binding:"required"`
-	Agent  string   `json:"agent" binding:"required"`
-	Branch string   `json:"branch"`
+	Prompt string `json:"prompt"`
+	// Repos are the repositories to change; each may override Branch
+	Repos  []RepoRef `json:"repos"`
+	Agent  string    `json:"agent"`
+	Branch string    `json:"branch"`
+	// MaxOutputSizeKB caps the total size of the agent's artifacts; 0 means no cap
+	MaxOutputSizeKB int `json:"maxOutputSizeKB,omitempty"`
+	// MaxTokens is the agent's token budget; 0 means the agent's default
+	MaxTokens int `json:"maxTokens,omitempty"`
+	// ImpactScope gates the change on its estimated blast radius
+	ImpactScope *ImpactScopeConfig `json:"impactScope,omitempty"`
+	// ObservabilityIntegration asks the agent to instrument new code
+	ObservabilityIntegration *OIConfig `json:"observabilityIntegration,omitempty"`
+	// LinkedIssue links the resulting PR to an existing issue or PR
+	LinkedIssue *LinkedIssueConfig `json:"linkedIssue,omitempty"`
+	// PersistWorkspace keeps the agent's working directory across retry
+	// attempts instead of re-cloning from scratch
+	PersistWorkspace bool `json:"persistWorkspace,omitempty"`
+	// LockFiles are paths, relative to each repo's root, that no other
+	// change may modify while this one runs
+	LockFiles []string `json:"lockFiles,omitempty"`
+	// SignCommits asks the agent to sign its commits
+	SignCommits *CommitSigningConfig `json:"signCommits,omitempty"`
+	// ProgressWebhook receives snapshots of the change while it runs
+	ProgressWebhook *ProgressWebhookConfig `json:"progressWebhook,omitempty"`
+	// Category groups the change for reporting; defaults to "uncategorized"
+	Category string `json:"changeCategory,omitempty"`
+	// Hotfix marks an urgent change that may bypass the standard change
+	// windows; it must be justified in the X-Hotfix-Reason header
+	Hotfix bool `json:"changeHotfix,omitempty"`
+	// WebhookURL is notified of the change's final status once it is done,
+	// failed, cancelled or rejected
+	WebhookURL string `json:"webhookURL,omitempty"`
+	// DryRun validates the change without queuing it
+	DryRun bool `json:"dryRun,omitempty"`
+	// RequireApproval holds the change in pending_approval until it is
+	// approved or rejected through the API
+	RequireApproval bool `json:"requireApproval,omitempty"`
+	// RunAt schedules the change to run no earlier than the given time
+	RunAt *time.Time `json:"runAt,omitempty"`
+	// Priority orders queued changes, from 1 (lowest) to 5 (highest);
+	// defaults to 3
+	Priority int `json:"priority,omitempty"`
+	// Labels are free-form key-value pairs for grouping and filtering
+	// changes, such as a project, ticket or environment
+	Labels map[string]string `json:"labels,omitempty"`
+	// TimeoutSeconds bounds how long the agent may run, across all
+	// attempts, before the change fails; defaults to 300
+	TimeoutSeconds int `json:"timeoutSeconds,omitempty"`
+	// Options are agent-specific parameters, such as the model to use;
+	// AGENT_REQUIRED_OPTIONS lists the keys each agent requires
+	Options map[string]string `json:"options,omitempty"`
+	// Execution is "parallel" to run the agent in every repository at once,
+	// the default, or "sequential" to run through them in order
+	Execution string `json:"execution,omitempty"`
+	// FailFast stops a sequential change at the first repository that fails
+	FailFast bool `json:"failFast,omitempty"`
+}
+
+// ImpactScopeConfig limits how far-reaching a change is allowed to be
+type ImpactScopeConfig struct {
+	// MaxDownstreamServices is the most services the change may affect; 0
+	// means no limit
+	MaxDownstreamServices int  `json:"maxDownstreamServices,omitempty"`
+	AllowBreakingChanges  bool `json:"allowBreakingChanges"`
+}
+
+// OIConfig configures auto-instrumentation of code written by the agent
+type OIConfig struct {
+	Type            string `json:"type"`
+	MetricsEndpoint string `json:"metricsEndpoint,omitempty"`
+	TraceEndpoint   string `json:"traceEndpoint,omitempty"`
+}
+
+// observabilityTypes are the supported observability frameworks
+var observabilityTypes = map[string]bool{
+	"opentelemetry": true,
+	"datadog":       true,
+}
+
+// ObjectMeta holds optional Kubernetes-style identifying metadata
+type ObjectMeta struct {
+	Name      string `json:"name,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // Change represents the entire change request
 type Change struct {
-	Kind       string     `json:"kind" binding:"required,eq=Change"`
-	APIVersion string     `json:"apiVersion" binding:"required"`
-	Spec       ChangeSpec `json:"spec" binding:"required"`
+	Kind       string      `json:"kind"`
+	APIVersion string      `json:"apiVersion"`
+	Metadata   *ObjectMeta `json:"metadata,omitempty"`
+	Spec       ChangeSpec  `json:"spec"`
+}
+
+// metadataNamePattern matches valid metadata names and namespaces, following
+// the Kubernetes DNS label rules
+var metadataNamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]{0,61}[a-z0-9])?$`)
+
+// Pagination defaults and bounds for list endpoints
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+// supportedAPIVersions are the Change apiVersion values this server accepts
+var supportedAPIVersions = map[string]bool{
+	"v1": true,
+}
+
+// describeAPIVersions lists the supported API versions for error messages
+func describeAPIVersions() string {
+	versions := make([]string, 0, len(supportedAPIVersions))
+	for version := range supportedAPIVersions {
+		versions = append(versions, "'"+version+"'")
+	}
+	sort.Strings(versions)
+	return strings.Join(versions, ", ")
 }
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
 	Error   string `json:"error"`
 	Message string `json:"message,omitempty"`
+	HelpURL string `json:"helpURL,omitempty"`
+	// Errors lists every validation failure of a rejected change; Error and
+	// Message describe the first
+	Errors []FieldError `json:"errors,omitempty"`
+	// ExistingJobID is the change that makes the request redundant: the
+	// earlier change a duplicate_change repeats, or the retry a
+	// change_already_retried already created
+	ExistingJobID string `json:"existingJobId,omitempty"`
+}
+
+// errorHelpURL returns the documentation link for an error code, or "" when
+// ERROR_HELP_BASE_URL is not configured
+func errorHelpURL(code string) string {
+	if config.ErrorHelpBaseURL == "" {
+		return ""
+	}
+	return strings.TrimRight(config.ErrorHelpBaseURL, "/") + "/" + url.PathEscape(code)
+}
+
+// respondError writes resp with the given status, adding the help link for
+// its error code. The code is also recorded on the context for ginMetrics.
+func respondError(c *gin.Context, status int, resp ErrorResponse) {
+	c.Set(errorCodeContextKey, resp.Error)
+	resp.HelpURL = errorHelpURL(resp.Error)
+	c.JSON(status, resp)
 }
 
 var logger *slog.Logger
 
+// configFileErr records a failure to read the config file, which stops the
+// server in main; init can't exit without breaking tests
+var configFileErr error
+
 func init() {
-	// Initialize slog logger with JSON handler
-	logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	// The config file is read first since it may configure the logger; an
+	// explicitly given file must exist, the default one is optional
+	path, required := os.Getenv("CONFIG_FILE"), true
+	if path == "" {
+		path, required = defaultConfigFile, false
+	}
+	fileSettings, configFileErr = loadConfigFile(path, required)
+
+	// The logger is set up before the rest of the configuration is loaded,
+	// since loading it logs invalid values
+	var err error
+	logger, err = newLogger(os.Stdout, setting("LOG_FORMAT"), setting("LOG_LEVEL"), logLevel)
+	if err != nil {
+		logger.Warn("Invalid logging configuration, using defaults", "error", err)
+	}
+
+	config = loadConfig()
+	readiness = newReadinessChecker(config.ReadinessCacheTTL)
+	readiness.register("store", storeReadiness.check)
+	readiness.register("workers", workerReadiness.check)
+	workspaces = newDirWorkspaceStore(config.WorkspaceDir, int64(config.WorkspaceMaxGB)<<30)
+	categories = NewCategoryRegistry(config.ChangeCategories)
+	agentRegistry = loadAgentRegistry(config)
+	webhookClient = &http.Client{Timeout: config.WebhookTimeout}
 }
 
 func main() {
 	// Set Gin to release mode for production
 	gin.SetMode(gin.ReleaseMode)
 
-	router := gin.New()
+	if configFileErr != nil {
+		logger.Error("Failed to load config file", "error", configFileErr)
+		os.Exit(1)
+	}
+
+	// Check the listen address, worker pool size and TLS settings before
+	// anything is started
+	addr, err := listenAddress(config.BindAddress, config.Port)
+	if err != nil {
+		logger.Error("Invalid listen address", "error", err, "bindAddress", config.BindAddress, "port", config.Port)
+		os.Exit(1)
+	}
+	if err := validateWorkerPoolSize(config.WorkerPoolSize); err != nil {
+		logger.Error("Invalid WORKER_POOL_SIZE", "error", err, "value", setting("WORKER_POOL_SIZE"))
+		os.Exit(1)
+	}
+	tlsConfig, err := serverTLSConfig(config)
+	if err != nil {
+		logger.Error("Invalid TLS configuration", "error", err)
+		os.Exit(1)
+	}
 
-	// Add custom middleware for logging and recovery
-	router.Use(ginLogger(), gin.Recovery())
+	// Export traces when an OTLP endpoint is configured
+	shutdownTracing, err := setupTracing(context.Background(), config.OTLPEndpoint)
+	if err != nil {
+		logger.Error("Failed to set up tracing", "error", err, "endpoint", config.OTLPEndpoint)
+		os.Exit(1)
+	}
 
-	// Register routes
-	router.POST("/change", handleChange)
-	router.GET("/health", handleHealth)
+	router := newRouter()
 
-	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Open the job store, persisting to SQLite when DATABASE_URL or DB_PATH
+	// is set
+	jobStore, err := openStore(config)
+	if err != nil {
+		logger.Error("Failed to open job store", "error", err, "path", config.DBPath, "databaseURL", config.DatabaseURL)
+		os.Exit(1)
+	}
+	store = jobStore
+	if sqliteStore, ok := jobStore.(*SQLiteStore); ok {
+		readiness.register("database", sqliteStore.Ping)
+		defer sqliteStore.Close()
 	}
 
-	logger.Info("Starting API server", "port", port)
+	// Start processing queued changes, including any left over from a
+	// previous run
+	if err := recoverJobs(); err != nil {
+		logger.Error("Failed to recover jobs", "error", err)
+		os.Exit(1)
+	}
+	storeReadiness.set(nil)
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	workers := startWorkers(workerCtx, config.WorkerPoolSize)
+	workerReadiness.set(nil)
+	go runScheduler(workerCtx, config.SchedulerInterval)
 
-	if err := router.Run(":" + port); err != nil {
-		logger.Error("Failed to start server", "error", err)
+	// Start server
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
+
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		logger.Error("Failed to listen", "error", err, "address", addr)
 		os.Exit(1)
 	}
+
+	go func() {
+		logger.Info("Starting API server", "address", addr, "tls", tlsConfig != nil, "version", Version, "commit", Commit)
+
+		if err := serve(srv, listener, config); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Failed to start server", "error", err)
+			os.Exit(1)
+		}
+	}()
+
+	// Wait for a termination signal, then let in-flight requests finish
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+
+	logger.Info("Shutting down API server", "timeout", config.ShutdownTimeout.String())
+	storeReadiness.set(errors.New("shutting down"))
+	workerReadiness.set(errors.New("shutting down"))
+
+	if err := shutdownServer(srv, config.ShutdownTimeout); err != nil {
+		logger.Error("Server shutdown failed", "error", err)
+	}
+
+	// Changes that haven't started won't be run by this process, so report
+	// them as cancelled rather than leaving them pending
+	if n := cancelQueuedJobs("server shut down before the change started"); n > 0 {
+		logger.Info("Cancelled queued changes", "count", n)
+	}
+
+	stopWorkers()
+	workers.Wait()
+
+	// Let completion webhooks for the changes that just finished or were
+	// cancelled go out
+	completionWebhooks.Wait()
+
+	tracingCtx, cancelTracing := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancelTracing()
+	if err := shutdownTracing(tracingCtx); err != nil {
+		logger.Error("Failed to flush traces", "error", err)
+	}
+
+	logger.Info("API server stopped")
+}
+
+// newRouter creates the Gin engine with all middleware and routes registered
+func newRouter() *gin.Engine {
+	router := gin.New()
+
+	// Redirect paths with a trailing slash, such as /change/, to the route
+	// without it. gin answers GET with a 301 and other methods with a 307,
+	// so clients repeat a POST with its body rather than downgrading to GET.
+	router.RedirectTrailingSlash = true
+
+	// Add custom middleware for request IDs, tracing, logging, metrics,
+	// recovery, request timeouts, CORS and body size limits
+	router.Use(requestID(), countInFlight(inFlight), otelMiddleware(), ginLogger(), NewMetricsMiddleware(prometheus.DefaultRegisterer), ginRecovery(), ginTimeout(config.RequestTimeout), corsMiddleware(config.CORSAllowedOrigins), bodyLimit(config.MaxBodyBytes))
+
+	// Probes, metrics, build metadata and API docs stay unauthenticated so
+	// orchestrators, scrapers and clients can reach them
+	router.GET("/health", handleHealth)
+	router.GET("/ready", handleReadiness)
+	router.GET("/readyz", handleReadiness)
+	router.GET("/healthz/live", handleLiveness)
+	router.GET("/healthz/ready", handleReadiness)
+	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
+	router.GET("/openapi.json", handleOpenAPI)
+	router.GET("/docs", handleDocs)
+	router.GET("/version", handleVersion)
+
+	// Every route submitting changes draws on the same per-client bucket,
+	// so a client can't get around the limit by switching routes
+	submitLimit := rateLimiter(newClientLimiters(float64(config.RateLimitRPM)/60, config.RateLimitBurst))
+
+	// Register API routes
+	api := router.Group("/", ginAuth(), gzipEncoding(config.MaxBodyBytes, config.GzipLevel))
+	api.POST("/change", submitLimit, idempotency(), handleChange)
+	api.POST("/change/simple", handleSimpleChange)
+	api.POST("/change/batch-update", adminAuth(), handleBatchUpdate)
+	api.GET("/change/:id", handleChangeStatus)
+	api.DELETE("/change/:id", handleCancelChange)
+	api.POST("/change/:id/approve", handleApproveChange)
+	api.POST("/change/:id/reject", handleRejectChange)
+	api.POST("/change/:id/retry", submitLimit, handleRetryChange)
+	api.GET("/changes", handleListChanges)
+	api.GET("/changes/:id", handleGetChange)
+	api.DELETE("/changes/:id", handleDeleteChange)
+	api.POST("/changes/batch", submitLimit, handleBatchChange)
+	// gin can't escape ':' in a path, so this registers a wildcard segment
+	// after /changes; batchSubmitRoute lets only /changes:batch through
+	api.POST("/changes:batch", batchSubmitRoute, submitLimit, handleBatchChange)
+	api.GET("/stats", handleStats)
+	api.GET("/categories", handleListCategories)
+	api.GET("/agents", handleListAgents)
+	api.GET("/agents/status", handleAgentStatus)
+	api.PUT("/agents/:name", adminAuth(), handleUpdateAgent)
+	api.GET("/config", adminAuth(), handleConfig)
+	api.PUT("/admin/log-level", adminAuth(), handleSetLogLevel)
+	api.POST("/templates", handleCreateTemplate)
+	api.GET("/templates", handleListTemplates)
+	api.GET("/templates/:id", handleGetTemplate)
+	api.PUT("/templates/:id", handleUpdateTemplate)
+	api.DELETE("/templates/:id", handleDeleteTemplate)
+	api.POST("/templates/:id/instantiate", submitLimit, handleInstantiateTemplate)
+
+	return router
+}
+
+// listenAddress returns the address the server listens on for host and
+// port. An empty host listens on all interfaces. IPv6 hosts may be given
+// with or without brackets.
+func listenAddress(host, port string) (string, error) {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("PORT %q must be a number between 1 and 65535", port)
+	}
+
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.ContainsAny(host, "/ ") || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+		return "", fmt.Errorf("BIND_ADDRESS %q must be a hostname or IP address without a port", host)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// shutdownServer gracefully shuts srv down, waiting up to timeout for
+// in-flight requests to complete
+func shutdownServer(srv *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return srv.Shutdown(ctx)
 }
 
 // ginLogger is a middleware that logs requests using slog
 func ginLogger() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		start := time.Now()
 		path := c.Request.URL.Path
 		method := c.Request.Method
 
@@ -80,14 +430,17 @@ func ginLogger() gin.HandlerFunc {
 			"method", method,
 			"path", path,
 			"status", statusCode,
+			"latencyMs", time.Since(start).Milliseconds(),
 			"ip", c.ClientIP(),
+			"apiKey", c.GetString(apiKeyContextKey),
+			"requestId", c.GetString(requestIDContextKey),
 		)
 	}
 }
 
 // handleHealth handles health check requests
 func handleHealth(c *gin.Context) {
-	logger.Info("Health check requested")
+	requestLogger(c).Info("Health check requested")
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "healthy",
@@ -95,100 +448,630 @@ func handleHealth(c *gin.Context) {
 	})
 }
 
+// handleStats handles requests for service statistics
+func handleStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"queueDepth":         queue.len(),
+		"queueOldestSeconds": queue.oldestAge().Seconds(),
+		"inFlightRequests":   inFlight.Current(),
+		"inFlightPeak":       inFlight.Peak(),
+	})
+}
+
 // handleChange handles change request submissions
 func handleChange(c *gin.Context) {
+	markReceived(c)
+	log := requestLogger(c)
+
+	// ?dryRun=true asks for a dry run like spec.dryRun, for clients that
+	// validate a body before submitting it unchanged, and ?wait=true holds
+	// the request open until the change finishes
+	queryDryRun, ok := boolQuery(c, "dryRun", "invalid_dry_run")
+	if !ok {
+		return
+	}
+	wait, ok := boolQuery(c, "wait", "invalid_wait")
+	if !ok {
+		return
+	}
+	c.Set(waitContextKey, wait)
+
 	var change Change
+	var err error
 
-	// Bind and validate JSON
-	if err := c.ShouldBindJSON(&change); err != nil {
-		logger.Error("Failed to bind JSON", "error", err)
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "invalid_request",
-			Message: err.Error(),
+	// Bind and validate the body according to its content type, treating
+	// JSON as the default
+	contentType := c.ContentType()
+	switch {
+	case yamlContentTypes[contentType]:
+		err = bindYAML(c.Request.Body, &change)
+	case contentType == "" || contentType == binding.MIMEJSON || c.Request.ContentLength == 0:
+		// JSON bodies are checked against the Change schema before binding
+		var data []byte
+		if data, err = c.GetRawData(); err == nil {
+			if !checkChangeSchema(c, data) {
+				return
+			}
+			err = binding.JSON.BindBody(data, &change)
+		}
+	default:
+		log.Warn("Unsupported content type", "contentType", contentType)
+		respondError(c, http.StatusUnsupportedMediaType, ErrorResponse{
+			Error:   "unsupported_media_type",
+			Message: fmt.Sprintf("content type %q is not supported, use application/json or application/yaml", contentType),
 		})
 		return
 	}
 
-	// Validate kind field
-	if change.Kind != "Change" {
-		logger.Warn("Invalid kind field", "kind", change.Kind)
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "invalid_kind",
-			Message: "kind must be 'Change'",
-		})
+	if err != nil {
+		log.Error("Failed to bind request body", "error", err, "contentType", contentType)
+		respondBindError(c, err)
 		return
 	}
 
-	// Validate API version
-	if change.APIVersion == "" {
-		logger.Warn("Missing apiVersion field")
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "missing_api_version",
-			Message: "apiVersion is required",
+	if queryDryRun {
+		change.Spec.DryRun = true
+	}
+	submitChange(c, change)
+}
+
+// boolQuery parses the optional boolean query parameter name, responding
+// with a 400 carrying code and returning false when it isn't a boolean
+func boolQuery(c *gin.Context, name, code string) (bool, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return false, true
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		requestLogger(c).Warn("Invalid boolean query parameter", "param", name, "value", value)
+		respondError(c, http.StatusBadRequest, ErrorResponse{
+			Error:   code,
+			Message: name + " must be true or false",
 		})
+		return false, false
+	}
+	return b, true
+}
+
+// handleSimpleChange handles form-encoded change request submissions, for
+// clients such as shell scripts that can't easily produce JSON
+func handleSimpleChange(c *gin.Context) {
+	markReceived(c)
+
+	// PostForm ignores parse errors, so check for an oversized body first
+	if err := c.Request.ParseForm(); err != nil {
+		requestLogger(c).Error("Failed to parse form", "error", err)
+		respondBindError(c, err)
 		return
 	}
 
-	// Validate spec fields
-	if change.Spec.Prompt == "" {
-		logger.Warn("Missing prompt in spec")
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "missing_prompt",
-			Message: "spec.prompt is required",
-		})
+	var repos []string
+	for _, repo := range strings.Split(c.PostForm("repos"), ",") {
+		if repo = strings.TrimSpace(repo); repo != "" {
+			repos = append(repos, repo)
+		}
+	}
+
+	change := Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: c.PostForm("prompt"),
+			Repos:  repoRefs(repos...),
+			Agent:  c.PostForm("agent"),
+			Branch: c.PostForm("branch"),
+		},
+	}
+
+	submitChange(c, change)
+}
+
+// dryRunStatus is the status reported for a valid dry run, which creates no
+// job
+const dryRunStatus = "valid"
+
+// submitChange validates change, applies defaults and records it as a new
+// job, writing the outcome to the response
+func submitChange(c *gin.Context, change Change) {
+	log := requestLogger(c)
+
+	applyChangeDefaults(&change)
+	errResp := validateChange(change)
+	// Only valid agents are recorded so metrics labels stay bounded
+	if isValidAgent(change.Spec.Agent) {
+		c.Set(agentContextKey, change.Spec.Agent)
+	}
+	if errResp != nil {
+		log.Warn("Invalid change", "error", errResp.Error, "message", errResp.Message)
+		respondError(c, http.StatusBadRequest, *errResp)
 		return
 	}
 
-	if len(change.Spec.Repos) == 0 {
-		logger.Warn("No repositories specified")
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "missing_repos",
-			Message: "spec.repos must contain at least one repository",
-		})
+	// Validate hotfix
+	hotfixReason := strings.TrimSpace(c.GetHeader(hotfixReasonHeader))
+	if errResp := validateHotfix(change.Spec.Hotfix, hotfixReason); errResp != nil {
+		log.Warn("Invalid hotfix", "error", errResp.Error, "message", errResp.Message)
+		respondError(c, http.StatusBadRequest, *errResp)
 		return
 	}
 
-	if change.Spec.Agent == "" {
-		logger.Warn("Missing agent in spec")
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "missing_agent",
-			Message: "spec.agent is required",
-		})
+	// A dry run stops once the change is known to be valid, so no job is
+	// created, the agent never runs and no webhooks fire
+	if change.Spec.DryRun {
+		log.Info("Dry run change validated", "agent", change.Spec.Agent, "branch", change.Spec.Branch)
+		c.JSON(http.StatusOK, withServerTiming(c, gin.H{
+			"status":  dryRunStatus,
+			"message": "Dry run: change is valid and would be queued",
+			"change":  change,
+			"dryRun":  true,
+		}))
 		return
 	}
 
-	// Validate agent value
-	validAgents := map[string]bool{
-		"copilot-cli": true,
-		"gemini-cli":  true,
+	job, status, errResp := createJob(c, change, hotfixReason)
+	if errResp != nil {
+		respondError(c, status, *errResp)
+		return
 	}
-	if !validAgents[change.Spec.Agent] {
-		logger.Warn("Invalid agent specified", "agent", change.Spec.Agent)
-		c.JSON(http.StatusBadRequest, ErrorResponse{
-			Error:   "invalid_agent",
-			Message: "spec.agent must be either 'copilot-cli' or 'gemini-cli'",
-		})
+
+	if job.Status == statusDone {
+		c.JSON(http.StatusOK, withServerTiming(c, gin.H{
+			"status":  statusDone,
+			"message": "Change completed from cached result",
+			"id":      job.ID,
+			"change":  change,
+			"result":  job.Result,
+		}))
 		return
 	}
 
-	// Set default branch if not provided
-	if change.Spec.Branch == "" {
-		change.Spec.Branch = "main"
-		logger.Info("Using default branch", "branch", "main")
+	// A waiting client gets the change's final state instead, unless it
+	// is scheduled to run later
+	if c.GetBool(waitContextKey) && job.Status == statusPending {
+		respondWhenFinished(c, job)
+		return
+	}
+
+	// The change runs asynchronously; its progress is reported by
+	// GET /changes/:id
+	c.JSON(http.StatusAccepted, withServerTiming(c, gin.H{
+		"status":  job.Status,
+		"message": "Change request received successfully",
+		"id":      job.ID,
+		"change":  change,
+	}))
+}
+
+// createJob records the validated change as a new job and queues it, leaves
+// it scheduled when spec.runAt is in the future, or completes it straight
+// away when the result cache already holds its outcome. On failure it
+// returns the status code and error to report.
+func createJob(c *gin.Context, change Change, hotfixReason string) (Job, int, *ErrorResponse) {
+	log := requestLogger(c)
+
+	job := newJob(change)
+	job.TraceContext = injectTraceContext(c.Request.Context())
+	if change.Spec.Hotfix {
+		job.HotfixReason = hotfixReason
+		log.Warn("Hotfix change submitted", "id", job.ID, "reason", hotfixReason, "apiKey", c.GetString(apiKeyContextKey))
+	}
+	// The duplicate check and the Save below run under dedupMu, so identical
+	// submissions arriving together can't both pass the check
+	dedupMu.Lock()
+	duplicate, found, err := findDuplicate(job.ContentHash, job.CreatedAt)
+	if err != nil {
+		dedupMu.Unlock()
+		log.Error("Failed to check for duplicate changes", "error", err)
+		return Job{}, http.StatusInternalServerError, &ErrorResponse{
+			Error:   "internal_error",
+			Message: "failed to check for duplicate changes",
+		}
+	}
+	if found {
+		dedupMu.Unlock()
+		log.Warn("Duplicate change submitted", "existingId", duplicate.ID, "contentHash", job.ContentHash)
+		return Job{}, http.StatusConflict, &ErrorResponse{
+			Error:         "duplicate_change",
+			Message:       fmt.Sprintf("an identical change was submitted %s ago as %s", job.CreatedAt.Sub(duplicate.CreatedAt).Round(time.Second), duplicate.ID),
+			ExistingJobID: duplicate.ID,
+		}
+	}
+	cached, cacheHit := resultCache.Get(job.ContentHash)
+	scheduled := !cacheHit && isScheduled(change.Spec.RunAt)
+	if cacheHit {
+		now := time.Now().UTC()
+		job.Status = statusDone
+		job.StartedAt, job.FinishedAt = &now, &now
+		job.Result = &cached
+	}
+	if scheduled {
+		job.Status = statusScheduled
+	}
+	err = store.Save(job)
+	dedupMu.Unlock()
+	if err != nil {
+		var conflict *nameConflictError
+		if errors.As(err, &conflict) {
+			log.Warn("Change name conflict", "name", conflict.Name, "namespace", conflict.Namespace, "existingId", conflict.ExistingID)
+			return Job{}, http.StatusConflict, &ErrorResponse{
+				Error:   "name_conflict",
+				Message: err.Error(),
+			}
+		}
+		log.Error("Failed to store change", "error", err)
+		return Job{}, http.StatusInternalServerError, &ErrorResponse{
+			Error:   "internal_error",
+			Message: "failed to store change",
+		}
+	}
+	notifyAcceptance(job)
+
+	if cacheHit {
+		log.Info("Change served from result cache", "id", job.ID, "contentHash", job.ContentHash)
+		notifyCompletion(job)
+		return job, http.StatusOK, nil
+	}
+	if scheduled {
+		log.Info("Change scheduled", "id", job.ID, "runAt", change.Spec.RunAt)
+		return job, http.StatusAccepted, nil
 	}
+	enqueue(job)
 
 	// Log successful change request
-	logger.Info("Change request received",
+	log.Info("Change request received",
+		"id", job.ID,
 		"prompt", change.Spec.Prompt,
-		"repos", change.Spec.Repos,
+		"repos", repoURLs(change.Spec.Repos),
 		"agent", change.Spec.Agent,
 		"branch", change.Spec.Branch,
 	)
 
-	// Return success response
+	return job, http.StatusAccepted, nil
+}
+
+// handleChangeStatus handles change status requests
+func handleChangeStatus(c *gin.Context) {
+	id := c.Param("id")
+
+	job, ok := lookupJob(c, id)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// validateObservabilityIntegration checks cfg, returning nil when it is
+// valid or unset
+func validateObservabilityIntegration(cfg *OIConfig) *ErrorResponse {
+	if cfg == nil {
+		return nil
+	}
+
+	if !observabilityTypes[cfg.Type] {
+		return &ErrorResponse{
+			Error:   "unsupported_observability_type",
+			Message: fmt.Sprintf("spec.observabilityIntegration.type %q is not supported, must be 'opentelemetry' or 'datadog'", cfg.Type),
+		}
+	}
+
+	endpoints := []struct {
+		field string
+		value string
+	}{
+		{"metricsEndpoint", cfg.MetricsEndpoint},
+		{"traceEndpoint", cfg.TraceEndpoint},
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.value != "" && !isHTTPSURL(endpoint.value) {
+			return &ErrorResponse{
+				Error:   "invalid_observability_endpoint",
+				Message: fmt.Sprintf("spec.observabilityIntegration.%s must be an HTTPS URL", endpoint.field),
+			}
+		}
+	}
+
+	return nil
+}
+
+// isHTTPSURL reports whether s is an absolute https URL with a host
+func isHTTPSURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// maxRepoURLLength is the longest repository URL accepted
+const maxRepoURLLength = 2048
+
+// Repository URL forms accepted by validateRepoURL. The host is captured in
+// the first group of each.
+var (
+	repoURLPattern = regexp.MustCompile(`^(?:https|git|ssh)://(?:[^@/\s]+@)?(\[[0-9A-Fa-f:.]+\]|[^/:?#@\s]+)(?::[0-9]+)?(?:/\S*)?$`)
+	scpRepoPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+@(\[[0-9A-Fa-f:.]+\]|[^/:@\s]+):\S+$`)
+)
+
+// validateRepoURL checks that repo is a well-formed Git remote URL pointing at
+// a public host. It accepts https:// and git:// URLs as well as SSH remotes,
+// either as ssh:// URLs or in the scp-like git@host:path form. Hosts are
+// checked as written; names are not resolved.
+func validateRepoURL(repo string) error {
+	if repo == "" {
+		return errors.New("repository URL is empty")
+	}
+	if len(repo) > maxRepoURLLength {
+		return fmt.Errorf("repository URL is %d characters long, maximum allowed is %d", len(repo), maxRepoURLLength)
+	}
+
+	var match []string
+	if scheme, _, ok := strings.Cut(repo, "://"); ok {
+		switch scheme {
+		case "https", "git", "ssh":
+		default:
+			return fmt.Errorf("unsupported scheme %q, expected https, git or ssh", scheme)
+		}
+		match = repoURLPattern.FindStringSubmatch(repo)
+	} else {
+		match = scpRepoPattern.FindStringSubmatch(repo)
+	}
+	if match == nil {
+		return errors.New("expected an https://, git:// or ssh:// URL with a host, or git@host:path")
+	}
+
+	host := strings.Trim(match[1], "[]")
+	if isPrivateHost(host) {
+		return fmt.Errorf("host %q is local or private", host)
+	}
+
+	return nil
+}
+
+// isPrivateHost reports whether host is localhost or a loopback, private,
+// link-local or unspecified IP address
+func isPrivateHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified()
+}
+
+// validateBranchName checks that branch is a valid Git branch name, following
+// the rules of git check-ref-format --branch
+func validateBranchName(branch string) error {
+	switch {
+	case branch == "":
+		return errors.New("branch name is empty")
+	case branch == "@":
+		return errors.New("branch name cannot be '@'")
+	case strings.HasPrefix(branch, "-"):
+		return errors.New("branch name cannot begin with '-'")
+	case strings.HasPrefix(branch, "/") || strings.HasSuffix(branch, "/"):
+		return errors.New("branch name cannot begin or end with '/'")
+	case strings.HasSuffix(branch, "."):
+		return errors.New("branch name cannot end with '.'")
+	case strings.Contains(branch, "//"):
+		return errors.New("branch name cannot contain '//'")
+	case strings.Contains(branch, ".."):
+		return errors.New("branch name cannot contain '..'")
+	case strings.Contains(branch, "@{"):
+		return errors.New("branch name cannot contain '@{'")
+	}
+
+	for _, r := range branch {
+		if r < 0x20 || r == 0x7f {
+			return errors.New("branch name cannot contain control characters")
+		}
+		if strings.ContainsRune(" ~^:?*[\\", r) {
+			return fmt.Errorf("branch name cannot contain %q", r)
+		}
+	}
+
+	for _, component := range strings.Split(branch, "/") {
+		if strings.HasPrefix(component, ".") {
+			return fmt.Errorf("path component %q cannot begin with '.'", component)
+		}
+		if strings.HasSuffix(component, ".lock") {
+			return fmt.Errorf("path component %q cannot end with '.lock'", component)
+		}
+	}
+
+	return nil
+}
+
+// handleCancelChange handles requests to cancel a pending or running change
+func handleCancelChange(c *gin.Context) {
+	log := requestLogger(c)
+
+	id := c.Param("id")
+
+	job, cancelled, err := cancelJob(id, "")
+	if err != nil {
+		respondJobError(c, id, err)
+		return
+	}
+
+	if !cancelled {
+		log.Warn("Change already finished", "id", id, "status", job.Status)
+		respondError(c, http.StatusConflict, ErrorResponse{
+			Error:   "change_not_cancellable",
+			Message: fmt.Sprintf("change %q is already %s", id, job.Status),
+		})
+		return
+	}
+
+	log.Info("Change cancelled", "id", id)
+
+	c.JSON(http.StatusOK, job)
+}
+
+// handleDeleteChange handles requests to remove a change from the store. A
+// running change's worker is stopped, and a queued change is skipped when
+// its turn comes.
+func handleDeleteChange(c *gin.Context) {
+	log := requestLogger(c)
+
+	id := c.Param("id")
+
+	if err := store.Delete(id); err != nil {
+		respondJobError(c, id, err)
+		return
+	}
+	if cancelRunningJob(id) {
+		log.Info("Stopping running change", "id", id)
+	}
+
+	log.Info("Change deleted", "id", id)
+
+	c.Status(http.StatusNoContent)
+}
+
+// handleGetChange handles requests for a previously submitted change
+func handleGetChange(c *gin.Context) {
+	id := c.Param("id")
+
+	job, ok := lookupJob(c, id)
+	if !ok {
+		return
+	}
+
+	response := gin.H{
+		"id":     job.ID,
+		"status": job.Status,
+		"change": job.Change,
+	}
+	if job.Result != nil {
+		response["result"] = job.Result
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// lookupJob fetches the job with the given ID, writing an error response and
+// returning false if it can't be found
+func lookupJob(c *gin.Context, id string) (Job, bool) {
+	job, err := store.Get(id)
+	if err != nil {
+		respondJobError(c, id, err)
+		return Job{}, false
+	}
+	return job, true
+}
+
+// respondJobError writes the error response for a failed lookup or update of
+// the job with the given ID
+func respondJobError(c *gin.Context, id string, err error) {
+	log := requestLogger(c)
+
+	if errors.Is(err, ErrJobNotFound) {
+		log.Warn("Change not found", "id", id)
+		respondError(c, http.StatusNotFound, ErrorResponse{
+			Error:   "change_not_found",
+			Message: fmt.Sprintf("no change with id %q", id),
+		})
+		return
+	}
+
+	log.Error("Failed to access change", "id", id, "error", err)
+	respondError(c, http.StatusInternalServerError, ErrorResponse{
+		Error:   "internal_error",
+		Message: "failed to access change",
+	})
+}
+
+// handleListChanges handles requests to list submitted changes
+func handleListChanges(c *gin.Context) {
+	log := requestLogger(c)
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultListLimit)))
+	if err != nil || limit < 1 || limit > maxListLimit {
+		log.Warn("Invalid limit", "limit", c.Query("limit"))
+		respondError(c, http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_pagination",
+			Message: fmt.Sprintf("limit must be an integer between 1 and %d", maxListLimit),
+		})
+		return
+	}
+
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		log.Warn("Invalid offset", "offset", c.Query("offset"))
+		respondError(c, http.StatusBadRequest, ErrorResponse{
+			Error:   "invalid_pagination",
+			Message: "offset must be a non-negative integer",
+		})
+		return
+	}
+
+	labels, errResp := parseLabelSelectors(c.QueryArray("label"))
+	if errResp != nil {
+		log.Warn("Invalid label selector", "label", c.QueryArray("label"))
+		respondError(c, http.StatusBadRequest, *errResp)
+		return
+	}
+
+	filter := JobFilter{Category: c.Query("category"), Status: c.Query("status"), Labels: labels}
+
+	// Pending changes are listed in the order workers will pick them up
+	list := store.List
+	if filter.Status == statusPending {
+		list = listQueuedJobs
+	}
+
+	page, total, err := list(offset, limit, filter)
+	if err != nil {
+		log.Error("Failed to list changes", "error", err)
+		respondError(c, http.StatusInternalServerError, ErrorResponse{
+			Error:   "internal_error",
+			Message: "failed to list changes",
+		})
+		return
+	}
+
+	items := make([]JobSummary, 0, len(page))
+	for _, job := range page {
+		items = append(items, job.summary())
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status":  "accepted",
-		"message": "Change request received successfully",
-		"change":  change,
+		"total":  total,
+		"offset": offset,
+		"limit":  limit,
+		"items":  items,
 	})
 }
+
+// listQueuedJobs is a Store.List for the pending jobs waiting in the queue,
+// ordered by priority and then by when they were queued
+func listQueuedJobs(offset, limit int, filter JobFilter) ([]Job, int, error) {
+	var matched []Job
+	for _, id := range queue.ids() {
+		job, err := store.Get(id)
+		// Deleted jobs and jobs cancelled while queued are still in the
+		// queue until a worker skips them
+		if errors.Is(err, ErrJobNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		if job.Status == statusPending && filter.matches(job) {
+			matched = append(matched, job)
+		}
+	}
+
+	total := len(matched)
+	if offset >= total {
+		return []Job{}, total, nil
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return matched[offset:end], total, nil
+}
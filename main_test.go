@@ -2,14 +2,30 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+func TestMain(m *testing.M) {
+	// Most tests submit the same few changes over and over, so duplicate
+	// detection is off unless a test turns it on
+	config.DedupWindow = 0
+
+	os.Exit(m.Run())
+}
+
 func TestHealthEndpoint(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
@@ -43,7 +59,7 @@ func TestChangeEndpointValid(t *testing.T) {
 		APIVersion: "v1",
 		Spec: ChangeSpec{
 			Prompt: "Add comprehensive error handling to all HTTP handlers",
-			Repos:  []string{"https://github.com/myorg/repo1", "https://github.com/myorg/repo2"},
+			Repos:  repoRefs("https://github.com/myorg/repo1", "https://github.com/myorg/repo2"),
 			Agent:  "copilot-cli",
 			Branch: "main",
 		},
@@ -55,8 +71,8 @@ func TestChangeEndpointValid(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", w.Code)
 	}
 
 	var response map[string]interface{}
@@ -64,8 +80,8 @@ func TestChangeEndpointValid(t *testing.T) {
 		t.Fatalf("Failed to unmarshal response: %v", err)
 	}
 
-	if response["status"] != "accepted" {
-		t.Errorf("Expected status 'accepted', got '%v'", response["status"])
+	if response["status"] != "pending" {
+		t.Errorf("Expected status 'pending', got '%v'", response["status"])
 	}
 }
 
@@ -79,7 +95,7 @@ func TestChangeEndpointDefaultBranch(t *testing.T) {
 		APIVersion: "v1",
 		Spec: ChangeSpec{
 			Prompt: "Test prompt",
-			Repos:  []string{"https://github.com/myorg/repo1"},
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
 			Agent:  "gemini-cli",
 			// Branch is omitted - should default to "main"
 		},
@@ -91,8 +107,8 @@ func TestChangeEndpointDefaultBranch(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	if w.Code != http.StatusOK {
-		t.Errorf("Expected status 200, got %d", w.Code)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202, got %d", w.Code)
 	}
 
 	var response map[string]interface{}
@@ -143,7 +159,7 @@ func TestChangeEndpointInvalidAgent(t *testing.T) {
 		APIVersion: "v1",
 		Spec: ChangeSpec{
 			Prompt: "Test",
-			Repos:  []string{"https://github.com/myorg/repo1"},
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
 			Agent:  "invalid-agent",
 		},
 	}
@@ -166,6 +182,174 @@ func TestChangeEndpointInvalidAgent(t *testing.T) {
 	if response.Error != "invalid_agent" {
 		t.Errorf("Expected error 'invalid_agent', got '%s'", response.Error)
 	}
+
+	want := "spec.agent must be one of 'claude-cli', 'copilot-cli' or 'gemini-cli'"
+	if response.Message != want {
+		t.Errorf("Expected message %q, got %q", want, response.Message)
+	}
+}
+
+func TestChangeEndpointClaudeAgent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	w := postJSON(router, "/change", Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Test",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "claude-cli",
+		},
+	})
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected claude-cli to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestChangeEndpointConfiguredAgents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("VALID_AGENTS", "aider, copilot-cli")
+	setConfig(t, loadConfig())
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	submit := func(agent string) *httptest.ResponseRecorder {
+		return postJSON(router, "/change", Change{
+			Kind:       "Change",
+			APIVersion: "v1",
+			Spec: ChangeSpec{
+				Prompt: "Test",
+				Repos:  repoRefs("https://github.com/myorg/repo1"),
+				Agent:  agent,
+			},
+		})
+	}
+
+	if w := submit("aider"); w.Code != http.StatusAccepted {
+		t.Errorf("Expected configured agent to be accepted, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w := submit("gemini-cli")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected agent missing from VALID_AGENTS to be rejected, got %d", w.Code)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	want := "spec.agent must be one of 'aider' or 'copilot-cli'"
+	if response.Error != "invalid_agent" || response.Message != want {
+		t.Errorf("Expected invalid_agent with message %q, got '%s' %q", want, response.Error, response.Message)
+	}
+}
+
+func TestErrorResponseHelpURL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+	router.GET("/change/:id", handleChangeStatus)
+
+	invalidAgent := Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Test",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "invalid-agent",
+		},
+	}
+
+	var response ErrorResponse
+	w := postJSON(router, "/change", invalidAgent)
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.HelpURL != "" {
+		t.Errorf("Expected no helpURL without ERROR_HELP_BASE_URL, got '%s'", response.HelpURL)
+	}
+
+	t.Setenv("ERROR_HELP_BASE_URL", "https://docs.example.com/errors/")
+	setConfig(t, loadConfig())
+
+	tests := []struct {
+		name string
+		do   func() *httptest.ResponseRecorder
+		code string
+	}{
+		{"validation error", func() *httptest.ResponseRecorder { return postJSON(router, "/change", invalidAgent) }, "invalid_agent"},
+		{"lookup error", func() *httptest.ResponseRecorder {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/change/missing", nil)
+			router.ServeHTTP(w, req)
+			return w
+		}, "change_not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response ErrorResponse
+			if err := json.Unmarshal(tt.do().Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			want := "https://docs.example.com/errors/" + tt.code
+			if response.Error != tt.code || response.HelpURL != want {
+				t.Errorf("Expected '%s' with helpURL '%s', got '%s' with '%s'", tt.code, want, response.Error, response.HelpURL)
+			}
+		})
+	}
+}
+
+func TestChangeEndpointAPIVersion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	tests := []struct {
+		name       string
+		apiVersion string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "supported", apiVersion: "v1", wantStatus: http.StatusAccepted},
+		{name: "unknown", apiVersion: "v1beta", wantStatus: http.StatusBadRequest, wantError: "unsupported_api_version"},
+		// The JSON binding rejects a missing apiVersion before validation runs
+		{name: "empty", apiVersion: "", wantStatus: http.StatusBadRequest, wantError: "missing_api_version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, "/change", Change{
+				Kind:       "Change",
+				APIVersion: tt.apiVersion,
+				Spec: ChangeSpec{
+					Prompt: "Test",
+					Repos:  repoRefs("https://github.com/myorg/repo1"),
+					Agent:  "copilot-cli",
+				},
+			})
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if tt.wantError == "" {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got '%s'", tt.wantError, response.Error)
+			}
+			if tt.wantError == "unsupported_api_version" && !strings.Contains(response.Message, "'v1'") {
+				t.Errorf("Expected message to list supported versions, got %q", response.Message)
+			}
+		})
+	}
 }
 
 func TestChangeEndpointMissingPrompt(t *testing.T) {
@@ -203,7 +387,7 @@ func TestChangeEndpointEmptyRepos(t *testing.T) {
 		APIVersion: "v1",
 		Spec: ChangeSpec{
 			Prompt: "Test",
-			Repos:  []string{}, // Empty repos
+			Repos:  repoRefs(), // Empty repos
 			Agent:  "copilot-cli",
 		},
 	}
@@ -227,3 +411,1634 @@ func TestChangeEndpointEmptyRepos(t *testing.T) {
 		t.Errorf("Expected error 'missing_repos', got '%s'", response.Error)
 	}
 }
+
+func TestChangeEndpointDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		t.Error("Expected a dry run not to call the agent")
+		return ChangeResult{}, nil
+	})
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	valid := Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Add retries",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "copilot-cli",
+			DryRun: true,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		mutate     func(c *Change)
+		wantStatus int
+		wantError  string
+	}{
+		{"valid", func(c *Change) {}, http.StatusOK, ""},
+		{"invalid branch", func(c *Change) { c.Spec.Branch = "feature..x" }, http.StatusBadRequest, "invalid_branch"},
+		{"invalid repo", func(c *Change) { c.Spec.Repos = repoRefs("not a url") }, http.StatusBadRequest, "invalid_repo"},
+		{"invalid agent", func(c *Change) { c.Spec.Agent = "unknown-agent" }, http.StatusBadRequest, "invalid_agent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change := valid
+			tt.mutate(&change)
+
+			w := postJSON(router, "/change", change)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if tt.wantError != "" {
+				if response["error"] != tt.wantError {
+					t.Errorf("Expected error '%s', got '%v'", tt.wantError, response["error"])
+				}
+				return
+			}
+			if response["dryRun"] != true {
+				t.Errorf("Expected dryRun true, got %v", response["dryRun"])
+			}
+			if response["status"] != dryRunStatus || response["change"] == nil {
+				t.Errorf("Expected the submission response shape, got %v", response)
+			}
+			if _, ok := response["id"]; ok {
+				t.Errorf("Expected no id for a dry run, got %v", response["id"])
+			}
+		})
+	}
+
+	if _, total, _ := store.List(0, 1, JobFilter{}); total != 0 {
+		t.Errorf("Expected no changes to be stored, got %d", total)
+	}
+	if depth := queue.len(); depth != 0 {
+		t.Errorf("Expected no changes to be queued, got %d", depth)
+	}
+}
+
+func TestChangeEndpointDryRunQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		t.Error("Expected a dry run not to call the agent")
+		return ChangeResult{}, nil
+	})
+
+	var notified []string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		notified = append(notified, r.URL.Path)
+	}))
+	defer hook.Close()
+	cfg := config
+	cfg.WebhookURL = hook.URL
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	valid := Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Add retries",
+			Repos:  repoRefs("https://GitHub.com/myorg/repo1.git"),
+			Agent:  "copilot-cli",
+		},
+	}
+
+	w := postJSON(router, "/change?dryRun=true", valid)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var response struct {
+		Status string  `json:"status"`
+		ID     string  `json:"id"`
+		DryRun bool    `json:"dryRun"`
+		Change *Change `json:"change"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Status != dryRunStatus || !response.DryRun || response.ID != "" {
+		t.Errorf("Expected a valid dry run without an id, got %s", w.Body.String())
+	}
+	// The change is echoed with its defaults applied and repos normalized
+	if response.Change == nil || response.Change.Spec.Branch != config.DefaultBranch || response.Change.Spec.Repos[0].URL != "https://github.com/myorg/repo1" {
+		t.Errorf("Expected the normalized change, got %+v", response.Change)
+	}
+
+	invalid := valid
+	invalid.Spec.Branch = "feature..x"
+	w = postJSON(router, "/change?dryRun=true", invalid)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("Failed to unmarshal error: %v", err)
+	}
+	if errResp.Error != "invalid_branch" {
+		t.Errorf("Expected error 'invalid_branch', got '%s'", errResp.Error)
+	}
+
+	w = postJSON(router, "/change?dryRun=maybe", valid)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_dry_run") {
+		t.Errorf("Expected 400 invalid_dry_run, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if _, total, _ := store.List(0, 1, JobFilter{}); total != 0 {
+		t.Errorf("Expected no changes to be stored, got %d", total)
+	}
+	if depth := queue.len(); depth != 0 {
+		t.Errorf("Expected no changes to be queued, got %d", depth)
+	}
+
+	// dryRun=false submits as usual
+	w = postJSON(router, "/change?dryRun=false", valid)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	completionWebhooks.Wait()
+	if len(notified) != 1 {
+		t.Errorf("Expected only the real submission to be notified, got %d notifications", len(notified))
+	}
+}
+
+func TestChangeEndpointMultipleErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	invalidChange := map[string]interface{}{
+		"kind":       "Change",
+		"apiVersion": "v1",
+		"spec": map[string]interface{}{
+			"repos":  []string{},
+			"agent":  "unknown-agent",
+			"branch": "feature..x",
+		},
+	}
+
+	w := postJSON(router, "/change", invalidChange)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	want := []FieldError{
+		{Field: "spec.prompt", Code: "missing_prompt"},
+		{Field: "spec.repos", Code: "missing_repos"},
+		{Field: "spec.agent", Code: "invalid_agent"},
+		{Field: "spec.branch", Code: "invalid_branch"},
+	}
+	if len(response.Errors) != len(want) {
+		t.Fatalf("Expected %d errors, got %d: %+v", len(want), len(response.Errors), response.Errors)
+	}
+	for i, got := range response.Errors {
+		if got.Field != want[i].Field || got.Code != want[i].Code {
+			t.Errorf("Error %d: expected %s on %s, got %s on %s", i, want[i].Code, want[i].Field, got.Code, got.Field)
+		}
+		if got.Message == "" {
+			t.Errorf("Error %d: expected a message", i)
+		}
+	}
+
+	// The top-level fields still describe the first failure
+	if response.Error != "missing_prompt" || response.Message != response.Errors[0].Message {
+		t.Errorf("Expected the top-level error to match the first, got %s: %s", response.Error, response.Message)
+	}
+}
+
+func TestChangeEndpointRepoValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	tests := []struct {
+		name       string
+		repos      []string
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name:       "https URL",
+			repos:      []string{"https://github.com/myorg/repo1"},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "git URL",
+			repos:      []string{"git://github.com/myorg/repo1.git"},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "ssh-style git@ URL",
+			repos:      []string{"git@github.com:myorg/repo1.git"},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "mixed https and ssh-style URLs",
+			repos:      []string{"https://github.com/myorg/repo1", "git@github.com:myorg/repo2.git"},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "empty string",
+			repos:      []string{""},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_repo",
+		},
+		{
+			name:       "not a URL",
+			repos:      []string{"not a url"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_repo",
+		},
+		{
+			name:       "unsupported scheme",
+			repos:      []string{"ftp://example.com/myorg/repo1"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_repo",
+		},
+		{
+			name:       "missing host",
+			repos:      []string{"https:///myorg/repo1"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_repo",
+		},
+		{
+			name:       "ssh URL with port",
+			repos:      []string{"ssh://git@github.com:2222/myorg/repo1.git"},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "localhost",
+			repos:      []string{"https://localhost/myorg/repo1"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_repo",
+		},
+		{
+			name:       "loopback IP",
+			repos:      []string{"https://127.0.0.1:8443/myorg/repo1"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_repo",
+		},
+		{
+			name:       "private IP",
+			repos:      []string{"git://10.0.0.5/myorg/repo1.git"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_repo",
+		},
+		{
+			name:       "private IP in ssh-style URL",
+			repos:      []string{"git@192.168.1.10:myorg/repo1.git"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_repo",
+		},
+		{
+			name:       "IPv6 loopback",
+			repos:      []string{"ssh://git@[::1]/myorg/repo1.git"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_repo",
+		},
+		{
+			name:       "too long",
+			repos:      []string{"https://github.com/myorg/" + strings.Repeat("a", maxRepoURLLength)},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_repo",
+		},
+		{
+			name:       "duplicate entries",
+			repos:      []string{"https://github.com/myorg/repo1", "https://github.com/myorg/repo1"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "duplicate_repo",
+		},
+		{
+			name:       "duplicate spellings",
+			repos:      []string{"https://github.com/myorg/repo1", "https://github.com/myorg/repo1.git", "https://github.com/myorg/repo1/"},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "duplicate_repo",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change := Change{
+				Kind:       "Change",
+				APIVersion: "v1",
+				Spec: ChangeSpec{
+					Prompt: "Test",
+					Repos:  repoRefs(tt.repos...),
+					Agent:  "copilot-cli",
+				},
+			}
+
+			jsonData, _ := json.Marshal(change)
+			req, _ := http.NewRequest("POST", "/change", bytes.NewBuffer(jsonData))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			if tt.wantError == "" {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if response.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got '%s'", tt.wantError, response.Error)
+			}
+		})
+	}
+}
+
+// postJSON marshals body and POSTs it to path on router
+func postJSON(router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestChangeEndpointPromptLength(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("MAX_PROMPT_LENGTH", "10")
+	setConfig(t, loadConfig())
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	tests := []struct {
+		name       string
+		prompt     string
+		wantStatus int
+	}{
+		{name: "under limit", prompt: "short", wantStatus: http.StatusAccepted},
+		{name: "at limit", prompt: "0123456789", wantStatus: http.StatusAccepted},
+		{name: "multibyte at limit", prompt: "ééééééééé€", wantStatus: http.StatusAccepted},
+		{name: "over limit", prompt: "0123456789a", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, "/change", Change{
+				Kind:       "Change",
+				APIVersion: "v1",
+				Spec: ChangeSpec{
+					Prompt: tt.prompt,
+					Repos:  repoRefs("https://github.com/myorg/repo1"),
+					Agent:  "copilot-cli",
+				},
+			})
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			if tt.wantStatus == http.StatusAccepted {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if response.Error != "prompt_too_long" {
+				t.Errorf("Expected error 'prompt_too_long', got '%s'", response.Error)
+			}
+		})
+	}
+}
+
+func TestChangeEndpointMaxRepos(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("MAX_REPOS", "2")
+	setConfig(t, loadConfig())
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	repos := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = fmt.Sprintf("https://github.com/myorg/repo%d", i)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name       string
+		repos      []string
+		wantStatus int
+	}{
+		{name: "at limit", repos: repos(2), wantStatus: http.StatusAccepted},
+		{name: "over limit", repos: repos(3), wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, "/change", Change{
+				Kind:       "Change",
+				APIVersion: "v1",
+				Spec: ChangeSpec{
+					Prompt: "Test",
+					Repos:  repoRefs(tt.repos...),
+					Agent:  "copilot-cli",
+				},
+			})
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			if tt.wantStatus == http.StatusAccepted {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if response.Error != "too_many_repos" {
+				t.Errorf("Expected error 'too_many_repos', got '%s'", response.Error)
+			}
+			if !strings.Contains(response.Message, "maximum allowed is 2") {
+				t.Errorf("Expected the message to state the limit, got '%s'", response.Message)
+			}
+		})
+	}
+}
+
+func TestChangeEndpointMaxOutputSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	tests := []struct {
+		name       string
+		maxKB      int
+		wantStatus int
+	}{
+		{name: "no cap", maxKB: 0, wantStatus: http.StatusAccepted},
+		{name: "minimum", maxKB: 1, wantStatus: http.StatusAccepted},
+		{name: "maximum", maxKB: maxOutputSizeKBLimit, wantStatus: http.StatusAccepted},
+		{name: "above maximum", maxKB: maxOutputSizeKBLimit + 1, wantStatus: http.StatusBadRequest},
+		{name: "negative", maxKB: -1, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, "/change", Change{
+				Kind:       "Change",
+				APIVersion: "v1",
+				Spec: ChangeSpec{
+					Prompt:          "Test",
+					Repos:           repoRefs("https://github.com/myorg/repo1"),
+					Agent:           "copilot-cli",
+					MaxOutputSizeKB: tt.maxKB,
+				},
+			})
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestChangeEndpointMaxTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	tests := []struct {
+		name       string
+		maxTokens  int
+		wantStatus int
+	}{
+		{name: "agent default", maxTokens: 0, wantStatus: http.StatusAccepted},
+		{name: "maximum", maxTokens: maxTokensLimit, wantStatus: http.StatusAccepted},
+		{name: "above maximum", maxTokens: maxTokensLimit + 1, wantStatus: http.StatusBadRequest},
+		{name: "negative", maxTokens: -1, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, "/change", Change{
+				Kind:       "Change",
+				APIVersion: "v1",
+				Spec: ChangeSpec{
+					Prompt:    "Test",
+					Repos:     repoRefs("https://github.com/myorg/repo1"),
+					Agent:     "copilot-cli",
+					MaxTokens: tt.maxTokens,
+				},
+			})
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusBadRequest {
+				var response ErrorResponse
+				json.Unmarshal(w.Body.Bytes(), &response)
+				if response.Error != "invalid_max_tokens" {
+					t.Errorf("Expected error 'invalid_max_tokens', got '%s'", response.Error)
+				}
+			}
+		})
+	}
+}
+
+func TestChangeStatusEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+	router.GET("/change/:id", handleChangeStatus)
+
+	w := postJSON(router, "/change", Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Test prompt",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "copilot-cli",
+		},
+	})
+
+	var submitted map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &submitted); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	id, _ := submitted["id"].(string)
+	if id == "" {
+		t.Fatalf("Expected id in response, got %v", submitted)
+	}
+
+	req, _ := http.NewRequest("GET", "/change/"+id, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var job Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if job.ID != id {
+		t.Errorf("Expected id '%s', got '%s'", id, job.ID)
+	}
+	if job.Status != statusPending {
+		t.Errorf("Expected status '%s', got '%s'", statusPending, job.Status)
+	}
+	if job.CreatedAt.IsZero() {
+		t.Error("Expected createdAt to be set")
+	}
+	if job.Change.Spec.Prompt != "Test prompt" {
+		t.Errorf("Expected original change in response, got %+v", job.Change)
+	}
+}
+
+func TestChangeStatusEndpointNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/change/:id", handleChangeStatus)
+
+	req, _ := http.NewRequest("GET", "/change/does-not-exist", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.Error != "change_not_found" {
+		t.Errorf("Expected error 'change_not_found', got '%s'", response.Error)
+	}
+}
+
+func TestValidateBranchName(t *testing.T) {
+	tests := []struct {
+		branch string
+		valid  bool
+	}{
+		{"main", true},
+		{"feature/add-retries", true},
+		{"feature/foo-123", true},
+		{"release-1.2", true},
+		{"user/jane/fix_bug", true},
+		{"v1.0@2", true},
+		{"", false},
+		{"@", false},
+		{"-leading-dash", false},
+		{"/leading-slash", false},
+		{"trailing-slash/", false},
+		{"double//slash", false},
+		{"trailing-dot.", false},
+		{"two..dots", false},
+		{"reflog@{1}", false},
+		{".hidden", false},
+		{"feature/.hidden", false},
+		{"branch.lock", false},
+		{"feature/branch.lock/child", false},
+		{"with space", false},
+		{"tilde~1", false},
+		{"caret^", false},
+		{"colon:branch", false},
+		{"question?", false},
+		{"star*", false},
+		{"open[bracket", false},
+		{"back\\slash", false},
+		{"control\tchar", false},
+		{"delete\x7f", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.branch, func(t *testing.T) {
+			err := validateBranchName(tt.branch)
+			if tt.valid && err != nil {
+				t.Errorf("Expected %q to be valid, got %v", tt.branch, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("Expected %q to be rejected", tt.branch)
+			}
+		})
+	}
+}
+
+func TestChangeEndpointInvalidBranch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	tests := []struct {
+		branch     string
+		wantStatus int
+	}{
+		{branch: "feature/foo-123", wantStatus: http.StatusAccepted},
+		{branch: "feature..x", wantStatus: http.StatusBadRequest},
+		{branch: "feature branch with spaces", wantStatus: http.StatusBadRequest},
+		{branch: "hotfix.lock", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.branch, func(t *testing.T) {
+			w := postJSON(router, "/change", Change{
+				Kind:       "Change",
+				APIVersion: "v1",
+				Spec: ChangeSpec{
+					Prompt: "Test",
+					Repos:  repoRefs("https://github.com/myorg/repo1"),
+					Agent:  "copilot-cli",
+					Branch: tt.branch,
+				},
+			})
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+			if tt.wantStatus != http.StatusBadRequest {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Error != "invalid_branch" {
+				t.Errorf("Expected error 'invalid_branch', got '%s'", response.Error)
+			}
+			if !strings.Contains(response.Message, tt.branch) {
+				t.Errorf("Expected the message to name the branch, got '%s'", response.Message)
+			}
+		})
+	}
+}
+
+func TestChangeEndpointInvalidImpactScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	w := postJSON(router, "/change", Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt:      "Test",
+			Repos:       repoRefs("https://github.com/myorg/repo1"),
+			Agent:       "copilot-cli",
+			ImpactScope: &ImpactScopeConfig{MaxDownstreamServices: -1},
+		},
+	})
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.Error != "invalid_impact_scope" {
+		t.Errorf("Expected error 'invalid_impact_scope', got '%s'", response.Error)
+	}
+}
+
+func TestSimpleChangeEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change/simple", handleSimpleChange)
+
+	tests := []struct {
+		name       string
+		form       url.Values
+		wantStatus int
+		wantError  string
+	}{
+		{
+			name: "valid",
+			form: url.Values{
+				"prompt": {"Test prompt"},
+				"repos":  {"https://github.com/myorg/repo1, https://github.com/myorg/repo2"},
+				"agent":  {"copilot-cli"},
+			},
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name: "missing prompt",
+			form: url.Values{
+				"repos": {"https://github.com/myorg/repo1"},
+				"agent": {"copilot-cli"},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "missing_prompt",
+		},
+		{
+			name: "missing repos",
+			form: url.Values{
+				"prompt": {"Test prompt"},
+				"agent":  {"copilot-cli"},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "missing_repos",
+		},
+		{
+			name: "invalid agent",
+			form: url.Values{
+				"prompt": {"Test prompt"},
+				"repos":  {"https://github.com/myorg/repo1"},
+				"agent":  {"invalid-agent"},
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_agent",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/change/simple", strings.NewReader(tt.form.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if tt.wantError != "" {
+				if response["error"] != tt.wantError {
+					t.Errorf("Expected error '%s', got '%v'", tt.wantError, response["error"])
+				}
+				return
+			}
+
+			if response["status"] != "pending" {
+				t.Errorf("Expected status 'pending', got '%v'", response["status"])
+			}
+
+			spec := response["change"].(map[string]interface{})["spec"].(map[string]interface{})
+			if repos := spec["repos"].([]interface{}); len(repos) != 2 {
+				t.Errorf("Expected 2 repos, got %v", repos)
+			}
+			if spec["branch"] != "main" {
+				t.Errorf("Expected default branch 'main', got '%v'", spec["branch"])
+			}
+		})
+	}
+}
+
+func TestListChangesEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+	router.GET("/changes", handleListChanges)
+
+	for i := 0; i < 3; i++ {
+		w := postJSON(router, "/change", Change{
+			Kind:       "Change",
+			APIVersion: "v1",
+			Spec: ChangeSpec{
+				Prompt: "Test prompt",
+				Repos:  repoRefs("https://github.com/myorg/repo1"),
+				Agent:  "gemini-cli",
+			},
+		})
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("Expected status 202, got %d", w.Code)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/changes?limit=2&offset=1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response struct {
+		Total  int          `json:"total"`
+		Offset int          `json:"offset"`
+		Limit  int          `json:"limit"`
+		Items  []JobSummary `json:"items"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.Total != 3 || response.Offset != 1 || response.Limit != 2 {
+		t.Errorf("Unexpected pagination fields: %+v", response)
+	}
+	if len(response.Items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(response.Items))
+	}
+	if response.Items[0].Agent != "gemini-cli" {
+		t.Errorf("Expected agent 'gemini-cli', got '%s'", response.Items[0].Agent)
+	}
+}
+
+func TestListChangesEndpointInvalidLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/changes", handleListChanges)
+
+	for _, query := range []string{"limit=0", "limit=101", "limit=abc", "limit=-5", "offset=-1", "offset=abc"} {
+		req, _ := http.NewRequest("GET", "/changes?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+			continue
+		}
+
+		var response ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("%s: failed to unmarshal response: %v", query, err)
+		}
+		if response.Error != "invalid_pagination" {
+			t.Errorf("%s: expected error 'invalid_pagination', got '%s'", query, response.Error)
+		}
+	}
+}
+
+func TestListPendingChangesByPriority(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+	router.GET("/changes", handleListChanges)
+
+	var ids []string
+	for _, priority := range []int{1, 0, 5} {
+		change := validTestChange()
+		change.Spec.Prompt = fmt.Sprintf("Priority %d", priority)
+		change.Spec.Priority = priority
+		w := postJSON(router, "/change", change)
+		var created struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &created)
+		ids = append(ids, created.ID)
+	}
+	// A pending change that was cancelled while queued isn't listed
+	cancelJob(ids[0], "")
+
+	req, _ := http.NewRequest("GET", "/changes?status=pending", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var list struct {
+		Total int          `json:"total"`
+		Items []JobSummary `json:"items"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if list.Total != 2 || len(list.Items) != 2 {
+		t.Fatalf("Expected 2 pending changes, got %s", w.Body.String())
+	}
+	if list.Items[0].ID != ids[2] || list.Items[0].Priority != 5 || list.Items[1].ID != ids[1] || list.Items[1].Priority != defaultPriority {
+		t.Errorf("Expected pending changes ordered by priority, got %+v", list.Items)
+	}
+
+	w = postJSON(router, "/change", func() Change {
+		change := validTestChange()
+		change.Spec.Priority = 6
+		return change
+	}())
+	var errResp ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &errResp)
+	if w.Code != http.StatusBadRequest || errResp.Error != "invalid_priority" {
+		t.Errorf("Expected 400 invalid_priority, got %d %s", w.Code, errResp.Error)
+	}
+}
+
+func TestListChangesEndpointPages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.GET("/changes", handleListChanges)
+
+	// Jobs created in the same instant are ordered by ID, so give each its
+	// own creation time to check the ordering follows submission
+	const count = 25
+	base := time.Now().UTC()
+	var want []string
+	for i := 0; i < count; i++ {
+		job := newJob(Change{Kind: "Change", APIVersion: "v1", Spec: ChangeSpec{Agent: "copilot-cli"}})
+		job.CreatedAt = base.Add(time.Duration(i) * time.Second)
+		if err := store.Save(job); err != nil {
+			t.Fatalf("Failed to save job: %v", err)
+		}
+		want = append(want, job.ID)
+	}
+
+	list := func(query string) (total, limit int, ids []string) {
+		req, _ := http.NewRequest("GET", "/changes"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status 200, got %d", query, w.Code)
+		}
+
+		var response struct {
+			Total int          `json:"total"`
+			Limit int          `json:"limit"`
+			Items []JobSummary `json:"items"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		for _, item := range response.Items {
+			ids = append(ids, item.ID)
+		}
+		return response.Total, response.Limit, ids
+	}
+
+	total, limit, first := list("")
+	if total != count || limit != defaultListLimit || len(first) != defaultListLimit {
+		t.Errorf("Expected the first %d of %d changes by default, got %d of %d with limit %d", defaultListLimit, count, len(first), total, limit)
+	}
+
+	var walked []string
+	for offset := 0; ; offset += 10 {
+		_, _, page := list(fmt.Sprintf("?limit=10&offset=%d", offset))
+		if len(page) == 0 {
+			break
+		}
+		walked = append(walked, page...)
+	}
+	if strings.Join(walked, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected pages to walk every change once in creation order\nwant: %v\ngot:  %v", want, walked)
+	}
+
+	if _, _, past := list("?offset=100"); len(past) != 0 {
+		t.Errorf("Expected no items past the end, got %d", len(past))
+	}
+}
+
+func TestChangeEndpointYAML(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	body := `kind: Change
+apiVersion: v1
+spec:
+  prompt: Add comprehensive error handling to all HTTP handlers
+  repos:
+    - https://github.com/myorg/repo1
+    - https://github.com/myorg/repo2
+  agent: copilot-cli
+`
+
+	for _, contentType := range []string{"application/yaml", "text/yaml"} {
+		t.Run(contentType, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/change", strings.NewReader(body))
+			req.Header.Set("Content-Type", contentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusAccepted {
+				t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if response["status"] != "pending" {
+				t.Errorf("Expected status 'pending', got '%v'", response["status"])
+			}
+
+			spec := response["change"].(map[string]interface{})["spec"].(map[string]interface{})
+			if spec["branch"] != "main" {
+				t.Errorf("Expected default branch 'main', got '%v'", spec["branch"])
+			}
+		})
+	}
+}
+
+func TestChangeEndpointYAMLValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	body := `kind: Change
+apiVersion: v1
+spec:
+  repos: [https://github.com/myorg/repo1]
+  agent: copilot-cli
+`
+
+	req, _ := http.NewRequest("POST", "/change", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/yaml")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func TestChangeEndpointUnsupportedContentType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	req, _ := http.NewRequest("POST", "/change", strings.NewReader("kind=Change"))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected status 415, got %d", w.Code)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.Error != "unsupported_media_type" {
+		t.Errorf("Expected error 'unsupported_media_type', got '%s'", response.Error)
+	}
+}
+
+func TestGetChangeEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+	router.GET("/changes/:id", handleGetChange)
+
+	w := postJSON(router, "/change", Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Stored prompt",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "copilot-cli",
+		},
+	})
+
+	var submitted struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &submitted); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/changes/"+submitted.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response struct {
+		ID     string `json:"id"`
+		Change Change `json:"change"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.ID != submitted.ID {
+		t.Errorf("Expected id '%s', got '%s'", submitted.ID, response.ID)
+	}
+	if response.Change.Spec.Prompt != "Stored prompt" {
+		t.Errorf("Expected stored prompt, got '%s'", response.Change.Spec.Prompt)
+	}
+}
+
+func TestGetChangeEndpointNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/changes/:id", handleGetChange)
+
+	req, _ := http.NewRequest("GET", "/changes/does-not-exist", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404, got %d", w.Code)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.Error != "change_not_found" {
+		t.Errorf("Expected error 'change_not_found', got '%s'", response.Error)
+	}
+}
+
+func TestValidateObservabilityIntegration(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       *OIConfig
+		wantError string
+	}{
+		{name: "unset", cfg: nil},
+		{name: "opentelemetry", cfg: &OIConfig{Type: "opentelemetry"}},
+		{
+			name: "datadog with endpoints",
+			cfg: &OIConfig{
+				Type:            "datadog",
+				MetricsEndpoint: "https://metrics.example.com",
+				TraceEndpoint:   "https://traces.example.com/v1/traces",
+			},
+		},
+		{name: "unknown type", cfg: &OIConfig{Type: "newrelic"}, wantError: "unsupported_observability_type"},
+		{name: "empty type", cfg: &OIConfig{}, wantError: "unsupported_observability_type"},
+		{
+			name:      "plain HTTP metrics endpoint",
+			cfg:       &OIConfig{Type: "opentelemetry", MetricsEndpoint: "http://metrics.example.com"},
+			wantError: "invalid_observability_endpoint",
+		},
+		{
+			name:      "malformed trace endpoint",
+			cfg:       &OIConfig{Type: "opentelemetry", TraceEndpoint: "traces.example.com"},
+			wantError: "invalid_observability_endpoint",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errResp := validateObservabilityIntegration(tt.cfg)
+			if tt.wantError == "" {
+				if errResp != nil {
+					t.Fatalf("Expected no error, got %+v", errResp)
+				}
+				return
+			}
+
+			if errResp == nil || errResp.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got %+v", tt.wantError, errResp)
+			}
+		})
+	}
+}
+
+func TestChangeEndpointUnsupportedObservabilityType(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	w := postJSON(router, "/change", Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt:                   "Test",
+			Repos:                    repoRefs("https://github.com/myorg/repo1"),
+			Agent:                    "copilot-cli",
+			ObservabilityIntegration: &OIConfig{Type: "newrelic"},
+		},
+	})
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+
+	if response.Error != "unsupported_observability_type" {
+		t.Errorf("Expected error 'unsupported_observability_type', got '%s'", response.Error)
+	}
+}
+
+func TestStatsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	now := time.Now()
+	queue.now = func() time.Time { return now }
+
+	router := gin.New()
+	router.GET("/stats", handleStats)
+
+	getStats := func() map[string]float64 {
+		req, _ := http.NewRequest("GET", "/stats", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]float64
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return response
+	}
+
+	if stats := getStats(); stats["queueOldestSeconds"] != 0 || stats["queueDepth"] != 0 {
+		t.Errorf("Expected empty queue stats, got %v", stats)
+	}
+
+	queue.push("a", defaultPriority)
+	queue.push("b", defaultPriority)
+	now = now.Add(90 * time.Second)
+
+	stats := getStats()
+	if stats["queueOldestSeconds"] != 90 {
+		t.Errorf("Expected queueOldestSeconds 90, got %v", stats["queueOldestSeconds"])
+	}
+	if stats["queueDepth"] != 2 {
+		t.Errorf("Expected queueDepth 2, got %v", stats["queueDepth"])
+	}
+}
+
+func TestDeleteChangeEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+	router.GET("/changes/:id", handleGetChange)
+	router.DELETE("/changes/:id", handleDeleteChange)
+
+	w := postJSON(router, "/change", Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Submitted by mistake",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "copilot-cli",
+		},
+	})
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.ID == "" {
+		t.Fatalf("Failed to create change: %d %s", w.Code, w.Body.String())
+	}
+
+	req, _ := http.NewRequest("DELETE", "/changes/"+created.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+	if w.Body.Len() != 0 {
+		t.Errorf("Expected an empty body, got %q", w.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/changes/"+created.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted change to return 404, got %d", w.Code)
+	}
+
+	// The queued change is skipped once it is deleted
+	id, _ := queue.pop(context.Background())
+	processJob(context.Background(), id)
+	if _, err := store.Get(id); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Expected the deleted change to stay deleted, got %v", err)
+	}
+}
+
+func TestDeleteChangeEndpointNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.DELETE("/changes/:id", handleDeleteChange)
+
+	req, _ := http.NewRequest("DELETE", "/changes/does-not-exist", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404, got %d", w.Code)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Error != "change_not_found" {
+		t.Errorf("Expected error 'change_not_found', got '%s'", response.Error)
+	}
+}
+
+func TestCancelChangeEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.GET("/change/:id", handleChangeStatus)
+	router.DELETE("/change/:id", handleCancelChange)
+
+	pending := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	finished := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	store.Update(finished.ID, func(j *Job) { j.Status = statusDone })
+
+	tests := []struct {
+		name       string
+		id         string
+		wantStatus int
+		wantError  string
+	}{
+		{name: "pending job", id: pending.ID, wantStatus: http.StatusOK},
+		{name: "already cancelled", id: pending.ID, wantStatus: http.StatusConflict, wantError: "change_not_cancellable"},
+		{name: "finished job", id: finished.ID, wantStatus: http.StatusConflict, wantError: "change_not_cancellable"},
+		{name: "unknown job", id: "does-not-exist", wantStatus: http.StatusNotFound, wantError: "change_not_found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("DELETE", "/change/"+tt.id, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			if tt.wantError == "" {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got '%s'", tt.wantError, response.Error)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/change/"+pending.ID, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var job Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if job.Status != statusCancelled {
+		t.Errorf("Expected status '%s', got '%s'", statusCancelled, job.Status)
+	}
+	if job.CancelledAt == nil {
+		t.Error("Expected cancelledAt to be set")
+	}
+}
+
+func TestChangeEndpointNameConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	named := func(name, namespace string) Change {
+		return Change{
+			Kind:       "Change",
+			APIVersion: "v1",
+			Metadata:   &ObjectMeta{Name: name, Namespace: namespace},
+			Spec: ChangeSpec{
+				Prompt: "Test",
+				Repos:  repoRefs("https://github.com/myorg/repo1"),
+				Agent:  "copilot-cli",
+			},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		change     Change
+		wantStatus int
+		wantError  string
+	}{
+		{name: "first submission", change: named("fix-auth", ""), wantStatus: http.StatusAccepted},
+		{name: "same name in default namespace", change: named("fix-auth", "default"), wantStatus: http.StatusConflict, wantError: "name_conflict"},
+		{name: "same name in other namespace", change: named("fix-auth", "team-a"), wantStatus: http.StatusAccepted},
+		{name: "invalid name", change: named("Fix Auth", ""), wantStatus: http.StatusBadRequest, wantError: "invalid_metadata"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postJSON(router, "/change", tt.change)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			if tt.wantError == "" {
+				return
+			}
+
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got '%s'", tt.wantError, response.Error)
+			}
+		})
+	}
+}
+
+func TestShutdownServer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	srv := &http.Server{Handler: newRouter()}
+	served := make(chan error, 1)
+	go func() { served <- srv.Serve(listener) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/health")
+	if err != nil {
+		t.Fatalf("Failed to reach server: %v", err)
+	}
+	resp.Body.Close()
+
+	if err := shutdownServer(srv, time.Second); err != nil {
+		t.Fatalf("Expected clean shutdown, got %v", err)
+	}
+
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("Expected ErrServerClosed, got %v", err)
+	}
+}
+
+func TestTrailingSlashRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	router := newRouter()
+
+	tests := []struct {
+		method   string
+		path     string
+		wantCode int
+		location string
+	}{
+		{"GET", "/health", http.StatusOK, ""},
+		{"GET", "/health/", http.StatusMovedPermanently, "/health"},
+		{"POST", "/change", http.StatusAccepted, ""},
+		{"POST", "/change/", http.StatusTemporaryRedirect, "/change"},
+		{"GET", "/changes/?limit=5", http.StatusMovedPermanently, "/changes?limit=5"},
+		{"GET", "/no-such-route/", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			body, _ := json.Marshal(validTestChange())
+			req, _ := http.NewRequest(tt.method, tt.path, bytes.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if got := w.Header().Get("Location"); got != tt.location {
+				t.Errorf("Expected Location %q, got %q", tt.location, got)
+			}
+		})
+	}
+
+	// A client following the redirect repeats the POST with its body
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	body, _ := json.Marshal(validTestChange())
+	resp, err := http.Post(server.URL+"/change/", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("Failed to post change: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted || resp.Request.Method != "POST" || resp.Request.URL.Path != "/change" {
+		t.Errorf("Expected the redirected POST /change to be accepted, got %d from %s %s", resp.StatusCode, resp.Request.Method, resp.Request.URL.Path)
+	}
+
+	resp, err = http.Get(server.URL + "/health/")
+	if err != nil {
+		t.Fatalf("Failed to get health: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the redirected GET /health to succeed, got %d", resp.StatusCode)
+	}
+}
+
+func TestListenAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		host    string
+		port    string
+		want    string
+		wantErr bool
+	}{
+		{name: "all interfaces", host: "", port: "8080", want: ":8080"},
+		{name: "loopback", host: "127.0.0.1", port: "8080", want: "127.0.0.1:8080"},
+		{name: "hostname", host: "localhost", port: "3000", want: "localhost:3000"},
+		{name: "ipv6", host: "::1", port: "8080", want: "[::1]:8080"},
+		{name: "bracketed ipv6", host: "[::1]", port: "8080", want: "[::1]:8080"},
+		{name: "host with port", host: "127.0.0.1:9090", port: "8080", wantErr: true},
+		{name: "non-numeric port", host: "", port: "http", wantErr: true},
+		{name: "port out of range", host: "127.0.0.1", port: "70000", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := listenAddress(tt.host, tt.port)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("listenAddress error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
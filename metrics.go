@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// errorCodeContextKey is the gin.Context key holding the error code of the
+// ErrorResponse written for the request, if any
+const errorCodeContextKey = "errorCode"
+
+// agentContextKey is the gin.Context key holding the validated spec.agent of
+// a change submission
+const agentContextKey = "agent"
+
+// submitPaths are the routes whose outcomes are counted by
+// change_submissions_total
+var submitPaths = map[string]bool{
+	"/change":        true,
+	"/change/simple": true,
+}
+
+// metrics holds the collectors recorded by the metrics middleware
+type metrics struct {
+	requestsTotal      *prometheus.CounterVec
+	requestDuration    *prometheus.HistogramVec
+	submissionsTotal   *prometheus.CounterVec
+	submissionDuration *prometheus.HistogramVec
+}
+
+// newMetrics registers the service's collectors with reg. Collectors that are
+// already registered, e.g. by an earlier router, are reused.
+func newMetrics(reg prometheus.Registerer) *metrics {
+	m := &metrics{
+		requestsTotal: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "Total HTTP requests by route, method and status code.",
+		}, []string{"path", "method", "status"})),
+
+		requestDuration: register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by route, method and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"path", "method", "status"})),
+
+		submissionsTotal: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "change_submissions_total",
+			Help: "Change submissions by route, outcome ('accepted' or 'rejected'), agent and the error code returned.",
+		}, []string{"path", "outcome", "agent", "error_code"})),
+
+		submissionDuration: register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "change_submission_duration_seconds",
+			Help:    "Change submission latency by route and outcome.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"path", "outcome"})),
+	}
+
+	register(reg, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "queue_depth",
+		Help: "Number of changes waiting for a worker.",
+	}, func() float64 { return float64(queue.len()) }))
+
+	register(reg, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "queue_oldest_seconds",
+		Help: "Age in seconds of the oldest change waiting for a worker.",
+	}, func() float64 { return queue.oldestAge().Seconds() }))
+
+	register(reg, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "workers_active",
+		Help: "Number of workers processing a change.",
+	}, func() float64 { return float64(activeWorkers()) }))
+
+	register(reg, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "workers_idle",
+		Help: "Number of workers waiting for a change.",
+	}, func() float64 { return float64(idleWorkers()) }))
+
+	return m
+}
+
+// register registers c with reg, returning the collector already registered
+// under the same descriptor if there is one
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	if err := reg.Register(c); err != nil {
+		var already prometheus.AlreadyRegisteredError
+		if errors.As(err, &already) {
+			if existing, ok := already.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
+
+// NewMetricsMiddleware returns a middleware that records request counts and
+// latencies, and the outcome of change submissions, in collectors registered
+// with reg
+func NewMetricsMiddleware(reg prometheus.Registerer) gin.HandlerFunc {
+	m := newMetrics(reg)
+
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		// Use the route template rather than the raw path so IDs don't
+		// explode label cardinality
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		method := c.Request.Method
+		status := strconv.Itoa(c.Writer.Status())
+		elapsed := time.Since(start).Seconds()
+
+		m.requestsTotal.WithLabelValues(path, method, status).Inc()
+		m.requestDuration.WithLabelValues(path, method, status).Observe(elapsed)
+
+		if method == "POST" && submitPaths[path] {
+			errorCode := c.GetString(errorCodeContextKey)
+			outcome := "accepted"
+			if errorCode != "" {
+				outcome = "rejected"
+			}
+			m.submissionsTotal.WithLabelValues(path, outcome, c.GetString(agentContextKey), errorCode).Inc()
+			m.submissionDuration.WithLabelValues(path, outcome).Observe(elapsed)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// scrapeMetric fetches /metrics from router and returns the value of series,
+// e.g. `http_requests_total{method="GET",path="/health",status="200"}`, or 0
+// if it hasn't been recorded yet
+func scrapeMetric(t *testing.T, router *gin.Engine, series string) float64 {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected /metrics status 200, got %d", w.Code)
+	}
+
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), series+" ")
+		if !ok {
+			continue
+		}
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			t.Fatalf("Failed to parse value of %s: %v", series, err)
+		}
+		return f
+	}
+	return 0
+}
+
+func TestMetricsCountRequestsAndOutcomes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := newRouter()
+
+	healthSeries := `http_requests_total{method="GET",path="/health",status="200"}`
+	invalidAgentSeries := `change_submissions_total{agent="",error_code="invalid_agent",outcome="rejected",path="/change"}`
+	durationSeries := `http_request_duration_seconds_count{method="GET",path="/health",status="200"}`
+
+	healthBefore := scrapeMetric(t, router, healthSeries)
+	invalidBefore := scrapeMetric(t, router, invalidAgentSeries)
+	durationBefore := scrapeMetric(t, router, durationSeries)
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/health", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	postJSON(router, "/change", Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Test",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "invalid-agent",
+		},
+	})
+
+	if got := scrapeMetric(t, router, healthSeries) - healthBefore; got != 3 {
+		t.Errorf("Expected /health request counter to move by 3, moved by %v", got)
+	}
+	if got := scrapeMetric(t, router, durationSeries) - durationBefore; got != 3 {
+		t.Errorf("Expected 3 /health latency observations, got %v", got)
+	}
+	if got := scrapeMetric(t, router, invalidAgentSeries) - invalidBefore; got != 1 {
+		t.Errorf("Expected invalid_agent outcome counter to move by 1, moved by %v", got)
+	}
+}
+
+func TestNewMetricsMiddlewareCustomRegistry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	reg := prometheus.NewRegistry()
+	router := gin.New()
+	router.Use(NewMetricsMiddleware(reg))
+	router.POST("/change", handleChange)
+	router.GET("/metrics", gin.WrapH(promhttp.HandlerFor(reg, promhttp.HandlerOpts{})))
+
+	submit := func(agent string) {
+		postJSON(router, "/change", Change{
+			Kind:       "Change",
+			APIVersion: "v1",
+			Spec: ChangeSpec{
+				Prompt: "Test " + agent,
+				Repos:  repoRefs("https://github.com/myorg/repo1"),
+				Agent:  agent,
+			},
+		})
+	}
+	submit("claude-cli")
+	submit("claude-cli")
+	submit("unknown-agent")
+
+	// A fresh registry starts from zero, so the values are exact
+	expected := map[string]float64{
+		`change_submissions_total{agent="claude-cli",error_code="",outcome="accepted",path="/change"}`:    2,
+		`change_submissions_total{agent="",error_code="invalid_agent",outcome="rejected",path="/change"}`: 1,
+		`change_submission_duration_seconds_count{outcome="accepted",path="/change"}`:                     2,
+		`http_requests_total{method="POST",path="/change",status="202"}`:                                  2,
+		`http_request_duration_seconds_count{method="POST",path="/change",status="400"}`:                  1,
+		`queue_depth`:    2,
+		`workers_active`: 0,
+		`workers_idle`:   0,
+	}
+	for series, want := range expected {
+		if got := scrapeMetric(t, router, series); got != want {
+			t.Errorf("Expected %s to be %v, got %v", series, want, got)
+		}
+	}
+
+	// Building a second middleware on the same registry reuses its collectors
+	NewMetricsMiddleware(reg)
+}
@@ -0,0 +1,11 @@
+CREATE TABLE jobs (
+    id         TEXT PRIMARY KEY,
+    status     TEXT NOT NULL,
+    name       TEXT NOT NULL DEFAULT '',
+    namespace  TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL,
+    data       TEXT NOT NULL
+);
+
+CREATE INDEX jobs_created_at ON jobs (created_at, id);
+CREATE INDEX jobs_name ON jobs (namespace, name);
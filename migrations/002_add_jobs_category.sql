@@ -0,0 +1,6 @@
+ALTER TABLE jobs ADD COLUMN category TEXT NOT NULL DEFAULT 'uncategorized';
+
+UPDATE jobs SET category = json_extract(data, '$.change.spec.changeCategory')
+WHERE json_extract(data, '$.change.spec.changeCategory') IS NOT NULL;
+
+CREATE INDEX jobs_category ON jobs (category, created_at, id);
@@ -0,0 +1,9 @@
+CREATE TABLE idempotency_keys (
+    key        TEXT PRIMARY KEY,
+    status     INTEGER NOT NULL,
+    body       BLOB NOT NULL,
+    created_at INTEGER NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at ON idempotency_keys (expires_at);
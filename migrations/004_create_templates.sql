@@ -0,0 +1,5 @@
+CREATE TABLE templates (
+    id         TEXT PRIMARY KEY,
+    created_at INTEGER NOT NULL,
+    data       TEXT NOT NULL
+);
@@ -0,0 +1,6 @@
+ALTER TABLE jobs ADD COLUMN content_hash TEXT NOT NULL DEFAULT '';
+
+UPDATE jobs SET content_hash = json_extract(data, '$.contentHash')
+WHERE json_extract(data, '$.contentHash') IS NOT NULL;
+
+CREATE INDEX jobs_content_hash ON jobs (content_hash, created_at);
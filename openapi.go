@@ -0,0 +1,43 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec is the OpenAPI 3.0 document describing the API
+//
+//go:embed api/openapi.json
+var openAPISpec []byte
+
+// handleOpenAPI serves openAPISpec. The registered agents and DEFAULT_BRANCH
+// are only known at runtime, so the document's spec.agent enum and
+// spec.branch default are replaced with agentRegistry's agents and
+// config.DefaultBranch.
+func handleOpenAPI(c *gin.Context) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		requestLogger(c).Error("Failed to parse OpenAPI document", "error", err)
+		respondError(c, http.StatusInternalServerError, ErrorResponse{
+			Error:   "internal_error",
+			Message: "failed to load the OpenAPI document",
+		})
+		return
+	}
+
+	components, _ := doc["components"].(map[string]interface{})
+	schemas, _ := components["schemas"].(map[string]interface{})
+	spec, _ := schemas["ChangeSpec"].(map[string]interface{})
+	properties, _ := spec["properties"].(map[string]interface{})
+	if agent, ok := properties["agent"].(map[string]interface{}); ok {
+		agent["enum"] = agentRegistry.Names()
+	}
+	if branch, ok := properties["branch"].(map[string]interface{}); ok {
+		branch["default"] = config.DefaultBranch
+	}
+
+	c.JSON(http.StatusOK, doc)
+}
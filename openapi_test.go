@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPIEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config
+	cfg.ValidAgents = []string{"copilot-cli", "in-house-agent"}
+	cfg.DefaultBranch = "trunk"
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.GET("/openapi.json", handleOpenAPI)
+
+	req := httptest.NewRequest("GET", "/openapi.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var doc struct {
+		OpenAPI    string                            `json:"openapi"`
+		Paths      map[string]map[string]interface{} `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Required   []string `json:"required"`
+				Properties map[string]struct {
+					Enum    []string    `json:"enum"`
+					Default interface{} `json:"default"`
+				} `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("Failed to parse OpenAPI document: %v", err)
+	}
+
+	if doc.OpenAPI != "3.0.3" {
+		t.Errorf("Expected OpenAPI 3.0.3, got %q", doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/change"]["post"]; !ok {
+		t.Error("Expected POST /change to be documented")
+	}
+	if _, ok := doc.Paths["/health"]["get"]; !ok {
+		t.Error("Expected GET /health to be documented")
+	}
+
+	schemas := doc.Components.Schemas
+	if want := []string{"kind", "apiVersion", "spec"}; !reflect.DeepEqual(schemas["Change"].Required, want) {
+		t.Errorf("Expected Change to require %v, got %v", want, schemas["Change"].Required)
+	}
+	if want := []string{"prompt", "repos", "agent"}; !reflect.DeepEqual(schemas["ChangeSpec"].Required, want) {
+		t.Errorf("Expected ChangeSpec to require %v, got %v", want, schemas["ChangeSpec"].Required)
+	}
+	if got := schemas["ChangeSpec"].Properties["agent"].Enum; !reflect.DeepEqual(got, cfg.ValidAgents) {
+		t.Errorf("Expected the agent enum to be %v, got %v", cfg.ValidAgents, got)
+	}
+	if got := schemas["ChangeSpec"].Properties["branch"].Default; got != "trunk" {
+		t.Errorf("Expected the branch default to be 'trunk', got %v", got)
+	}
+	if _, ok := schemas["ErrorResponse"]; !ok {
+		t.Error("Expected the ErrorResponse schema to be documented")
+	}
+}
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var doc struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("Failed to parse OpenAPI document: %v", err)
+	}
+
+	// Gin writes path parameters as :id, OpenAPI as {id}
+	param := regexp.MustCompile(`/:(\w+)`)
+	for _, route := range newRouter().Routes() {
+		path := param.ReplaceAllString(route.Path, "/{$1}")
+		if _, ok := doc.Paths[path][strings.ToLower(route.Method)]; !ok {
+			t.Errorf("Expected %s %s to be documented", route.Method, path)
+		}
+	}
+}
+
+func TestDocsEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/docs", handleDocs)
+
+	req := httptest.NewRequest("GET", "/docs", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "text/html") {
+		t.Errorf("Expected an HTML page, got Content-Type %q", got)
+	}
+	if !strings.Contains(w.Body.String(), `url: "/openapi.json"`) {
+		t.Error("Expected the page to load /openapi.json")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// parseAgentRequiredOptions parses AGENT_REQUIRED_OPTIONS entries of the
+// form agent:key, such as "gemini-cli:projectId", into the option keys each
+// agent requires. An agent needing several options is listed once per key.
+// Malformed entries are logged and skipped.
+func parseAgentRequiredOptions(entries []string) map[string][]string {
+	required := make(map[string][]string)
+	for _, entry := range entries {
+		agent, key, ok := strings.Cut(entry, ":")
+		agent, key = strings.TrimSpace(agent), strings.TrimSpace(key)
+		if !ok || agent == "" || key == "" {
+			logger.Warn("Invalid AGENT_REQUIRED_OPTIONS entry, ignoring it", "value", entry)
+			continue
+		}
+		required[agent] = append(required[agent], key)
+	}
+	return required
+}
+
+// validateOptions checks that spec.options holds every option
+// config.AgentRequiredOptions requires for agent, returning a
+// missing_option error per absent key, in sorted order
+func validateOptions(agent string, options map[string]string) []FieldError {
+	keys := append([]string(nil), config.AgentRequiredOptions[agent]...)
+	sort.Strings(keys)
+
+	var errs []FieldError
+	for _, key := range keys {
+		if strings.TrimSpace(options[key]) != "" {
+			continue
+		}
+		field := "spec.options." + key
+		errs = append(errs, FieldError{
+			Field:   field,
+			Code:    "missing_option",
+			Message: fmt.Sprintf("%s is required by agent %q", field, agent),
+		})
+	}
+	return errs
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseAgentRequiredOptions(t *testing.T) {
+	got := parseAgentRequiredOptions([]string{"copilot-cli:model", "gemini-cli:projectId", " gemini-cli : region ", "claude-cli", ":model", "gemini-cli:"})
+
+	want := map[string][]string{
+		"copilot-cli": {"model"},
+		"gemini-cli":  {"projectId", "region"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestValidateChangeRequiredOptions(t *testing.T) {
+	cfg := config
+	cfg.AgentRequiredOptions = map[string][]string{
+		"copilot-cli": {"model"},
+		"gemini-cli":  {"region", "projectId"},
+	}
+	setConfig(t, cfg)
+
+	tests := []struct {
+		name    string
+		agent   string
+		options map[string]string
+		want    []string
+	}{
+		{"copilot-cli with model", "copilot-cli", map[string]string{"model": "gpt-4o"}, nil},
+		{"copilot-cli without model", "copilot-cli", nil, []string{"spec.options.model"}},
+		{"copilot-cli with blank model", "copilot-cli", map[string]string{"model": " "}, []string{"spec.options.model"}},
+		{"gemini-cli with both", "gemini-cli", map[string]string{"projectId": "my-project", "region": "europe-west1"}, nil},
+		{"gemini-cli without projectId", "gemini-cli", map[string]string{"region": "europe-west1"}, []string{"spec.options.projectId"}},
+		{"gemini-cli without either", "gemini-cli", map[string]string{"model": "gemini-pro"}, []string{"spec.options.projectId", "spec.options.region"}},
+		{"claude-cli requires none", "claude-cli", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change := validTestChange()
+			change.Spec.Agent = tt.agent
+			change.Spec.Options = tt.options
+
+			errResp := validateChange(change)
+			if tt.want == nil {
+				if errResp != nil {
+					t.Fatalf("Expected no errors, got %+v", errResp)
+				}
+				return
+			}
+			if errResp == nil {
+				t.Fatalf("Expected missing_option on %v, got none", tt.want)
+			}
+			var fields []string
+			for _, fieldErr := range errResp.Errors {
+				if fieldErr.Code != "missing_option" {
+					t.Errorf("Expected missing_option, got %+v", fieldErr)
+				}
+				fields = append(fields, fieldErr.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.want) {
+				t.Errorf("Expected errors on %v, got %v", tt.want, fields)
+			}
+		})
+	}
+}
+
+func TestChangeEndpointMissingOption(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	cfg := config
+	cfg.AgentRequiredOptions = map[string][]string{"gemini-cli": {"projectId"}}
+	setConfig(t, cfg)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	body := map[string]interface{}{
+		"kind":       "Change",
+		"apiVersion": "v1",
+		"spec": map[string]interface{}{
+			"prompt": "Bump the shared client",
+			"repos":  []string{"https://github.com/myorg/repo1"},
+			"agent":  "gemini-cli",
+		},
+	}
+
+	w := postJSON(router, "/change", body)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+	var errResp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("Failed to unmarshal error: %v", err)
+	}
+	if errResp.Error != "missing_option" || errResp.Message != `spec.options.projectId is required by agent "gemini-cli"` {
+		t.Errorf("Expected missing_option naming the key and agent, got %+v", errResp)
+	}
+
+	body["spec"].(map[string]interface{})["options"] = map[string]string{"projectId": "my-project"}
+	if w := postJSON(router, "/change", body); w.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202 with the option set, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Bounds for spec.progressWebhook.intervalSeconds
+const (
+	minProgressIntervalSeconds = 5
+	maxProgressIntervalSeconds = 300
+)
+
+// ProgressWebhookConfig asks for snapshots of a change to be POSTed to URL
+// every IntervalSeconds while it runs
+type ProgressWebhookConfig struct {
+	URL             string `json:"url"`
+	IntervalSeconds int    `json:"intervalSeconds"`
+}
+
+// webhookClient sends webhook requests; init applies WEBHOOK_TIMEOUT_SECONDS
+var webhookClient = &http.Client{Timeout: defaultWebhookTimeout}
+
+// newProgressTicker returns a channel that fires every d along with a
+// function that stops it. Tests replace it to drive ticks by hand.
+var newProgressTicker = func(d time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(d)
+	return ticker.C, ticker.Stop
+}
+
+// validateProgressWebhook checks cfg, returning nil when it is valid or unset
+func validateProgressWebhook(cfg *ProgressWebhookConfig) *ErrorResponse {
+	if cfg == nil {
+		return nil
+	}
+
+	if u, err := url.Parse(cfg.URL); !isHTTPSURL(cfg.URL) || err != nil || isPrivateHost(u.Hostname()) {
+		return &ErrorResponse{
+			Error:   "invalid_progress_webhook",
+			Message: fmt.Sprintf("spec.progressWebhook.url %q must be an HTTPS URL on a public host", cfg.URL),
+		}
+	}
+
+	if cfg.IntervalSeconds < minProgressIntervalSeconds || cfg.IntervalSeconds > maxProgressIntervalSeconds {
+		return &ErrorResponse{
+			Error: "invalid_progress_webhook",
+			Message: fmt.Sprintf("spec.progressWebhook.intervalSeconds must be between %d and %d",
+				minProgressIntervalSeconds, maxProgressIntervalSeconds),
+		}
+	}
+
+	return nil
+}
+
+// startProgressWebhook POSTs a snapshot of the job with the given ID to
+// cfg.URL, in the trace of parent, on every interval until the returned
+// function is called or the job reaches a terminal state. The returned
+// function waits for any in-flight delivery to finish, so no snapshot is
+// sent after it returns.
+func startProgressWebhook(parent context.Context, id string, cfg ProgressWebhookConfig) (stop func()) {
+	ticks, stopTicker := newProgressTicker(time.Duration(cfg.IntervalSeconds) * time.Second)
+	// Keep the job's span so deliveries join its trace, but not its
+	// cancellation, which stop already handles
+	ctx, cancel := context.WithCancel(trace.ContextWithSpan(context.Background(), trace.SpanFromContext(parent)))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer stopTicker()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticks:
+			}
+
+			job, err := store.Get(id)
+			if err != nil {
+				logger.Error("Failed to load change for progress webhook", "id", id, "error", err)
+				continue
+			}
+			if isTerminal(job.Status) {
+				return
+			}
+			if err := postWebhook(ctx, cfg.URL, job); err != nil {
+				logger.Warn("Progress webhook delivery failed", "id", id, "url", cfg.URL, "error", err)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+// postWebhook POSTs payload as JSON to target
+func postWebhook(ctx context.Context, target string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
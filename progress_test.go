@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidateProgressWebhook(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   *ProgressWebhookConfig
+		valid bool
+	}{
+		{"unset", nil, true},
+		{"valid", &ProgressWebhookConfig{URL: "https://hooks.example.com/progress", IntervalSeconds: 30}, true},
+		{"minimum interval", &ProgressWebhookConfig{URL: "https://hooks.example.com/progress", IntervalSeconds: 5}, true},
+		{"maximum interval", &ProgressWebhookConfig{URL: "https://hooks.example.com/progress", IntervalSeconds: 300}, true},
+		{"private host", &ProgressWebhookConfig{URL: "https://10.0.0.8/progress", IntervalSeconds: 30}, false},
+		{"plain HTTP", &ProgressWebhookConfig{URL: "http://hooks.example.com/progress", IntervalSeconds: 30}, false},
+		{"interval too short", &ProgressWebhookConfig{URL: "https://hooks.example.com/progress", IntervalSeconds: 4}, false},
+		{"interval too long", &ProgressWebhookConfig{URL: "https://hooks.example.com/progress", IntervalSeconds: 301}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errResp := validateProgressWebhook(tt.cfg)
+			if tt.valid && errResp != nil {
+				t.Errorf("Expected valid, got %+v", errResp)
+			}
+			if !tt.valid && (errResp == nil || errResp.Error != "invalid_progress_webhook") {
+				t.Errorf("Expected invalid_progress_webhook, got %+v", errResp)
+			}
+		})
+	}
+}
+
+func TestProgressWebhookDeliversWhileRunning(t *testing.T) {
+	isolateJobs(t)
+
+	received := make(chan Job)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var job Job
+		json.NewDecoder(r.Body).Decode(&job)
+		received <- job
+	}))
+	defer server.Close()
+
+	previousClient, previousTicker := webhookClient, newProgressTicker
+	t.Cleanup(func() { webhookClient, newProgressTicker = previousClient, previousTicker })
+	webhookClient = server.Client()
+
+	// Drive the ticker by hand so the change "runs" for exactly three
+	// intervals
+	ticks := make(chan time.Time)
+	var interval time.Duration
+	newProgressTicker = func(d time.Duration) (<-chan time.Time, func()) {
+		interval = d
+		return ticks, func() {}
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		close(started)
+		<-release
+		return ChangeResult{}, nil
+	})
+
+	job := submitTestJob(t, ChangeSpec{
+		Agent:           "copilot-cli",
+		ProgressWebhook: &ProgressWebhookConfig{URL: server.URL, IntervalSeconds: 10},
+	})
+	done := make(chan struct{})
+	go func() {
+		processJob(context.Background(), job.ID)
+		close(done)
+	}()
+	<-started
+
+	for i := 0; i < 3; i++ {
+		ticks <- time.Now()
+		select {
+		case snapshot := <-received:
+			if snapshot.ID != job.ID || snapshot.Status != statusRunning {
+				t.Errorf("Expected running snapshot of %s, got %s %s", job.ID, snapshot.ID, snapshot.Status)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timed out waiting for progress delivery %d", i+1)
+		}
+	}
+	if interval != 10*time.Second {
+		t.Errorf("Expected a 10s interval, got %s", interval)
+	}
+
+	close(release)
+	<-done
+
+	select {
+	case ticks <- time.Now():
+		t.Error("Expected progress webhook to stop once the change finished")
+	default:
+	}
+}
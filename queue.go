@@ -0,0 +1,186 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Bounds and default for spec.priority; higher values run first
+const (
+	minPriority     = 1
+	maxPriority     = 5
+	defaultPriority = 3
+)
+
+// queuedJob is an entry in the job queue
+type queuedJob struct {
+	id         string
+	priority   int
+	enqueuedAt time.Time
+	// seq orders jobs of equal priority by when they were pushed
+	seq uint64
+}
+
+// jobHeap is a container/heap of queued jobs with the next job to run at
+// the root: the highest priority, then the earliest pushed
+type jobHeap []queuedJob
+
+func (h jobHeap) Len() int { return len(h) }
+
+func (h jobHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h jobHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *jobHeap) Push(x interface{}) { *h = append(*h, x.(queuedJob)) }
+
+func (h *jobHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// jobQueue is a thread-safe priority queue of job IDs waiting for a worker.
+// Higher-priority jobs are dequeued first, and jobs of equal priority in the
+// order they were pushed. It records when each job was enqueued so that
+// processing stalls can be detected.
+type jobQueue struct {
+	mu      sync.Mutex
+	entries jobHeap
+	seq     uint64
+	notify  chan struct{}
+	now     func() time.Time
+}
+
+var queue = newJobQueue()
+
+// newJobQueue creates an empty jobQueue
+func newJobQueue() *jobQueue {
+	return &jobQueue{
+		notify: make(chan struct{}, 1),
+		now:    time.Now,
+	}
+}
+
+// enqueue queues job for a worker at its spec.priority. Jobs saved before
+// priorities existed get defaultPriority.
+func enqueue(job Job) {
+	priority := job.Change.Spec.Priority
+	if priority == 0 {
+		priority = defaultPriority
+	}
+	queue.push(job.ID, priority)
+}
+
+// push adds the job with the given ID to the queue behind any jobs of the
+// same or higher priority
+func (q *jobQueue) push(id string, priority int) {
+	q.mu.Lock()
+	q.seq++
+	heap.Push(&q.entries, queuedJob{id: id, priority: priority, enqueuedAt: q.now(), seq: q.seq})
+	q.mu.Unlock()
+
+	q.signal()
+}
+
+// pop removes and returns the next job ID to run, blocking until one is
+// available. It returns false if ctx is done first.
+func (q *jobQueue) pop(ctx context.Context) (string, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.entries) > 0 {
+			entry := heap.Pop(&q.entries).(queuedJob)
+			remaining := len(q.entries)
+			q.mu.Unlock()
+
+			// Pass the wakeup on so another idle worker picks up the rest
+			if remaining > 0 {
+				q.signal()
+			}
+			return entry.id, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-q.notify:
+		case <-ctx.Done():
+			return "", false
+		}
+	}
+}
+
+// ids returns the IDs of the jobs waiting in the queue in the order they
+// would be dequeued, leaving the queue unchanged
+func (q *jobQueue) ids() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.sortedIDs()
+}
+
+// drain removes and returns every job ID waiting in the queue, in the order
+// they would be dequeued
+func (q *jobQueue) drain() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	ids := q.sortedIDs()
+	q.entries = nil
+	return ids
+}
+
+// sortedIDs returns the queued job IDs in dequeue order. q.mu must be held.
+func (q *jobQueue) sortedIDs() []string {
+	entries := append(jobHeap(nil), q.entries...)
+	sort.Sort(entries)
+
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.id)
+	}
+	return ids
+}
+
+// len returns the number of jobs waiting in the queue
+func (q *jobQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.entries)
+}
+
+// oldestAge returns how long the longest-waiting job in the queue has been
+// there, or zero when the queue is empty. With priorities, that job isn't
+// necessarily the next to run.
+func (q *jobQueue) oldestAge() time.Duration {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.entries) == 0 {
+		return 0
+	}
+
+	oldest := q.entries[0].enqueuedAt
+	for _, entry := range q.entries[1:] {
+		if entry.enqueuedAt.Before(oldest) {
+			oldest = entry.enqueuedAt
+		}
+	}
+	return q.now().Sub(oldest)
+}
+
+// signal wakes up one waiting worker without blocking
+func (q *jobQueue) signal() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJobQueueFIFO(t *testing.T) {
+	q := newJobQueue()
+	q.push("a", defaultPriority)
+	q.push("b", defaultPriority)
+
+	for _, want := range []string{"a", "b"} {
+		got, ok := q.pop(context.Background())
+		if !ok || got != want {
+			t.Errorf("Expected '%s', got '%s' (ok=%v)", want, got, ok)
+		}
+	}
+
+	if q.len() != 0 {
+		t.Errorf("Expected empty queue, got %d entries", q.len())
+	}
+}
+
+func TestJobQueuePriority(t *testing.T) {
+	q := newJobQueue()
+	q.push("low", 1)
+	q.push("high-1", 5)
+	q.push("default", defaultPriority)
+	q.push("high-2", 5)
+
+	want := []string{"high-1", "high-2", "default", "low"}
+	if got := q.ids(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected ids %v, got %v", want, got)
+	}
+	for _, id := range want {
+		got, ok := q.pop(context.Background())
+		if !ok || got != id {
+			t.Errorf("Expected '%s', got '%s' (ok=%v)", id, got, ok)
+		}
+	}
+}
+
+func TestJobQueueDrain(t *testing.T) {
+	q := newJobQueue()
+	q.push("a", defaultPriority)
+	q.push("b", defaultPriority)
+
+	if got := q.drain(); len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("Expected [a b], got %v", got)
+	}
+	if q.len() != 0 {
+		t.Errorf("Expected empty queue after drain, got %d entries", q.len())
+	}
+}
+
+func TestJobQueueOldestAge(t *testing.T) {
+	now := time.Now()
+	q := newJobQueue()
+	q.now = func() time.Time { return now }
+
+	if age := q.oldestAge(); age != 0 {
+		t.Errorf("Expected zero age for empty queue, got %v", age)
+	}
+
+	q.push("a", defaultPriority)
+	now = now.Add(30 * time.Second)
+	q.push("b", defaultPriority)
+	now = now.Add(10 * time.Second)
+
+	if age := q.oldestAge(); age != 40*time.Second {
+		t.Errorf("Expected oldest age 40s, got %v", age)
+	}
+
+	q.pop(context.Background())
+	if age := q.oldestAge(); age != 10*time.Second {
+		t.Errorf("Expected oldest age 10s after draining, got %v", age)
+	}
+
+	q.pop(context.Background())
+	if age := q.oldestAge(); age != 0 {
+		t.Errorf("Expected zero age after draining, got %v", age)
+	}
+}
+
+func TestJobQueuePopBlocksUntilPush(t *testing.T) {
+	q := newJobQueue()
+
+	got := make(chan string)
+	go func() {
+		id, _ := q.pop(context.Background())
+		got <- id
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	q.push("a", defaultPriority)
+
+	select {
+	case id := <-got:
+		if id != "a" {
+			t.Errorf("Expected 'a', got '%s'", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for pop")
+	}
+}
+
+func TestJobQueuePopCancelled(t *testing.T) {
+	q := newJobQueue()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, ok := q.pop(ctx); ok {
+		t.Error("Expected pop to fail on a cancelled context")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// rateLimitIdleTTL is how long a client's bucket is kept after its last
+// request before it is evicted
+const rateLimitIdleTTL = 3 * time.Minute
+
+// rateLimitersContextKey is the gin.Context key rateLimiter stores its
+// clientLimiters under, for chargeRateLimit
+const rateLimitersContextKey = "rateLimiters"
+
+// clientBucket is the token bucket for a single client along with the time
+// it was last used
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// clientLimiters hands out a token bucket per client IP. Buckets idle for
+// longer than idleTTL are swept lazily on access, so no background goroutine
+// is needed to keep memory bounded.
+type clientLimiters struct {
+	mu        sync.Mutex
+	limit     rate.Limit
+	burst     int
+	idleTTL   time.Duration
+	buckets   map[string]*clientBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// newClientLimiters creates a clientLimiters allowing rps requests per second
+// per client with bursts of up to burst requests
+func newClientLimiters(rps float64, burst int) *clientLimiters {
+	return &clientLimiters{
+		limit:   rate.Limit(rps),
+		burst:   burst,
+		idleTTL: rateLimitIdleTTL,
+		buckets: make(map[string]*clientBucket),
+		now:     time.Now,
+	}
+}
+
+// allow reports whether a request from ip may proceed, consuming a token if
+// so. When the request is rejected it also returns how long the client has to
+// wait before its next token is available.
+func (l *clientLimiters) allow(ip string) (bool, time.Duration) {
+	return l.allowN(ip, 1)
+}
+
+// allowN is like allow for a request costing n tokens. Requests costing
+// more than the burst are never allowed.
+func (l *clientLimiters) allowN(ip string, n int) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= l.idleTTL {
+		l.sweep(now)
+	}
+
+	bucket, ok := l.buckets[ip]
+	if !ok {
+		bucket = &clientBucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[ip] = bucket
+	}
+	bucket.lastSeen = now
+
+	reservation := bucket.limiter.ReserveN(now, n)
+	if !reservation.OK() {
+		return false, rate.InfDuration
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// sweep evicts buckets that have been idle for longer than idleTTL. The
+// caller must hold l.mu.
+func (l *clientLimiters) sweep(now time.Time) {
+	for ip, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) > l.idleTTL {
+			delete(l.buckets, ip)
+		}
+	}
+	l.lastSweep = now
+}
+
+// rateLimiter is a middleware that takes a token from the client IP's
+// bucket in limiters for each request, rejecting requests over the limit
+// with 429 and a Retry-After header. Routes sharing limiters share each
+// client's bucket.
+func rateLimiter(limiters *clientLimiters) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, retryAfter := limiters.allow(c.ClientIP())
+		if !allowed {
+			respondRateLimited(c, retryAfter)
+			return
+		}
+
+		c.Set(rateLimitersContextKey, limiters)
+		c.Next()
+	}
+}
+
+// chargeRateLimit takes n more tokens from the client's bucket for a request
+// that rateLimiter let through but that counts as several, such as a batch
+// of changes. It responds with 429 and returns false when the client is over
+// its limit. Requests without a rate limiter are always allowed.
+func chargeRateLimit(c *gin.Context, n int) bool {
+	value, _ := c.Get(rateLimitersContextKey)
+	limiters, ok := value.(*clientLimiters)
+	if !ok || n <= 0 {
+		return true
+	}
+
+	allowed, retryAfter := limiters.allowN(c.ClientIP(), n)
+	if !allowed {
+		respondRateLimited(c, retryAfter)
+	}
+	return allowed
+}
+
+// respondRateLimited rejects the request with 429 and a Retry-After header
+// of retryAfter, rounded up to whole seconds
+func respondRateLimited(c *gin.Context, retryAfter time.Duration) {
+	requestLogger(c).Warn("Rate limit exceeded", "ip", c.ClientIP(), "retryAfter", retryAfter.String())
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	respondError(c, http.StatusTooManyRequests, ErrorResponse{
+		Error:   "rate_limited",
+		Message: "Too many requests, please slow down",
+	})
+	c.Abort()
+}
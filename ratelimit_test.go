@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterRejectsAfterBurst(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config
+	cfg.RateLimitBurst = 3
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.GET("/health", rateLimiter(newClientLimiters(1, cfg.RateLimitBurst)), handleHealth)
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/health", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < cfg.RateLimitBurst; i++ {
+		if w := request("192.0.2.1"); w.Code != http.StatusOK {
+			t.Fatalf("Expected request %d within burst to succeed, got %d", i+1, w.Code)
+		}
+	}
+
+	w := request("192.0.2.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status 429 once burst is exhausted, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Expected Retry-After '1', got '%s'", got)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Error != "rate_limited" {
+		t.Errorf("Expected error 'rate_limited', got '%s'", response.Error)
+	}
+
+	if w := request("192.0.2.2"); w.Code != http.StatusOK {
+		t.Errorf("Expected other clients to be unaffected, got %d", w.Code)
+	}
+}
+
+func TestClientLimitersEvictIdleBuckets(t *testing.T) {
+	now := time.Now()
+	limiters := newClientLimiters(1, 1)
+	limiters.now = func() time.Time { return now }
+
+	if allowed, _ := limiters.allow("192.0.2.1"); !allowed {
+		t.Fatal("Expected first request to be allowed")
+	}
+	if allowed, _ := limiters.allow("192.0.2.1"); allowed {
+		t.Fatal("Expected second request to be limited")
+	}
+
+	now = now.Add(rateLimitIdleTTL + time.Second)
+	limiters.allow("192.0.2.2")
+
+	if _, ok := limiters.buckets["192.0.2.1"]; ok {
+		t.Error("Expected idle bucket to be evicted")
+	}
+	if len(limiters.buckets) != 1 {
+		t.Errorf("Expected 1 bucket after sweep, got %d", len(limiters.buckets))
+	}
+}
+
+func TestSubmissionRoutesShareRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	cfg := config
+	cfg.RateLimitRPM = 1
+	cfg.RateLimitBurst = 3
+	setConfig(t, cfg)
+
+	router := newRouter()
+	dryRun := validTestChange()
+	dryRun.Spec.DryRun = true
+
+	if w := postJSON(router, "/changes:batch", []Change{dryRun, dryRun}); w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected status 207, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := postJSON(router, "/change?dryRun=true", validTestChange()); w.Code == http.StatusTooManyRequests {
+		t.Fatal("Expected the third token to go to POST /change")
+	}
+	// The batch used two of the three tokens and POST /change the last
+	for _, path := range []string{"/change", "/changes/batch", "/changes:batch"} {
+		if w := postJSON(router, path, []Change{dryRun}); w.Code != http.StatusTooManyRequests {
+			t.Errorf("Expected %s to be throttled, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestUnknownBatchMethodNotRateLimited(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config
+	cfg.RateLimitRPM = 1
+	cfg.RateLimitBurst = 1
+	setConfig(t, cfg)
+
+	router := newRouter()
+	for i := 0; i < 2; i++ {
+		if w := postJSON(router, "/changes:purge", []Change{}); w.Code != http.StatusNotFound {
+			t.Fatalf("Expected status 404, got %d", w.Code)
+		}
+	}
+	if w := postJSON(router, "/change", Change{}); w.Code == http.StatusTooManyRequests {
+		t.Error("Expected unknown routes not to use up the rate limit")
+	}
+}
+
+func TestRateLimiterOnlyAppliesToSubmit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config
+	cfg.RateLimitRPM = 1
+	cfg.RateLimitBurst = 1
+	setConfig(t, cfg)
+
+	router := newRouter()
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "/health", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected /health to be unthrottled, got %d", w.Code)
+		}
+	}
+
+	postJSON(router, "/change", Change{})
+	if w := postJSON(router, "/change", Change{}); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected POST /change to be throttled, got %d", w.Code)
+	}
+}
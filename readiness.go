@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessCheckTimeout bounds how long a single probe may spend checking
+// dependencies
+const readinessCheckTimeout = 2 * time.Second
+
+// dependencyCheck reports whether a dependency is usable, returning an error
+// describing the problem when it is not
+type dependencyCheck func(ctx context.Context) error
+
+// readinessChecker runs registered dependency checks and caches successful
+// results for a short TTL so frequent probes don't hammer dependencies.
+// Failed results are never cached, so a failing dependency is re-checked on
+// every probe and recovery is reflected as soon as it happens.
+type readinessChecker struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	names   []string
+	checks  map[string]dependencyCheck
+	results map[string]string
+	ready   bool
+	expires time.Time
+	now     func() time.Time
+}
+
+var readiness *readinessChecker
+
+// newReadinessChecker creates a readinessChecker that caches successful
+// results for ttl
+func newReadinessChecker(ttl time.Duration) *readinessChecker {
+	return &readinessChecker{
+		ttl:    ttl,
+		checks: make(map[string]dependencyCheck),
+		now:    time.Now,
+	}
+}
+
+// register adds a named dependency check and invalidates any cached result
+func (r *readinessChecker) register(name string, check dependencyCheck) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.checks[name]; !ok {
+		r.names = append(r.names, name)
+	}
+	r.checks[name] = check
+	r.expires = time.Time{}
+}
+
+// check returns whether all dependencies are ready along with the status of
+// each one. Concurrent callers are serialized so that only one of them runs
+// the checks while the others reuse its result.
+func (r *readinessChecker) check(ctx context.Context) (bool, map[string]string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.now().Before(r.expires) {
+		return r.ready, copyResults(r.results)
+	}
+
+	ready := true
+	results := make(map[string]string, len(r.names))
+	for _, name := range r.names {
+		if err := r.checks[name](ctx); err != nil {
+			ready = false
+			results[name] = err.Error()
+			continue
+		}
+		results[name] = "ok"
+	}
+
+	r.ready = ready
+	r.results = results
+	if ready {
+		r.expires = r.now().Add(r.ttl)
+	} else {
+		r.expires = time.Time{}
+	}
+
+	return ready, copyResults(results)
+}
+
+// copyResults returns a copy of results that is safe to hand to callers
+func copyResults(results map[string]string) map[string]string {
+	out := make(map[string]string, len(results))
+	for name, result := range results {
+		out[name] = result
+	}
+	return out
+}
+
+// readinessState is a dependency that reports its own readiness rather than
+// being probed. It starts out not ready and is flipped with set.
+type readinessState struct {
+	mu  sync.RWMutex
+	err error
+}
+
+// storeReadiness reports whether the job store has been initialized
+var storeReadiness = newReadinessState(errors.New("job store not initialized"))
+
+// workerReadiness reports whether the worker pool is running and accepting
+// jobs
+var workerReadiness = newReadinessState(errors.New("workers not started"))
+
+// newReadinessState creates a readinessState that is not ready with err
+func newReadinessState(err error) *readinessState {
+	return &readinessState{err: err}
+}
+
+// set marks the dependency ready when err is nil and not ready otherwise
+func (s *readinessState) set(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+// check is a dependencyCheck reporting the current state
+func (s *readinessState) check(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.err
+}
+
+// handleLiveness handles liveness probe requests. It reports only that the
+// process is serving requests, so dependency failures never make an
+// orchestrator restart it.
+func handleLiveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive"})
+}
+
+// handleReadiness handles readiness probe requests
+func handleReadiness(c *gin.Context) {
+	log := requestLogger(c)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessCheckTimeout)
+	defer cancel()
+
+	ready, checks := readiness.check(ctx)
+	if !ready {
+		log.Warn("Readiness check failed", "checks", checks)
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status": "not_ready",
+			"checks": checks,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ready",
+		"checks": checks,
+	})
+}
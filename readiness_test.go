@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestReadinessCheckerCachesSuccess(t *testing.T) {
+	var calls int32
+	now := time.Now()
+
+	r := newReadinessChecker(time.Second)
+	r.now = func() time.Time { return now }
+	r.register("db", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		if ready, _ := r.check(context.Background()); !ready {
+			t.Fatalf("Expected ready on probe %d", i)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("Expected 1 dependency check within TTL, got %d", calls)
+	}
+
+	now = now.Add(time.Second)
+	r.check(context.Background())
+	if calls != 2 {
+		t.Errorf("Expected dependency to be re-checked after TTL, got %d checks", calls)
+	}
+}
+
+func TestReadinessCheckerDoesNotCacheFailure(t *testing.T) {
+	var calls int32
+	failing := true
+
+	r := newReadinessChecker(time.Minute)
+	r.register("bus", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		if failing {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+
+	ready, results := r.check(context.Background())
+	if ready {
+		t.Fatal("Expected not ready while dependency is failing")
+	}
+	if results["bus"] != "connection refused" {
+		t.Errorf("Expected failure reason in results, got %q", results["bus"])
+	}
+
+	failing = false
+	if ready, _ := r.check(context.Background()); !ready {
+		t.Error("Expected recovery to be reflected on the next probe")
+	}
+	if calls != 2 {
+		t.Errorf("Expected 2 dependency checks, got %d", calls)
+	}
+}
+
+func TestReadinessCheckerConcurrentProbes(t *testing.T) {
+	var calls int32
+
+	r := newReadinessChecker(time.Minute)
+	r.register("db", func(ctx context.Context) error {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.check(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("Expected concurrent probes to share 1 dependency check, got %d", calls)
+	}
+}
+
+func TestReadinessEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previous := readiness
+	t.Cleanup(func() { readiness = previous })
+
+	failing := false
+	readiness = newReadinessChecker(0)
+	readiness.register("db", func(ctx context.Context) error {
+		if failing {
+			return errors.New("unreachable")
+		}
+		return nil
+	})
+
+	router := gin.New()
+	router.GET("/readyz", handleReadiness)
+
+	tests := []struct {
+		name       string
+		failing    bool
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "ready", failing: false, wantStatus: http.StatusOK, wantBody: "ready"},
+		{name: "not ready", failing: true, wantStatus: http.StatusServiceUnavailable, wantBody: "not_ready"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failing = tt.failing
+
+			req, _ := http.NewRequest("GET", "/readyz", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+
+			var response map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+
+			if response["status"] != tt.wantBody {
+				t.Errorf("Expected status '%s', got '%v'", tt.wantBody, response["status"])
+			}
+		})
+	}
+}
+
+func TestReadyEndpointReflectsReadinessState(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previous := readiness
+	t.Cleanup(func() { readiness = previous })
+
+	state := newReadinessState(errors.New("job store not initialized"))
+	readiness = newReadinessChecker(0)
+	readiness.register("store", state.check)
+
+	router := newRouter()
+	probe := func() (int, map[string]interface{}) {
+		req, _ := http.NewRequest("GET", "/ready", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return w.Code, response
+	}
+
+	code, response := probe()
+	if code != http.StatusServiceUnavailable || response["status"] != "not_ready" {
+		t.Fatalf("Expected 503 not_ready before the store is initialized, got %d %v", code, response)
+	}
+	if checks := response["checks"].(map[string]interface{}); checks["store"] != "job store not initialized" {
+		t.Errorf("Expected store check to report why it isn't ready, got %v", checks)
+	}
+
+	state.set(nil)
+	if code, response := probe(); code != http.StatusOK || response["status"] != "ready" {
+		t.Errorf("Expected 200 ready once the store is initialized, got %d %v", code, response)
+	}
+
+	state.set(errors.New("shutting down"))
+	if code, _ := probe(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after readiness is flipped off, got %d", code)
+	}
+}
+
+func TestHealthzProbes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	previous := readiness
+	t.Cleanup(func() { readiness = previous })
+
+	workers := newReadinessState(errors.New("workers not started"))
+	readiness = newReadinessChecker(0)
+	readiness.register("store", func(ctx context.Context) error { return nil })
+	readiness.register("workers", workers.check)
+
+	router := newRouter()
+	probe := func(path string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return w.Code, response
+	}
+
+	// Liveness doesn't depend on the workers
+	if code, response := probe("/healthz/live"); code != http.StatusOK || response["status"] != "alive" {
+		t.Errorf("Expected /healthz/live to be alive, got %d %v", code, response)
+	}
+
+	code, response := probe("/healthz/ready")
+	if code != http.StatusServiceUnavailable || response["status"] != "not_ready" {
+		t.Fatalf("Expected not_ready before the workers start, got %d %v", code, response)
+	}
+	checks, _ := response["checks"].(map[string]interface{})
+	if checks["store"] != "ok" || checks["workers"] != "workers not started" {
+		t.Errorf("Expected per-dependency results, got %v", checks)
+	}
+
+	workers.set(nil)
+	if code, response := probe("/healthz/ready"); code != http.StatusOK || response["status"] != "ready" {
+		t.Errorf("Expected ready once the workers start, got %d %v", code, response)
+	}
+
+	if code, _ := probe("/health"); code != http.StatusOK {
+		t.Errorf("Expected /health to keep working, got %d", code)
+	}
+}
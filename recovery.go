@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ginRecovery is a middleware that recovers from panics in later handlers. The
+// panic and its stack trace are logged with the request ID, and the client
+// receives a JSON 500 internal_error that gives nothing of them away. A panic
+// caused by the client going away is only logged, since there is no one left to
+// respond to.
+func ginRecovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+
+			log := requestLogger(c)
+			if err, ok := recovered.(error); ok && isBrokenConnection(err) {
+				log.Warn("Client connection lost", "error", err, "path", c.Request.URL.Path)
+				c.Abort()
+				return
+			}
+
+			log.Error("Panic while handling request",
+				"panic", fmt.Sprint(recovered),
+				"method", c.Request.Method,
+				"path", c.Request.URL.Path,
+				"stack", string(debug.Stack()),
+			)
+
+			// A response that has already started can't be replaced
+			if c.Writer.Written() {
+				c.Abort()
+				return
+			}
+			respondError(c, http.StatusInternalServerError, ErrorResponse{
+				Error:   "internal_error",
+				Message: "an unexpected error occurred while handling the request",
+			})
+			c.Abort()
+		}()
+
+		c.Next()
+	}
+}
+
+// isBrokenConnection reports whether err came from writing to a client that
+// has closed its connection
+func isBrokenConnection(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGinRecovery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var buf bytes.Buffer
+	previous := logger
+	logger, _ = newLogger(&buf, "json", "info", &atomicLevel{})
+	t.Cleanup(func() { logger = previous })
+
+	router := gin.New()
+	router.Use(requestID(), ginRecovery())
+	router.GET("/panic", func(c *gin.Context) {
+		panic("secret internal detail")
+	})
+
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	req.Header.Set(requestIDHeader, "req-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected status 500, got %d", w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "application/json") {
+		t.Errorf("Expected a JSON response, got Content-Type '%s'", contentType)
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Error != "internal_error" {
+		t.Errorf("Expected error 'internal_error', got '%s'", response.Error)
+	}
+	if strings.Contains(w.Body.String(), "secret internal detail") || strings.Contains(w.Body.String(), "goroutine") {
+		t.Errorf("Expected the panic not to leak to the client, got %s", w.Body.String())
+	}
+
+	logged := buf.String()
+	for _, want := range []string{"Panic while handling request", "secret internal detail", "req-123", "recovery_test.go"} {
+		if !strings.Contains(logged, want) {
+			t.Errorf("Expected the log to contain %q, got %s", want, logged)
+		}
+	}
+}
+
+func TestGinRecoveryAfterResponseStarted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(ginRecovery())
+	router.GET("/panic", func(c *gin.Context) {
+		c.String(http.StatusOK, "partial")
+		panic("too late")
+	})
+
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "partial" {
+		t.Errorf("Expected the started response to be left alone, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Agent statuses reported by GET /agents
+const (
+	agentEnabled  = "enabled"
+	agentDisabled = "disabled"
+)
+
+// ErrAgentNotFound is returned for agents that aren't registered
+var ErrAgentNotFound = errors.New("agent not found")
+
+// AgentConfig holds the settings of a registered agent
+type AgentConfig struct {
+	// Timeout caps how long the agent may run a change, rounded down to
+	// whole seconds, when it is shorter than spec.timeoutSeconds; 0 leaves
+	// spec.timeoutSeconds in charge
+	Timeout time.Duration
+	// MaxConcurrency caps how many changes the agent runs at once, across
+	// workers; 0 means no cap
+	MaxConcurrency int
+	// Enabled reports whether the agent accepts changes
+	Enabled bool
+}
+
+// validate checks cfg, returning nil when it is valid
+func (cfg AgentConfig) validate() error {
+	if cfg.Timeout != 0 && cfg.Timeout < time.Second {
+		return fmt.Errorf("timeout must be 0 or at least 1s, got %s", cfg.Timeout)
+	}
+	if cfg.MaxConcurrency < 0 {
+		return fmt.Errorf("max concurrency must not be negative, got %d", cfg.MaxConcurrency)
+	}
+	return nil
+}
+
+// registeredAgent is an agent in an AgentRegistry, with the slots limiting
+// how many changes it runs at once when it has a MaxConcurrency
+type registeredAgent struct {
+	config AgentConfig
+	slots  chan struct{}
+}
+
+// AgentRegistry holds the agents changes can be sent to and their settings
+type AgentRegistry struct {
+	mu     sync.Mutex
+	agents map[string]*registeredAgent
+}
+
+// NewAgentRegistry creates an empty AgentRegistry
+func NewAgentRegistry() *AgentRegistry {
+	return &AgentRegistry{agents: make(map[string]*registeredAgent)}
+}
+
+// Register adds the agent name with cfg, failing if it is already
+// registered or cfg is invalid
+func (r *AgentRegistry) Register(name string, cfg AgentConfig) error {
+	if name == "" {
+		return errors.New("agent name must not be empty")
+	}
+	if err := cfg.validate(); err != nil {
+		return fmt.Errorf("agent %q: %w", name, err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.agents[name]; ok {
+		return fmt.Errorf("agent %q is already registered", name)
+	}
+	agent := &registeredAgent{config: cfg}
+	if cfg.MaxConcurrency > 0 {
+		agent.slots = make(chan struct{}, cfg.MaxConcurrency)
+	}
+	r.agents[name] = agent
+	return nil
+}
+
+// Config returns the settings of the agent name, or false when it isn't
+// registered
+func (r *AgentRegistry) Config(name string) (AgentConfig, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	agent, ok := r.agents[name]
+	if !ok {
+		return AgentConfig{}, false
+	}
+	return agent.config, true
+}
+
+// SetEnabled enables or disables the agent name, returning its updated
+// settings or ErrAgentNotFound
+func (r *AgentRegistry) SetEnabled(name string, enabled bool) (AgentConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	agent, ok := r.agents[name]
+	if !ok {
+		return AgentConfig{}, ErrAgentNotFound
+	}
+	agent.config.Enabled = enabled
+	return agent.config, nil
+}
+
+// Names returns the registered agents in sorted order
+func (r *AgentRegistry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.agents))
+	for name := range r.agents {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// acquire waits for the agent name to have a free slot under its
+// MaxConcurrency and claims it, returning the function that frees it, or
+// ctx's error if ctx ends first. Agents without a cap, and unregistered
+// ones, never wait.
+func (r *AgentRegistry) acquire(ctx context.Context, name string) (func(), error) {
+	r.mu.Lock()
+	agent, ok := r.agents[name]
+	r.mu.Unlock()
+	if !ok || agent.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case agent.slots <- struct{}{}:
+		return func() { <-agent.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// agentRegistry holds the agents changes can be sent to, loaded from
+// VALID_AGENTS, AGENT_TIMEOUTS and AGENT_MAX_CONCURRENCY at startup
+var agentRegistry = NewAgentRegistry()
+
+// loadAgentRegistry creates an AgentRegistry holding each of
+// cfg.ValidAgents, enabled and with its settings from cfg.AgentTimeouts and
+// cfg.AgentMaxConcurrency. An agent whose settings are invalid is logged and
+// registered with the defaults.
+func loadAgentRegistry(cfg Config) *AgentRegistry {
+	registry := NewAgentRegistry()
+	for _, name := range cfg.ValidAgents {
+		agentConfig := AgentConfig{
+			Timeout:        cfg.AgentTimeouts[name],
+			MaxConcurrency: cfg.AgentMaxConcurrency[name],
+			Enabled:        true,
+		}
+		if err := agentConfig.validate(); err != nil {
+			logger.Warn("Invalid agent settings, using defaults", "agent", name, "error", err)
+			agentConfig = AgentConfig{Enabled: true}
+		}
+		if err := registry.Register(name, agentConfig); err != nil {
+			logger.Warn("Failed to register agent", "agent", name, "error", err)
+		}
+	}
+	for name := range cfg.AgentTimeouts {
+		if !slices.Contains(cfg.ValidAgents, name) {
+			logger.Warn("AGENT_TIMEOUTS names an agent missing from VALID_AGENTS, ignoring it", "agent", name)
+		}
+	}
+	for name := range cfg.AgentMaxConcurrency {
+		if !slices.Contains(cfg.ValidAgents, name) {
+			logger.Warn("AGENT_MAX_CONCURRENCY names an agent missing from VALID_AGENTS, ignoring it", "agent", name)
+		}
+	}
+	return registry
+}
+
+// parseAgentTimeouts parses AGENT_TIMEOUTS entries of the form
+// agent:duration, such as "copilot-cli:5m", into each agent's timeout.
+// Malformed entries are logged and skipped.
+func parseAgentTimeouts(entries []string) map[string]time.Duration {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range entries {
+		agent, value, ok := strings.Cut(entry, ":")
+		agent, value = strings.TrimSpace(agent), strings.TrimSpace(value)
+		d, err := time.ParseDuration(value)
+		if !ok || agent == "" || err != nil {
+			logger.Warn("Invalid AGENT_TIMEOUTS entry, ignoring it", "value", entry)
+			continue
+		}
+		timeouts[agent] = d
+	}
+	return timeouts
+}
+
+// parseAgentMaxConcurrency parses AGENT_MAX_CONCURRENCY entries of the form
+// agent:count, such as "copilot-cli:2", into each agent's concurrency cap.
+// Malformed entries are logged and skipped.
+func parseAgentMaxConcurrency(entries []string) map[string]int {
+	limits := make(map[string]int)
+	for _, entry := range entries {
+		agent, value, ok := strings.Cut(entry, ":")
+		agent, value = strings.TrimSpace(agent), strings.TrimSpace(value)
+		n, err := strconv.Atoi(value)
+		if !ok || agent == "" || err != nil {
+			logger.Warn("Invalid AGENT_MAX_CONCURRENCY entry, ignoring it", "value", entry)
+			continue
+		}
+		limits[agent] = n
+	}
+	return limits
+}
+
+// isAgentEnabled reports whether changes may be sent to agent, which must be
+// registered in agentRegistry and enabled
+func isAgentEnabled(agent string) bool {
+	cfg, ok := agentRegistry.Config(agent)
+	return ok && cfg.Enabled
+}
+
+// AgentInfo describes a registered agent in GET /agents
+type AgentInfo struct {
+	Name   string          `json:"name"`
+	Status string          `json:"status"`
+	Config AgentConfigInfo `json:"config"`
+}
+
+// AgentConfigInfo is the JSON form of an AgentConfig, with the timeout
+// written like "30s"
+type AgentConfigInfo struct {
+	Timeout        string `json:"timeout"`
+	MaxConcurrency int    `json:"maxConcurrency"`
+	Enabled        bool   `json:"enabled"`
+}
+
+// agentInfo returns the GET /agents description of the agent name with cfg
+func agentInfo(name string, cfg AgentConfig) AgentInfo {
+	status := agentEnabled
+	if !cfg.Enabled {
+		status = agentDisabled
+	}
+	return AgentInfo{
+		Name:   name,
+		Status: status,
+		Config: AgentConfigInfo{
+			Timeout:        cfg.Timeout.String(),
+			MaxConcurrency: cfg.MaxConcurrency,
+			Enabled:        cfg.Enabled,
+		},
+	}
+}
+
+// handleListAgents handles requests for the registered agents
+func handleListAgents(c *gin.Context) {
+	names := agentRegistry.Names()
+	agents := make([]AgentInfo, 0, len(names))
+	for _, name := range names {
+		if cfg, ok := agentRegistry.Config(name); ok {
+			agents = append(agents, agentInfo(name, cfg))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"agents": agents})
+}
+
+// AgentUpdateRequest is the body of PUT /agents/:name
+type AgentUpdateRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// handleUpdateAgent handles admin requests to enable or disable an agent
+func handleUpdateAgent(c *gin.Context) {
+	log := requestLogger(c)
+	name := c.Param("name")
+
+	var req AgentUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error("Failed to bind agent update", "error", err)
+		respondBindError(c, err)
+		return
+	}
+
+	cfg, err := agentRegistry.SetEnabled(name, *req.Enabled)
+	if err != nil {
+		log.Warn("Agent not found", "agent", name)
+		respondError(c, http.StatusNotFound, ErrorResponse{
+			Error:   "agent_not_found",
+			Message: fmt.Sprintf("no agent named %q", name),
+		})
+		return
+	}
+	log.Warn("Agent updated", "agent", name, "enabled", cfg.Enabled)
+
+	c.JSON(http.StatusOK, agentInfo(name, cfg))
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// isolateAgentRegistry replaces agentRegistry with an empty registry for the
+// duration of a test
+func isolateAgentRegistry(t *testing.T) *AgentRegistry {
+	t.Helper()
+
+	previous := agentRegistry
+	agentRegistry = NewAgentRegistry()
+	t.Cleanup(func() { agentRegistry = previous })
+	return agentRegistry
+}
+
+func TestAgentRegistryRegister(t *testing.T) {
+	registry := NewAgentRegistry()
+
+	if err := registry.Register("copilot-cli", AgentConfig{Timeout: time.Minute, MaxConcurrency: 2, Enabled: true}); err != nil {
+		t.Fatalf("Failed to register agent: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		agent string
+		cfg   AgentConfig
+	}{
+		{"duplicate", "copilot-cli", AgentConfig{Enabled: true}},
+		{"empty name", "", AgentConfig{Enabled: true}},
+		{"sub-second timeout", "gemini-cli", AgentConfig{Timeout: time.Millisecond}},
+		{"negative concurrency", "gemini-cli", AgentConfig{MaxConcurrency: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := registry.Register(tt.agent, tt.cfg); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+
+	cfg, ok := registry.Config("copilot-cli")
+	if !ok || cfg.Timeout != time.Minute || cfg.MaxConcurrency != 2 || !cfg.Enabled {
+		t.Errorf("Expected the registered config, got %+v", cfg)
+	}
+	if _, ok := registry.Config("gemini-cli"); ok {
+		t.Error("Expected gemini-cli not to be registered")
+	}
+}
+
+func TestLoadAgentRegistry(t *testing.T) {
+	t.Setenv("VALID_AGENTS", "copilot-cli,gemini-cli,claude-cli")
+	t.Setenv("AGENT_TIMEOUTS", "copilot-cli:5m,gemini-cli:10ms,claude-cli:soon")
+	t.Setenv("AGENT_MAX_CONCURRENCY", "copilot-cli:2,gemini-cli:-1")
+	registry := loadAgentRegistry(loadConfig())
+
+	tests := []struct {
+		agent string
+		want  AgentConfig
+	}{
+		{"copilot-cli", AgentConfig{Timeout: 5 * time.Minute, MaxConcurrency: 2, Enabled: true}},
+		// Invalid settings fall back to the defaults
+		{"gemini-cli", AgentConfig{Enabled: true}},
+		{"claude-cli", AgentConfig{Enabled: true}},
+	}
+	for _, tt := range tests {
+		if cfg, ok := registry.Config(tt.agent); !ok || cfg != tt.want {
+			t.Errorf("Expected %s to be registered with %+v, got %+v", tt.agent, tt.want, cfg)
+		}
+	}
+}
+
+func TestAgentsEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	registry := isolateAgentRegistry(t)
+	registry.Register("gemini-cli", AgentConfig{Enabled: true})
+	registry.Register("copilot-cli", AgentConfig{Timeout: 90 * time.Second, MaxConcurrency: 2, Enabled: true})
+
+	router := gin.New()
+	router.GET("/agents", handleListAgents)
+	router.PUT("/agents/:name", handleUpdateAgent)
+	router.POST("/change", handleChange)
+
+	listAgents := func() []AgentInfo {
+		req, _ := http.NewRequest("GET", "/agents", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response struct {
+			Agents []AgentInfo `json:"agents"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return response.Agents
+	}
+	updateAgent := func(name, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", "/agents/"+name, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	agents := listAgents()
+	want := AgentInfo{Name: "copilot-cli", Status: agentEnabled, Config: AgentConfigInfo{Timeout: "1m30s", MaxConcurrency: 2, Enabled: true}}
+	if len(agents) != 2 || agents[0] != want || agents[1].Name != "gemini-cli" {
+		t.Fatalf("Expected copilot-cli then gemini-cli, got %+v", agents)
+	}
+
+	if w := updateAgent("copilot-cli", `{"enabled": false}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"disabled"`) {
+		t.Fatalf("Expected the agent to be disabled, got %d: %s", w.Code, w.Body.String())
+	}
+	if agents := listAgents(); agents[0].Status != agentDisabled || agents[0].Config.Enabled {
+		t.Errorf("Expected copilot-cli to be listed as disabled, got %+v", agents[0])
+	}
+
+	// Changes for a disabled agent are rejected
+	w := postJSON(router, "/change", validTestChange())
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "agent_disabled") {
+		t.Errorf("Expected 400 agent_disabled, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// Only registered agents are valid
+	unregistered := validTestChange()
+	unregistered.Spec.Agent = "claude-cli"
+	if w := postJSON(router, "/change", unregistered); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_agent") {
+		t.Errorf("Expected 400 invalid_agent for an unregistered agent, got %d: %s", w.Code, w.Body.String())
+	}
+
+	updateAgent("copilot-cli", `{"enabled": true}`)
+	if w := postJSON(router, "/change", validTestChange()); w.Code != http.StatusAccepted {
+		t.Errorf("Expected status 202 once re-enabled, got %d: %s", w.Code, w.Body.String())
+	}
+
+	if w := updateAgent("unknown-cli", `{"enabled": false}`); w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "agent_not_found") {
+		t.Errorf("Expected 404 agent_not_found, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := updateAgent("copilot-cli", `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without enabled, got %d", w.Code)
+	}
+}
+
+func TestProcessJobDisabledAgent(t *testing.T) {
+	isolateJobs(t)
+	registry := isolateAgentRegistry(t)
+	registry.Register("copilot-cli", AgentConfig{Enabled: true})
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	registry.SetEnabled("copilot-cli", false)
+	processJob(context.Background(), job.ID)
+
+	got, _ := store.Get(job.ID)
+	if got.Status != statusFailed || got.Error != "agent_disabled" {
+		t.Errorf("Expected a queued change to fail once its agent is disabled, got '%s' '%s'", got.Status, got.Error)
+	}
+}
+
+func TestProcessJobAgentMaxConcurrency(t *testing.T) {
+	isolateJobs(t)
+	registry := isolateAgentRegistry(t)
+	registry.Register("copilot-cli", AgentConfig{MaxConcurrency: 1, Enabled: true})
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return ChangeResult{}, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			processJob(context.Background(), job.ID)
+		}()
+	}
+	wg.Wait()
+
+	if peak != 1 {
+		t.Errorf("Expected at most 1 change to run at once, got %d", peak)
+	}
+}
+
+func TestProcessJobAgentTimeout(t *testing.T) {
+	isolateJobs(t)
+	registry := isolateAgentRegistry(t)
+	registry.Register("copilot-cli", AgentConfig{Timeout: 2 * time.Second, Enabled: true})
+	previous := timeoutUnit
+	timeoutUnit = 10 * time.Millisecond
+	t.Cleanup(func() { timeoutUnit = previous })
+
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		<-ctx.Done()
+		return ChangeResult{}, ctx.Err()
+	})
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli", TimeoutSeconds: 300})
+	processJob(context.Background(), job.ID)
+
+	got, _ := store.Get(job.ID)
+	if got.Error != "timeout" || got.Message != "change did not finish within 2 seconds" {
+		t.Errorf("Expected the agent's shorter timeout to apply, got '%s' %q", got.Error, got.Message)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RepoRef is an entry in spec.repos: a repository URL and, optionally, the
+// branch to target in it instead of spec.branch. It is written as a plain
+// URL string when no branch is set.
+type RepoRef struct {
+	URL    string `json:"url"`
+	Branch string `json:"branch,omitempty"`
+}
+
+// UnmarshalJSON accepts either a URL string or a {"url", "branch"} object
+func (r *RepoRef) UnmarshalJSON(data []byte) error {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '"' {
+		*r = RepoRef{}
+		return json.Unmarshal(trimmed, &r.URL)
+	}
+
+	// A separate type avoids recursing into this method
+	type repoObject RepoRef
+	var obj repoObject
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&obj); err != nil {
+		return fmt.Errorf("repository must be a URL string or an object with url and branch: %w", err)
+	}
+	*r = RepoRef(obj)
+	return nil
+}
+
+// MarshalJSON writes r as its URL when it has no branch override, so changes
+// that only use URLs round-trip unchanged
+func (r RepoRef) MarshalJSON() ([]byte, error) {
+	if r.Branch == "" {
+		return json.Marshal(r.URL)
+	}
+	type repoObject RepoRef
+	return json.Marshal(repoObject(r))
+}
+
+// repoRefs returns a RepoRef without a branch override for each URL
+func repoRefs(urls ...string) []RepoRef {
+	refs := make([]RepoRef, len(urls))
+	for i, url := range urls {
+		refs[i] = RepoRef{URL: url}
+	}
+	return refs
+}
+
+// repoURLs returns the URL of each repository in repos
+func repoURLs(repos []RepoRef) []string {
+	urls := make([]string, len(repos))
+	for i, repo := range repos {
+		urls[i] = repo.URL
+	}
+	return urls
+}
+
+// repoBranches maps each repository URL in spec to the branch the change
+// targets there: its own override, falling back to spec.branch
+func (spec ChangeSpec) repoBranches() map[string]string {
+	branches := make(map[string]string, len(spec.Repos))
+	for _, repo := range spec.Repos {
+		branch := repo.Branch
+		if branch == "" {
+			branch = spec.Branch
+		}
+		branches[repo.URL] = branch
+	}
+	return branches
+}
+
+// normalizeRepoURL returns the canonical form of a valid repository URL, so
+// that spellings of the same repository compare equal: the host is
+// lowercased and trailing slashes and a ".git" suffix are removed. The path
+// keeps its case, as hosts may treat it case-sensitively. URLs that fail
+// validateRepoURL are returned unchanged so errors quote them as written.
+func normalizeRepoURL(repo string) string {
+	if validateRepoURL(repo) != nil {
+		return repo
+	}
+
+	// Split off the host: after "scheme://" and any user, up to the first
+	// '/', or between the '@' and ':' of an scp-like git@host:path
+	prefix, rest := "", repo
+	if scheme, after, ok := strings.Cut(repo, "://"); ok {
+		prefix, rest = scheme+"://", after
+	}
+	authorityEnd := len(rest)
+	if prefix != "" {
+		if slash := strings.IndexByte(rest, '/'); slash >= 0 {
+			authorityEnd = slash
+		}
+	}
+	hostStart := strings.LastIndex(rest[:authorityEnd], "@") + 1
+	hostEnd := authorityEnd
+	if prefix == "" {
+		hostEnd = hostStart + strings.IndexByte(rest[hostStart:], ':')
+		if strings.HasPrefix(rest[hostStart:], "[") {
+			hostEnd = hostStart + strings.IndexByte(rest[hostStart:], ']') + 1
+		}
+	}
+	host, path := rest[hostStart:hostEnd], rest[hostEnd:]
+
+	path = strings.TrimRight(path, "/")
+	path = strings.TrimSuffix(path, ".git")
+	path = strings.TrimRight(path, "/")
+
+	return prefix + rest[:hostStart] + strings.ToLower(host) + path
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRepoRefJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    []RepoRef
+		wantErr bool
+	}{
+		{"strings", `["https://github.com/myorg/repo1", "https://github.com/myorg/repo2"]`,
+			repoRefs("https://github.com/myorg/repo1", "https://github.com/myorg/repo2"), false},
+		{"objects", `[{"url": "https://github.com/myorg/repo1", "branch": "develop"}]`,
+			[]RepoRef{{URL: "https://github.com/myorg/repo1", Branch: "develop"}}, false},
+		{"mixed", `["https://github.com/myorg/repo1", {"url": "https://github.com/myorg/repo2", "branch": "release/1.2"}]`,
+			[]RepoRef{{URL: "https://github.com/myorg/repo1"}, {URL: "https://github.com/myorg/repo2", Branch: "release/1.2"}}, false},
+		{"object without branch", `[{"url": "https://github.com/myorg/repo1"}]`,
+			repoRefs("https://github.com/myorg/repo1"), false},
+		{"unknown field", `[{"url": "https://github.com/myorg/repo1", "ref": "develop"}]`, nil, true},
+		{"number", `[42]`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []RepoRef
+			err := json.Unmarshal([]byte(tt.data), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRepoRefMarshal(t *testing.T) {
+	repos := []RepoRef{{URL: "https://github.com/myorg/repo1"}, {URL: "https://github.com/myorg/repo2", Branch: "develop"}}
+
+	data, err := json.Marshal(repos)
+	if err != nil {
+		t.Fatalf("Failed to marshal repos: %v", err)
+	}
+
+	// Repos without an override stay plain strings
+	want := `["https://github.com/myorg/repo1",{"url":"https://github.com/myorg/repo2","branch":"develop"}]`
+	if string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+}
+
+func TestRepoBranches(t *testing.T) {
+	spec := ChangeSpec{
+		Branch: "main",
+		Repos:  []RepoRef{{URL: "https://github.com/myorg/repo1"}, {URL: "https://github.com/myorg/repo2", Branch: "develop"}},
+	}
+
+	want := map[string]string{
+		"https://github.com/myorg/repo1": "main",
+		"https://github.com/myorg/repo2": "develop",
+	}
+	if got := spec.repoBranches(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestChangeEndpointRepoBranches(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	body := map[string]interface{}{
+		"kind":       "Change",
+		"apiVersion": "v1",
+		"spec": map[string]interface{}{
+			"prompt": "Bump the shared client",
+			"repos": []interface{}{
+				"https://github.com/myorg/repo1",
+				map[string]string{"url": "https://github.com/myorg/repo2", "branch": "develop"},
+			},
+			"agent": "copilot-cli",
+		},
+	}
+
+	w := postJSON(router, "/change", body)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Change Change `json:"change"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	want := []RepoRef{{URL: "https://github.com/myorg/repo1"}, {URL: "https://github.com/myorg/repo2", Branch: "develop"}}
+	if !reflect.DeepEqual(response.Change.Spec.Repos, want) {
+		t.Errorf("Expected repos %+v, got %+v", want, response.Change.Spec.Repos)
+	}
+
+	body["spec"].(map[string]interface{})["repos"] = []interface{}{
+		map[string]string{"url": "https://github.com/myorg/repo1", "branch": "bad..branch"},
+	}
+	w = postJSON(router, "/change", body)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+
+	var errResp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("Failed to unmarshal error: %v", err)
+	}
+	if errResp.Error != "invalid_branch" || len(errResp.Errors) != 1 || errResp.Errors[0].Field != "spec.repos[0].branch" {
+		t.Errorf("Expected invalid_branch on spec.repos[0].branch, got %+v", errResp)
+	}
+}
+
+func TestNormalizeRepoURL(t *testing.T) {
+	tests := []struct {
+		repo string
+		want string
+	}{
+		{"https://github.com/myorg/repo", "https://github.com/myorg/repo"},
+		{"https://github.com/myorg/repo.git", "https://github.com/myorg/repo"},
+		{"https://github.com/myorg/repo/", "https://github.com/myorg/repo"},
+		{"https://github.com/myorg/repo.git/", "https://github.com/myorg/repo"},
+		{"https://GitHub.COM/MyOrg/Repo", "https://github.com/MyOrg/Repo"},
+		{"ssh://Git@GitHub.com:22/myorg/repo.git", "ssh://Git@github.com:22/myorg/repo"},
+		{"git@GitHub.com:myorg/repo.git", "git@github.com:myorg/repo"},
+		{"https://github.com", "https://github.com"},
+		// Invalid URLs are left for validation to report as written
+		{"not a url/", "not a url/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repo, func(t *testing.T) {
+			if got := normalizeRepoURL(tt.repo); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestApplyChangeDefaultsNormalizesRepos(t *testing.T) {
+	change := validTestChange()
+	change.Spec.Repos = []RepoRef{{URL: "https://GitHub.com/myorg/repo1.git"}, {URL: "git@github.com:myorg/repo2/", Branch: "develop"}}
+
+	applyChangeDefaults(&change)
+
+	want := []RepoRef{{URL: "https://github.com/myorg/repo1"}, {URL: "git@github.com:myorg/repo2", Branch: "develop"}}
+	if !reflect.DeepEqual(change.Spec.Repos, want) {
+		t.Errorf("Expected repos %+v, got %+v", want, change.Spec.Repos)
+	}
+}
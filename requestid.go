@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Request ID header and gin.Context key
+const (
+	requestIDHeader     = "X-Request-ID"
+	requestIDContextKey = "requestID"
+)
+
+// requestIDKey is the context.Context key holding the request ID, so code
+// that only has the request's context can still log it
+type requestIDKey struct{}
+
+// maxRequestIDLength bounds incoming request IDs so clients can't bloat logs
+const maxRequestIDLength = 128
+
+// requestID is a middleware that tags each request with an ID, reusing the
+// caller's X-Request-ID when it is supplied and generating one otherwise.
+// The ID is stored on the gin.Context and the request's context.Context, and
+// echoed back in the response header.
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newID()
+		}
+
+		c.Set(requestIDContextKey, id)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDKey{}, id))
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// requestLogger returns the logger for c, tagged with its request ID
+func requestLogger(c *gin.Context) *slog.Logger {
+	if id := c.GetString(requestIDContextKey); id != "" {
+		return logger.With("requestId", id)
+	}
+	return logger
+}
+
+// contextLogger returns the logger for the request ctx belongs to, tagged
+// with its request ID
+func contextLogger(ctx context.Context) *slog.Logger {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return logger.With("requestId", id)
+	}
+	return logger
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDGeneratedWhenAbsent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(requestID())
+	router.GET("/health", handleHealth)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if id := w.Header().Get(requestIDHeader); !uuidPattern.MatchString(id) {
+		t.Errorf("Expected a generated UUID request ID, got '%s'", id)
+	}
+}
+
+func TestRequestIDPreservedAndLogged(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logs bytes.Buffer
+	previous := logger
+	logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	t.Cleanup(func() { logger = previous })
+
+	router := gin.New()
+	router.Use(requestID(), ginLogger())
+	router.GET("/health", handleHealth)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set(requestIDHeader, "trace-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if got := w.Header().Get(requestIDHeader); got != "trace-123" {
+		t.Errorf("Expected supplied request ID to be echoed, got '%s'", got)
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a handler and a request log line, got %d", len(lines))
+	}
+	for _, line := range lines {
+		var entry map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Failed to unmarshal log line: %v", err)
+		}
+		if entry["requestId"] != "trace-123" {
+			t.Errorf("Expected requestId 'trace-123' in %s", line)
+		}
+	}
+}
+
+func TestRequestIDTooLongIsReplaced(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(requestID())
+	router.GET("/health", handleHealth)
+
+	req := httptest.NewRequest("GET", "/health", nil)
+	req.Header.Set(requestIDHeader, strings.Repeat("a", maxRequestIDLength+1))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if id := w.Header().Get(requestIDHeader); !uuidPattern.MatchString(id) {
+		t.Errorf("Expected an oversized request ID to be replaced, got '%s'", id)
+	}
+}
+
+func TestRequestIDOnRequestContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var logs bytes.Buffer
+	previous := logger
+	logger = slog.New(slog.NewJSONHandler(&logs, nil))
+	t.Cleanup(func() { logger = previous })
+
+	router := gin.New()
+	router.Use(requestID())
+	router.GET("/work", func(c *gin.Context) {
+		// Code below the handler only sees the request's context
+		contextLogger(c.Request.Context()).Info("Doing work")
+		c.Status(http.StatusNoContent)
+	})
+
+	req := httptest.NewRequest("GET", "/work", nil)
+	req.Header.Set(requestIDHeader, "ctx-456")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatalf("Failed to unmarshal log line: %v", err)
+	}
+	if entry["requestId"] != "ctx-456" {
+		t.Errorf("Expected requestId 'ctx-456' from the request context, got %v", entry["requestId"])
+	}
+
+	if contextLogger(context.Background()) != logger {
+		t.Error("Expected the base logger outside a request")
+	}
+}
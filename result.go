@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxOutputSizeKBLimit is the largest spec.maxOutputSizeKB accepted (100 MB)
+const maxOutputSizeKBLimit = 102400
+
+// maxTokensLimit is the largest spec.maxTokens accepted
+const maxTokensLimit = 100000
+
+// ChangeResult holds the artifacts an agent produced for a change
+type ChangeResult struct {
+	Diff         string `json:"diff,omitempty"`
+	Logs         string `json:"logs,omitempty"`
+	TestOutput   string `json:"testOutput,omitempty"`
+	DocChanges   string `json:"docChanges,omitempty"`
+	OutputSizeKB int    `json:"outputSizeKB"`
+	// ImpactAnalysis is the agent's assessment of the change's blast radius
+	ImpactAnalysis *ImpactAnalysis `json:"impactAnalysis,omitempty"`
+	// InstrumentedFunctions lists the functions the agent instrumented when
+	// an observability integration was requested
+	InstrumentedFunctions []string `json:"instrumentedFunctions,omitempty"`
+	// IssueLinked reports whether the PR description references the
+	// requested linked issue
+	IssueLinked bool `json:"issueLinked,omitempty"`
+	// CommitSigningMethod is the method the agent signed its commits with,
+	// empty when they were not signed
+	CommitSigningMethod string `json:"commitSigningMethod,omitempty"`
+	// TokensUsed and TokensMax are the tokens the agent consumed and its
+	// budget, when the agent reports token usage
+	TokensUsed int `json:"tokensUsed,omitempty"`
+	TokensMax  int `json:"tokensMax,omitempty"`
+	// TokenEfficiency is TokensUsed per changed line in Diff, recorded for
+	// analytics
+	TokenEfficiency float64 `json:"tokenEfficiency,omitempty"`
+	// CommitSHA and PRURL identify the commit the agent pushed and the pull
+	// request it opened. They belong to a single repository, so they are
+	// reported in the job's repoResults and dropped by mergeResults.
+	CommitSHA string `json:"commitSHA,omitempty"`
+	PRURL     string `json:"prURL,omitempty"`
+}
+
+// ImpactAnalysis describes the downstream effect of a change, as determined
+// by the agent from an AST or OpenAPI diff
+type ImpactAnalysis struct {
+	BreakingChanges  bool     `json:"breakingChanges"`
+	AffectedServices []string `json:"affectedServices"`
+}
+
+// mergeResults combines the results of a change's runs in two of its
+// repositories: artifacts are concatenated, token usage is summed and the
+// impact analyses are united
+func mergeResults(a, b ChangeResult) ChangeResult {
+	join := func(x, y string) string {
+		if x == "" || y == "" {
+			return x + y
+		}
+		return x + "\n" + y
+	}
+
+	merged := ChangeResult{
+		Diff:                  join(a.Diff, b.Diff),
+		Logs:                  join(a.Logs, b.Logs),
+		TestOutput:            join(a.TestOutput, b.TestOutput),
+		DocChanges:            join(a.DocChanges, b.DocChanges),
+		InstrumentedFunctions: append(append([]string(nil), a.InstrumentedFunctions...), b.InstrumentedFunctions...),
+		IssueLinked:           a.IssueLinked || b.IssueLinked,
+		CommitSigningMethod:   a.CommitSigningMethod,
+		TokensUsed:            a.TokensUsed + b.TokensUsed,
+		TokensMax:             a.TokensMax,
+	}
+	if merged.CommitSigningMethod == "" {
+		merged.CommitSigningMethod = b.CommitSigningMethod
+	}
+	if merged.TokensMax == 0 {
+		merged.TokensMax = b.TokensMax
+	}
+	if len(merged.InstrumentedFunctions) == 0 {
+		merged.InstrumentedFunctions = nil
+	}
+
+	if a.ImpactAnalysis != nil || b.ImpactAnalysis != nil {
+		merged.ImpactAnalysis = &ImpactAnalysis{}
+		seen := make(map[string]bool)
+		for _, analysis := range []*ImpactAnalysis{a.ImpactAnalysis, b.ImpactAnalysis} {
+			if analysis == nil {
+				continue
+			}
+			merged.ImpactAnalysis.BreakingChanges = merged.ImpactAnalysis.BreakingChanges || analysis.BreakingChanges
+			for _, service := range analysis.AffectedServices {
+				if !seen[service] {
+					seen[service] = true
+					merged.ImpactAnalysis.AffectedServices = append(merged.ImpactAnalysis.AffectedServices, service)
+				}
+			}
+		}
+	}
+	return merged
+}
+
+// codedError is an error carrying a machine-readable code, used to report
+// why a change was failed after the agent ran
+type codedError struct {
+	Code    string
+	Message string
+}
+
+func (e *codedError) Error() string {
+	return e.Message
+}
+
+// checkResult records derived fields on result and applies every gate
+// configured in spec, returning the first failure
+func checkResult(spec ChangeSpec, result *ChangeResult) error {
+	result.OutputSizeKB = outputSizeKB(*result)
+	if result.TokensMax == 0 {
+		result.TokensMax = spec.MaxTokens
+	}
+	result.TokenEfficiency = tokenEfficiency(*result)
+
+	if err := checkOutputSize(*result, spec.MaxOutputSizeKB); err != nil {
+		return err
+	}
+
+	if err := checkTokenBudget(*result, spec.MaxTokens); err != nil {
+		return err
+	}
+
+	if err := checkImpactScope(*result, spec.ImpactScope); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// outputSizeBytes returns the combined size of all artifacts in result
+func outputSizeBytes(result ChangeResult) int {
+	return len(result.Diff) + len(result.Logs) + len(result.TestOutput) + len(result.DocChanges)
+}
+
+// outputSizeKB returns the combined size of all artifacts in result in
+// kilobytes, rounded up
+func outputSizeKB(result ChangeResult) int {
+	return (outputSizeBytes(result) + 1023) / 1024
+}
+
+// checkOutputSize returns an output_size_exceeded error when the artifacts in
+// result are larger than maxKB kilobytes. A maxKB of 0 disables the check.
+func checkOutputSize(result ChangeResult, maxKB int) error {
+	if maxKB <= 0 {
+		return nil
+	}
+
+	if outputSizeBytes(result) > maxKB*1024 {
+		return &codedError{
+			Code:    "output_size_exceeded",
+			Message: fmt.Sprintf("agent output is %d KB, maximum allowed is %d KB", outputSizeKB(result), maxKB),
+		}
+	}
+
+	return nil
+}
+
+// changedLines counts the added and removed lines in a unified diff
+func changedLines(diff string) int {
+	n := 0
+	for _, line := range strings.Split(diff, "\n") {
+		if strings.HasPrefix(line, "+++") || strings.HasPrefix(line, "---") {
+			continue
+		}
+		if strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-") {
+			n++
+		}
+	}
+	return n
+}
+
+// tokenEfficiency returns the tokens used per changed line in result, or 0
+// when no usage was reported or nothing changed
+func tokenEfficiency(result ChangeResult) float64 {
+	lines := changedLines(result.Diff)
+	if result.TokensUsed == 0 || lines == 0 {
+		return 0
+	}
+	return float64(result.TokensUsed) / float64(lines)
+}
+
+// checkTokenBudget returns a token_budget_exceeded error when the agent
+// reported using more than maxTokens tokens. A maxTokens of 0 disables the
+// check.
+func checkTokenBudget(result ChangeResult, maxTokens int) error {
+	if maxTokens <= 0 || result.TokensUsed <= maxTokens {
+		return nil
+	}
+
+	return &codedError{
+		Code:    "token_budget_exceeded",
+		Message: fmt.Sprintf("agent used %d tokens, maximum allowed is %d", result.TokensUsed, maxTokens),
+	}
+}
+
+// checkImpactScope fails a change whose impact analysis exceeds scope. A nil
+// scope disables the check.
+func checkImpactScope(result ChangeResult, scope *ImpactScopeConfig) error {
+	if scope == nil {
+		return nil
+	}
+
+	if result.ImpactAnalysis == nil {
+		return &codedError{
+			Code:    "impact_analysis_missing",
+			Message: "agent did not report an impact analysis",
+		}
+	}
+
+	if result.ImpactAnalysis.BreakingChanges && !scope.AllowBreakingChanges {
+		return &codedError{
+			Code:    "breaking_change_detected",
+			Message: "change introduces breaking API changes",
+		}
+	}
+
+	affected := len(result.ImpactAnalysis.AffectedServices)
+	if scope.MaxDownstreamServices > 0 && affected > scope.MaxDownstreamServices {
+		return &codedError{
+			Code:    "too_many_affected_services",
+			Message: fmt.Sprintf("change affects %d downstream services, maximum allowed is %d", affected, scope.MaxDownstreamServices),
+		}
+	}
+
+	return nil
+}
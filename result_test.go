@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckOutputSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  ChangeResult
+		maxKB   int
+		wantErr bool
+	}{
+		{
+			name:   "no cap",
+			result: ChangeResult{Diff: strings.Repeat("x", 10*1024)},
+			maxKB:  0,
+		},
+		{
+			name:   "empty output",
+			result: ChangeResult{},
+			maxKB:  1,
+		},
+		{
+			name:   "exactly at cap",
+			result: ChangeResult{Diff: strings.Repeat("x", 1024)},
+			maxKB:  1,
+		},
+		{
+			name:    "one byte over cap",
+			result:  ChangeResult{Diff: strings.Repeat("x", 1025)},
+			maxKB:   1,
+			wantErr: true,
+		},
+		{
+			name: "artifacts summed across fields",
+			result: ChangeResult{
+				Diff:       strings.Repeat("x", 512),
+				Logs:       strings.Repeat("x", 512),
+				TestOutput: strings.Repeat("x", 512),
+				DocChanges: strings.Repeat("x", 512),
+			},
+			maxKB:   1,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkOutputSize(tt.result, tt.maxKB)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+
+			if err == nil {
+				return
+			}
+
+			var ce *codedError
+			if !errors.As(err, &ce) || ce.Code != "output_size_exceeded" {
+				t.Errorf("Expected output_size_exceeded error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOutputSizeKB(t *testing.T) {
+	tests := []struct {
+		bytes int
+		want  int
+	}{
+		{0, 0},
+		{1, 1},
+		{1024, 1},
+		{1025, 2},
+	}
+
+	for _, tt := range tests {
+		got := outputSizeKB(ChangeResult{Logs: strings.Repeat("x", tt.bytes)})
+		if got != tt.want {
+			t.Errorf("outputSizeKB(%d bytes) = %d, want %d", tt.bytes, got, tt.want)
+		}
+	}
+}
+
+func TestCheckImpactScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		analysis *ImpactAnalysis
+		scope    *ImpactScopeConfig
+		wantCode string
+	}{
+		{
+			name:     "no scope",
+			analysis: &ImpactAnalysis{BreakingChanges: true},
+			scope:    nil,
+		},
+		{
+			name:     "missing analysis",
+			analysis: nil,
+			scope:    &ImpactScopeConfig{},
+			wantCode: "impact_analysis_missing",
+		},
+		{
+			name:     "breaking change rejected",
+			analysis: &ImpactAnalysis{BreakingChanges: true},
+			scope:    &ImpactScopeConfig{AllowBreakingChanges: false},
+			wantCode: "breaking_change_detected",
+		},
+		{
+			name:     "breaking change allowed",
+			analysis: &ImpactAnalysis{BreakingChanges: true},
+			scope:    &ImpactScopeConfig{AllowBreakingChanges: true},
+		},
+		{
+			name:     "services within limit",
+			analysis: &ImpactAnalysis{AffectedServices: []string{"billing", "orders"}},
+			scope:    &ImpactScopeConfig{MaxDownstreamServices: 2},
+		},
+		{
+			name:     "services over limit",
+			analysis: &ImpactAnalysis{AffectedServices: []string{"billing", "orders", "search"}},
+			scope:    &ImpactScopeConfig{MaxDownstreamServices: 2},
+			wantCode: "too_many_affected_services",
+		},
+		{
+			name:     "no service limit",
+			analysis: &ImpactAnalysis{AffectedServices: []string{"billing", "orders", "search"}},
+			scope:    &ImpactScopeConfig{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkImpactScope(ChangeResult{ImpactAnalysis: tt.analysis}, tt.scope)
+			assertErrorCode(t, err, tt.wantCode)
+		})
+	}
+}
+
+func TestCheckResultSetsOutputSize(t *testing.T) {
+	result := ChangeResult{Diff: strings.Repeat("x", 2048)}
+
+	if err := checkResult(ChangeSpec{}, &result); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.OutputSizeKB != 2 {
+		t.Errorf("Expected OutputSizeKB 2, got %d", result.OutputSizeKB)
+	}
+}
+
+func TestCheckTokenBudget(t *testing.T) {
+	tests := []struct {
+		name      string
+		used      int
+		maxTokens int
+		wantCode  string
+	}{
+		{name: "no budget", used: 500000, maxTokens: 0},
+		{name: "usage not reported", used: 0, maxTokens: 100},
+		{name: "under budget", used: 99, maxTokens: 100},
+		{name: "exactly at budget", used: 100, maxTokens: 100},
+		{name: "over budget", used: 101, maxTokens: 100, wantCode: "token_budget_exceeded"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertErrorCode(t, checkTokenBudget(ChangeResult{TokensUsed: tt.used}, tt.maxTokens), tt.wantCode)
+		})
+	}
+}
+
+func TestCheckResultRecordsTokenUsage(t *testing.T) {
+	diff := "--- a/main.go\n+++ b/main.go\n@@ -1,2 +1,3 @@\n package main\n-var x = 1\n+var x = 2\n+var y = 3\n"
+	result := ChangeResult{Diff: diff, TokensUsed: 300}
+
+	if err := checkResult(ChangeSpec{MaxTokens: 1000}, &result); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.TokensMax != 1000 {
+		t.Errorf("Expected TokensMax to default to spec.maxTokens, got %d", result.TokensMax)
+	}
+	if result.TokenEfficiency != 100 {
+		t.Errorf("Expected 100 tokens per changed line, got %v", result.TokenEfficiency)
+	}
+
+	if got := tokenEfficiency(ChangeResult{TokensUsed: 300}); got != 0 {
+		t.Errorf("Expected efficiency 0 for an empty diff, got %v", got)
+	}
+}
+
+// assertErrorCode fails the test unless err is a codedError with wantCode,
+// or nil when wantCode is empty
+func assertErrorCode(t *testing.T, err error, wantCode string) {
+	t.Helper()
+
+	if wantCode == "" {
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return
+	}
+
+	var ce *codedError
+	if !errors.As(err, &ce) {
+		t.Fatalf("Expected %s error, got %v", wantCode, err)
+	}
+	if ce.Code != wantCode {
+		t.Errorf("Expected error code '%s', got '%s'", wantCode, ce.Code)
+	}
+}
+
+func TestChangeResultTracksInstrumentedFunctions(t *testing.T) {
+	result := ChangeResult{InstrumentedFunctions: []string{"handleChange", "submitChange"}}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal result: %v", err)
+	}
+
+	var decoded ChangeResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal result: %v", err)
+	}
+
+	if len(decoded.InstrumentedFunctions) != 2 || decoded.InstrumentedFunctions[1] != "submitChange" {
+		t.Errorf("Expected instrumented functions to round-trip, got %v", decoded.InstrumentedFunctions)
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	a := ChangeResult{
+		Diff:                "diff a",
+		TokensUsed:          100,
+		ImpactAnalysis:      &ImpactAnalysis{AffectedServices: []string{"billing", "auth"}},
+		CommitSigningMethod: "ssh",
+	}
+	b := ChangeResult{
+		Diff:                  "diff b",
+		Logs:                  "logs b",
+		TokensUsed:            50,
+		ImpactAnalysis:        &ImpactAnalysis{BreakingChanges: true, AffectedServices: []string{"auth", "search"}},
+		InstrumentedFunctions: []string{"Handle"},
+		IssueLinked:           true,
+	}
+
+	want := ChangeResult{
+		Diff:                  "diff a\ndiff b",
+		Logs:                  "logs b",
+		TokensUsed:            150,
+		ImpactAnalysis:        &ImpactAnalysis{BreakingChanges: true, AffectedServices: []string{"billing", "auth", "search"}},
+		InstrumentedFunctions: []string{"Handle"},
+		IssueLinked:           true,
+		CommitSigningMethod:   "ssh",
+	}
+	if got := mergeResults(a, b); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+
+	if got := mergeResults(ChangeResult{}, ChangeResult{}); !reflect.DeepEqual(got, ChangeResult{}) {
+		t.Errorf("Expected empty results to merge to an empty result, got %+v", got)
+	}
+}
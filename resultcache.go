@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// cachedResult is a ChangeResult held in a ResultCache until expires
+type cachedResult struct {
+	result  ChangeResult
+	expires time.Time
+}
+
+// ResultCache holds the results of completed changes keyed by the content
+// hash of their spec, so an identical change submitted again within the TTL
+// can be answered without running an agent
+type ResultCache struct {
+	mu      sync.Mutex
+	entries map[string]cachedResult
+	now     func() time.Time
+}
+
+var resultCache = NewResultCache()
+
+// NewResultCache creates an empty ResultCache
+func NewResultCache() *ResultCache {
+	return &ResultCache{
+		entries: make(map[string]cachedResult),
+		now:     time.Now,
+	}
+}
+
+// Get returns the unexpired result cached for hash, if any
+func (c *ResultCache) Get(hash string) (ChangeResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[hash]
+	if !ok {
+		return ChangeResult{}, false
+	}
+	if !c.now().Before(entry.expires) {
+		delete(c.entries, hash)
+		return ChangeResult{}, false
+	}
+
+	return entry.result, true
+}
+
+// Set caches result against hash for ttl, dropping any expired entries so
+// the cache doesn't grow without bound. A non-positive ttl is ignored.
+func (c *ResultCache) Set(hash string, result ChangeResult, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[hash] = cachedResult{result: result, expires: now.Add(ttl)}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultCacheHitAndExpiry(t *testing.T) {
+	now := time.Now()
+	cache := NewResultCache()
+	cache.now = func() time.Time { return now }
+
+	cache.Set("abc", ChangeResult{Diff: "diff"}, time.Minute)
+
+	result, ok := cache.Get("abc")
+	if !ok || result.Diff != "diff" {
+		t.Fatalf("Expected cache hit with diff, got %v %+v", ok, result)
+	}
+	if _, ok := cache.Get("other"); ok {
+		t.Error("Expected miss for an unknown hash")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.Get("abc"); ok {
+		t.Error("Expected entry to expire after the TTL")
+	}
+}
+
+func TestResultCacheZeroTTLDisables(t *testing.T) {
+	cache := NewResultCache()
+	cache.Set("abc", ChangeResult{}, 0)
+
+	if _, ok := cache.Get("abc"); ok {
+		t.Error("Expected nothing to be cached with a zero TTL")
+	}
+}
+
+func TestContentHashStable(t *testing.T) {
+	spec := ChangeSpec{Prompt: "p", Repos: repoRefs("https://github.com/a/b"), Agent: "copilot-cli"}
+	if contentHash(spec) != contentHash(spec) {
+		t.Error("Expected identical specs to hash the same")
+	}
+
+	other := spec
+	other.Prompt = "q"
+	if contentHash(spec) == contentHash(other) {
+		t.Error("Expected different specs to hash differently")
+	}
+}
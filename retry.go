@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// retryMu serialises each retry's check for an existing retry of the parent
+// with the Save of the new job, so concurrent retries of one failed change
+// run it once
+var retryMu sync.Mutex
+
+// retryDepth returns how many retries lead from the original job of job's
+// lineage to job, following ParentJobID
+func retryDepth(job Job) (int, error) {
+	depth := 0
+	for job.ParentJobID != "" {
+		parent, err := store.Get(job.ParentJobID)
+		if errors.Is(err, ErrJobNotFound) {
+			// A deleted ancestor still counts as a retry
+			return depth + 1, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		depth++
+		job = parent
+	}
+	return depth, nil
+}
+
+// handleRetryChange handles requests to rerun a failed change. The change is
+// cloned into a new job referencing the failed one through parentJobId and
+// queued. Each failed job may be retried once, so a lineage is a chain of
+// retries, at most MAX_RETRIES long.
+func handleRetryChange(c *gin.Context) {
+	log := requestLogger(c)
+
+	id := c.Param("id")
+
+	parent, ok := lookupJob(c, id)
+	if !ok {
+		return
+	}
+	if parent.Status != statusFailed {
+		log.Warn("Change not retryable", "id", id, "status", parent.Status)
+		respondError(c, http.StatusUnprocessableEntity, ErrorResponse{
+			Error:   "change_not_retryable",
+			Message: fmt.Sprintf("change %q is %s; only failed changes can be retried", id, parent.Status),
+		})
+		return
+	}
+
+	retryMu.Lock()
+	retries, _, err := store.List(0, 1, JobFilter{ParentJobID: id})
+	if err != nil {
+		retryMu.Unlock()
+		respondJobError(c, id, err)
+		return
+	}
+	if len(retries) > 0 {
+		retryMu.Unlock()
+		log.Warn("Change already retried", "id", id, "retryId", retries[0].ID)
+		respondError(c, http.StatusConflict, ErrorResponse{
+			Error:         "change_already_retried",
+			Message:       fmt.Sprintf("change %q was already retried as %s", id, retries[0].ID),
+			ExistingJobID: retries[0].ID,
+		})
+		return
+	}
+
+	depth, err := retryDepth(parent)
+	if err != nil {
+		retryMu.Unlock()
+		respondJobError(c, id, err)
+		return
+	}
+	if depth >= config.MaxRetries {
+		retryMu.Unlock()
+		log.Warn("Retry limit reached", "id", id, "retries", depth)
+		respondError(c, http.StatusUnprocessableEntity, ErrorResponse{
+			Error:   "retry_limit_exceeded",
+			Message: fmt.Sprintf("change %q has already been retried %d times, maximum allowed is %d", id, depth, config.MaxRetries),
+		})
+		return
+	}
+
+	// The retry skips duplicate detection and the result cache: it repeats
+	// the parent's spec on purpose, and failures are never cached
+	job := newJob(parent.Change)
+	job.ParentJobID = parent.ID
+	job.HotfixReason = parent.HotfixReason
+	job.TraceContext = injectTraceContext(c.Request.Context())
+	err = store.Save(job)
+	retryMu.Unlock()
+	if err != nil {
+		var conflict *nameConflictError
+		if errors.As(err, &conflict) {
+			log.Warn("Change name conflict", "name", conflict.Name, "namespace", conflict.Namespace, "existingId", conflict.ExistingID)
+			respondError(c, http.StatusConflict, ErrorResponse{
+				Error:   "name_conflict",
+				Message: err.Error(),
+			})
+			return
+		}
+		log.Error("Failed to store change", "error", err)
+		respondError(c, http.StatusInternalServerError, ErrorResponse{
+			Error:   "internal_error",
+			Message: "failed to store change",
+		})
+		return
+	}
+	notifyAcceptance(job)
+	enqueue(job)
+
+	log.Info("Change retried", "id", job.ID, "parentId", parent.ID, "retry", depth+1)
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"status":      job.Status,
+		"message":     "Change retry queued",
+		"id":          job.ID,
+		"parentJobId": parent.ID,
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRetryChangeEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	cfg := config
+	cfg.MaxRetries = 2
+	setConfig(t, cfg)
+
+	router := gin.New()
+	router.POST("/change/:id/retry", handleRetryChange)
+
+	retry := func(id string) (int, map[string]interface{}) {
+		req := httptest.NewRequest("POST", "/change/"+id+"/retry", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Failed to unmarshal response: %v", err)
+		}
+		return w.Code, response
+	}
+	fail := func(id string) {
+		if err := store.Update(id, func(j *Job) { j.Status = statusFailed }); err != nil {
+			t.Fatalf("Failed to fail %s: %v", id, err)
+		}
+	}
+
+	if code, response := retry("missing"); code != http.StatusNotFound || response["error"] != "change_not_found" {
+		t.Errorf("Expected 404 change_not_found, got %d %v", code, response)
+	}
+
+	original := submitTestJob(t, ChangeSpec{Prompt: "Flaky change", Agent: "copilot-cli"})
+	if code, response := retry(original.ID); code != http.StatusUnprocessableEntity || response["error"] != "change_not_retryable" {
+		t.Errorf("Expected 422 change_not_retryable for a pending change, got %d %v", code, response)
+	}
+
+	fail(original.ID)
+	code, response := retry(original.ID)
+	if code != http.StatusAccepted || response["parentJobId"] != original.ID {
+		t.Fatalf("Expected 202 retrying %s, got %d %v", original.ID, code, response)
+	}
+	firstID, _ := response["id"].(string)
+	first, err := store.Get(firstID)
+	if err != nil {
+		t.Fatalf("Expected the retry to be stored: %v", err)
+	}
+	if first.ParentJobID != original.ID || first.Status != statusPending || first.Change.Spec.Prompt != "Flaky change" {
+		t.Errorf("Expected a pending clone of %s, got %+v", original.ID, first)
+	}
+	if got := queue.len(); got != 2 {
+		t.Errorf("Expected the retry to be queued, got queue length %d", got)
+	}
+
+	// A failed job is retried once; later retries go through its retry
+	if code, response := retry(original.ID); code != http.StatusConflict || response["existingJobId"] != firstID {
+		t.Errorf("Expected 409 change_already_retried pointing at %s, got %d %v", firstID, code, response)
+	}
+
+	fail(firstID)
+	code, response = retry(firstID)
+	if code != http.StatusAccepted {
+		t.Fatalf("Expected the second retry to be accepted, got %d %v", code, response)
+	}
+	secondID, _ := response["id"].(string)
+
+	fail(secondID)
+	if code, response := retry(secondID); code != http.StatusUnprocessableEntity || response["error"] != "retry_limit_exceeded" {
+		t.Errorf("Expected 422 retry_limit_exceeded after %d retries, got %d %v", cfg.MaxRetries, code, response)
+	}
+}
+
+func TestRetryChangeEndpointConcurrentRetries(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/change/:id/retry", handleRetryChange)
+
+	original := submitTestJob(t, ChangeSpec{Prompt: "Flaky change", Agent: "copilot-cli"})
+	if err := store.Update(original.ID, func(j *Job) { j.Status = statusFailed }); err != nil {
+		t.Fatalf("Failed to fail %s: %v", original.ID, err)
+	}
+	slowListing(t)
+
+	const retries = 10
+	codes := make(chan int, retries)
+	var wg sync.WaitGroup
+	for i := 0; i < retries; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("POST", "/change/"+original.ID+"/retry", nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	accepted := 0
+	for code := range codes {
+		if code == http.StatusAccepted {
+			accepted++
+		} else if code != http.StatusConflict {
+			t.Errorf("Expected status 202 or 409, got %d", code)
+		}
+	}
+	if accepted != 1 {
+		t.Errorf("Expected exactly 1 of %d concurrent retries to be accepted, got %d", retries, accepted)
+	}
+	if got := queue.len(); got != 2 {
+		t.Errorf("Expected one retry to be queued, got queue length %d", got)
+	}
+}
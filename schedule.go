@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxScheduleAhead is how far in the future spec.runAt may be
+const maxScheduleAhead = 30 * 24 * time.Hour
+
+// validateRunAt checks spec.runAt, returning nil when it is unset or within
+// maxScheduleAhead. Times in the past are accepted and run straight away.
+func validateRunAt(runAt *time.Time) *ErrorResponse {
+	if runAt == nil {
+		return nil
+	}
+
+	if runAt.After(time.Now().Add(maxScheduleAhead)) {
+		return &ErrorResponse{
+			Error:   "invalid_run_at",
+			Message: fmt.Sprintf("spec.runAt must be at most %d days in the future", int(maxScheduleAhead/(24*time.Hour))),
+		}
+	}
+
+	return nil
+}
+
+// isScheduled reports whether a change with spec.runAt set to runAt must wait
+// before it is queued
+func isScheduled(runAt *time.Time) bool {
+	return runAt != nil && runAt.After(time.Now())
+}
+
+// runScheduler queues scheduled jobs as they fall due, checking every
+// interval until ctx is done
+func runScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if _, err := queueDueJobs(now); err != nil {
+				logger.Error("Failed to queue scheduled changes", "error", err)
+			}
+		}
+	}
+}
+
+// queueDueJobs moves every scheduled job whose spec.runAt is no later than
+// now back to pending and queues it, returning how many were queued
+func queueDueJobs(now time.Time) (int, error) {
+	const pageSize = 100
+
+	// Collect the due jobs before updating any, since an update removes the
+	// job from the filtered listing and would shift later pages
+	var due []string
+	filter := JobFilter{Status: statusScheduled}
+	for offset := 0; ; offset += pageSize {
+		page, total, err := store.List(offset, pageSize, filter)
+		if err != nil {
+			return 0, err
+		}
+		for _, job := range page {
+			if runAt := job.Change.Spec.RunAt; runAt == nil || !runAt.After(now) {
+				due = append(due, job.ID)
+			}
+		}
+		if offset+pageSize >= total {
+			break
+		}
+	}
+
+	n := 0
+	for _, id := range due {
+		var job Job
+		queued := false
+		err := store.Update(id, func(j *Job) {
+			if j.Status == statusScheduled {
+				j.Status = statusPending
+				job = *j
+				queued = true
+			}
+		})
+		if err != nil {
+			// The job may have been deleted since it was listed
+			logger.Warn("Failed to queue scheduled change", "id", id, "error", err)
+			continue
+		}
+		if queued {
+			enqueue(job)
+			logger.Info("Scheduled change queued", "id", id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestScheduledChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+	router.GET("/changes", handleListChanges)
+
+	runAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	change := validTestChange()
+	change.Spec.RunAt = &runAt
+	w := postJSON(router, "/change", change)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if created.Status != statusScheduled {
+		t.Errorf("Expected status %s, got %s", statusScheduled, created.Status)
+	}
+	if queue.len() != 0 {
+		t.Errorf("Expected a scheduled change not to be queued")
+	}
+
+	// Changes due now are queued as usual
+	immediate := validTestChange()
+	immediate.Spec.Prompt = "Run now"
+	past := time.Now().Add(-time.Minute)
+	immediate.Spec.RunAt = &past
+	if w := postJSON(router, "/change", immediate); w.Code != http.StatusAccepted || queue.len() != 1 {
+		t.Fatalf("Expected a change due now to be queued, got %d with queue length %d", w.Code, queue.len())
+	}
+
+	req := httptest.NewRequest("GET", "/changes?status=scheduled", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var list struct {
+		Total int          `json:"total"`
+		Items []JobSummary `json:"items"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if list.Total != 1 || len(list.Items) != 1 || list.Items[0].ID != created.ID {
+		t.Fatalf("Expected only the scheduled change to be listed, got %s", w.Body.String())
+	}
+	if list.Items[0].RunAt == nil || !list.Items[0].RunAt.Equal(runAt) {
+		t.Errorf("Expected runAt %v, got %v", runAt, list.Items[0].RunAt)
+	}
+
+	if n, err := queueDueJobs(time.Now()); err != nil || n != 0 {
+		t.Fatalf("Expected no change to be due yet, got %d (%v)", n, err)
+	}
+	if n, err := queueDueJobs(runAt); err != nil || n != 1 {
+		t.Fatalf("Expected the scheduled change to be queued once due, got %d (%v)", n, err)
+	}
+	if job, _ := store.Get(created.ID); job.Status != statusPending {
+		t.Errorf("Expected status %s once due, got %s", statusPending, job.Status)
+	}
+	if queue.len() != 2 {
+		t.Errorf("Expected the due change to be queued, got queue length %d", queue.len())
+	}
+}
+
+func TestCancelScheduledChange(t *testing.T) {
+	isolateJobs(t)
+
+	runAt := time.Now().Add(time.Hour)
+	job := newJob(Change{Spec: ChangeSpec{RunAt: &runAt}})
+	job.Status = statusScheduled
+	if err := store.Save(job); err != nil {
+		t.Fatalf("Failed to save job: %v", err)
+	}
+
+	cancelled, ok, err := cancelJob(job.ID, "")
+	if err != nil || !ok || cancelled.FinishedAt == nil {
+		t.Fatalf("Expected a scheduled change to finish once cancelled, got %+v (%v)", cancelled, err)
+	}
+	if n, _ := queueDueJobs(runAt); n != 0 {
+		t.Errorf("Expected a cancelled change not to be queued, got %d", n)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// changeSchemaURL identifies the Change schema to the schema compiler
+const changeSchemaURL = "change.schema.json"
+
+// changeSchemaDocument is the JSON Schema describing Change request bodies
+//
+//go:embed api/change.schema.json
+var changeSchemaDocument []byte
+
+// changeSchemas caches the compiled Change schema
+var changeSchemas struct {
+	once   sync.Once
+	schema *jsonschema.Schema
+	err    error
+}
+
+// changeSchema returns the compiled Change schema, compiling it on first use
+func changeSchema() (*jsonschema.Schema, error) {
+	changeSchemas.once.Do(func() {
+		compiler := jsonschema.NewCompiler()
+		if err := compiler.AddResource(changeSchemaURL, bytes.NewReader(changeSchemaDocument)); err != nil {
+			changeSchemas.err = fmt.Errorf("load change schema: %w", err)
+			return
+		}
+		changeSchemas.schema, changeSchemas.err = compiler.Compile(changeSchemaURL)
+		if changeSchemas.err != nil {
+			changeSchemas.err = fmt.Errorf("compile change schema: %w", changeSchemas.err)
+		}
+	})
+	return changeSchemas.schema, changeSchemas.err
+}
+
+// validateChangeSchema checks a JSON Change body against the Change schema,
+// returning a schema_violation listing every failed constraint, or nil when
+// it conforms. Bodies that aren't valid JSON are left for binding to report.
+// The schema only checks field types, leaving the fields' values to
+// validateChange.
+func validateChangeSchema(data []byte) (*ErrorResponse, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return nil, nil
+	}
+
+	schema, err := changeSchema()
+	if err != nil {
+		return nil, err
+	}
+	err = schema.Validate(body)
+	if err == nil {
+		return nil, nil
+	}
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return nil, err
+	}
+
+	var errs []FieldError
+	collectSchemaErrors(validationErr, &errs)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+
+	return &ErrorResponse{
+		Error:   "schema_violation",
+		Message: errs[0].Message,
+		Errors:  errs,
+	}, nil
+}
+
+// collectSchemaErrors appends the innermost causes of err, which name the
+// individual constraints that failed
+func collectSchemaErrors(err *jsonschema.ValidationError, errs *[]FieldError) {
+	if len(err.Causes) == 0 {
+		field := schemaFieldPath(err.InstanceLocation)
+		*errs = append(*errs, FieldError{
+			Field:   field,
+			Code:    "schema_violation",
+			Message: fmt.Sprintf("%s: %s", field, err.Message),
+		})
+		return
+	}
+	for _, cause := range err.Causes {
+		collectSchemaErrors(cause, errs)
+	}
+}
+
+// schemaFieldPath converts a JSON pointer such as "/spec/repos/1" into the
+// field path FieldError uses, "spec.repos[1]". The body itself is "body".
+func schemaFieldPath(pointer string) string {
+	if pointer == "" {
+		return "body"
+	}
+
+	var path strings.Builder
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		if _, err := strconv.Atoi(token); err == nil {
+			fmt.Fprintf(&path, "[%s]", token)
+			continue
+		}
+		if path.Len() > 0 {
+			path.WriteByte('.')
+		}
+		path.WriteString(token)
+	}
+	return path.String()
+}
+
+// checkChangeSchema validates a JSON Change body with validateChangeSchema,
+// responding with a 400 and returning false when it doesn't conform
+func checkChangeSchema(c *gin.Context, data []byte) bool {
+	errResp, err := validateChangeSchema(data)
+	if err != nil {
+		requestLogger(c).Error("Failed to validate against the change schema", "error", err)
+		respondError(c, http.StatusInternalServerError, ErrorResponse{
+			Error:   "internal_error",
+			Message: "failed to load the change schema",
+		})
+		return false
+	}
+	if errResp != nil {
+		requestLogger(c).Warn("Change violates the schema", "errors", len(errResp.Errors))
+		respondError(c, http.StatusBadRequest, *errResp)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateChangeSchema(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantFields []string
+	}{
+		{"valid", `{"kind": "Change", "apiVersion": "v1", "spec": {"prompt": "Add retries", "repos": ["https://github.com/myorg/repo1", {"url": "git@github.com:myorg/repo2", "branch": "develop"}], "agent": "copilot-cli"}}`, nil},
+		{"spec not an object", `{"kind": "Change", "apiVersion": "v1", "spec": []}`, []string{"spec"}},
+		{"priority not an integer", `{"spec": {"prompt": "Add retries", "repos": ["https://github.com/myorg/repo1"], "agent": "copilot-cli", "priority": 2.5}}`, []string{"spec.priority"}},
+		{"label value not a string", `{"spec": {"prompt": "Add retries", "repos": ["https://github.com/myorg/repo1"], "agent": "copilot-cli", "labels": {"team": 7}}}`, []string{"spec.labels.team"}},
+		{"several violations", `{"spec": {"prompt": "Add retries", "repos": ["https://github.com/myorg/repo1"], "agent": "copilot-cli", "priority": "high", "dryRun": "yes"}}`, []string{"spec.dryRun", "spec.priority"}},
+		{"prompt not a string", `{"spec": {"prompt": 5, "repos": ["https://github.com/myorg/repo1"], "agent": "copilot-cli"}}`, []string{"spec.prompt"}},
+		// The schema leaves the values of these fields to validateChange, so
+		// they get the same codes as on the other endpoints
+		{"missing spec", `{"kind": "Change", "apiVersion": "v1"}`, nil},
+		{"missing prompt", `{"spec": {"repos": ["https://github.com/myorg/repo1"], "agent": "copilot-cli"}}`, nil},
+		{"empty prompt", `{"spec": {"prompt": "", "repos": ["https://github.com/myorg/repo1"], "agent": "copilot-cli"}}`, nil},
+		{"repo not a URL", `{"spec": {"prompt": "Add retries", "repos": ["https://github.com/myorg/repo1", "not a url"], "agent": "copilot-cli"}}`, nil},
+		{"repo object URL not a URL", `{"spec": {"prompt": "Add retries", "repos": [{"url": "ftp://example.com/repo"}], "agent": "copilot-cli"}}`, nil},
+		{"unknown agent", `{"spec": {"prompt": "Add retries", "repos": ["https://github.com/myorg/repo1"], "agent": "aider"}}`, nil},
+		{"only covered violations", `{"spec": {"prompt": "", "repos": [], "agent": "aider"}}`, nil},
+		{"covered and uncovered violations", `{"spec": {"prompt": "", "repos": [], "agent": "aider", "priority": 2.5}}`, []string{"spec.priority"}},
+		// Malformed JSON is reported by binding instead
+		{"not JSON", `{"spec": `, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errResp, err := validateChangeSchema([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("Failed to validate: %v", err)
+			}
+			if tt.wantFields == nil {
+				if errResp != nil {
+					t.Fatalf("Expected body to match the schema, got %+v", errResp.Errors)
+				}
+				return
+			}
+			if errResp == nil {
+				t.Fatal("Expected a schema violation")
+			}
+
+			var fields []string
+			for _, fieldErr := range errResp.Errors {
+				if fieldErr.Code != "schema_violation" || fieldErr.Message == "" {
+					t.Errorf("Expected a schema_violation with a message, got %+v", fieldErr)
+				}
+				fields = append(fields, fieldErr.Field)
+			}
+			if !reflect.DeepEqual(fields, tt.wantFields) {
+				t.Errorf("Expected errors on %v, got %+v", tt.wantFields, errResp.Errors)
+			}
+			if errResp.Error != "schema_violation" || errResp.Message != errResp.Errors[0].Message {
+				t.Errorf("Expected the top-level error to describe the first violation, got %s: %s", errResp.Error, errResp.Message)
+			}
+		})
+	}
+}
+
+func TestSchemaFieldPath(t *testing.T) {
+	tests := map[string]string{
+		"":                  "body",
+		"/spec":             "spec",
+		"/spec/repos/1":     "spec.repos[1]",
+		"/spec/repos/0/url": "spec.repos[0].url",
+		"/spec/labels/a~1b": "spec.labels.a/b",
+		"/spec/labels/x~0y": "spec.labels.x~y",
+	}
+	for pointer, want := range tests {
+		if got := schemaFieldPath(pointer); got != want {
+			t.Errorf("schemaFieldPath(%q): expected %q, got %q", pointer, want, got)
+		}
+	}
+}
+
+func TestChangeEndpointSchemaViolation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	w := postJSON(router, "/change", map[string]interface{}{
+		"kind":       "Change",
+		"apiVersion": "v1",
+		"spec": map[string]interface{}{
+			"prompt":   "Add retries",
+			"repos":    []string{"https://github.com/myorg/repo1"},
+			"agent":    "copilot-cli",
+			"priority": "high",
+		},
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Error != "schema_violation" || len(response.Errors) != 1 || response.Errors[0].Field != "spec.priority" {
+		t.Errorf("Expected a schema_violation on spec.priority, got %+v", response)
+	}
+	if _, total, _ := store.List(0, 1, JobFilter{}); total != 0 {
+		t.Errorf("Expected nothing to be stored, got %d changes", total)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+)
+
+// Commit signing methods accepted in spec.signCommits.method
+const (
+	signingMethodGPG    = "gpg"
+	signingMethodSSH    = "ssh"
+	signingMethodPKCS11 = "pkcs11"
+)
+
+// CommitSigningConfig asks the agent to sign the commits it creates
+type CommitSigningConfig struct {
+	Method string `json:"method"`
+	// KeyID selects the signing key. For pkcs11 it is the hex-encoded ID of
+	// the key object on the hardware token.
+	KeyID string `json:"keyID,omitempty"`
+}
+
+// validateCommitSigning checks cfg, returning nil when it is valid or unset
+func validateCommitSigning(cfg *CommitSigningConfig) *ErrorResponse {
+	if cfg == nil {
+		return nil
+	}
+
+	switch cfg.Method {
+	case signingMethodGPG, signingMethodSSH:
+		return nil
+	case signingMethodPKCS11:
+	default:
+		return &ErrorResponse{
+			Error:   "invalid_signing_method",
+			Message: fmt.Sprintf("spec.signCommits.method %q is not supported, must be 'gpg', 'ssh' or 'pkcs11'", cfg.Method),
+		}
+	}
+
+	if config.PKCS11ModulePath == "" {
+		return &ErrorResponse{
+			Error:   "pkcs11_not_configured",
+			Message: "spec.signCommits.method 'pkcs11' requires the server to be configured with PKCS11_MODULE_PATH",
+		}
+	}
+
+	if _, err := hex.DecodeString(cfg.KeyID); cfg.KeyID == "" || err != nil {
+		return &ErrorResponse{
+			Error:   "invalid_signing_key",
+			Message: fmt.Sprintf("spec.signCommits.keyID %q must be a non-empty hex string for pkcs11", cfg.KeyID),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestValidateCommitSigning(t *testing.T) {
+	tests := []struct {
+		name       string
+		cfg        *CommitSigningConfig
+		modulePath string
+		wantError  string
+	}{
+		{name: "unset", cfg: nil},
+		{name: "gpg", cfg: &CommitSigningConfig{Method: "gpg"}},
+		{name: "ssh with key", cfg: &CommitSigningConfig{Method: "ssh", KeyID: "~/.ssh/id_ed25519.pub"}},
+		{name: "unknown method", cfg: &CommitSigningConfig{Method: "x509"}, wantError: "invalid_signing_method"},
+		{name: "empty method", cfg: &CommitSigningConfig{}, wantError: "invalid_signing_method"},
+		{name: "pkcs11 without module", cfg: &CommitSigningConfig{Method: "pkcs11", KeyID: "01a2"}, wantError: "pkcs11_not_configured"},
+		{name: "pkcs11", cfg: &CommitSigningConfig{Method: "pkcs11", KeyID: "01a2"}, modulePath: "/usr/lib/libykcs11.so"},
+		{name: "pkcs11 missing key", cfg: &CommitSigningConfig{Method: "pkcs11"}, modulePath: "/usr/lib/libykcs11.so", wantError: "invalid_signing_key"},
+		{name: "pkcs11 non-hex key", cfg: &CommitSigningConfig{Method: "pkcs11", KeyID: "slot-1"}, modulePath: "/usr/lib/libykcs11.so", wantError: "invalid_signing_key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PKCS11_MODULE_PATH", tt.modulePath)
+			setConfig(t, loadConfig())
+
+			errResp := validateCommitSigning(tt.cfg)
+			if tt.wantError == "" {
+				if errResp != nil {
+					t.Fatalf("Expected no error, got %+v", errResp)
+				}
+				return
+			}
+			if errResp == nil || errResp.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got %+v", tt.wantError, errResp)
+			}
+		})
+	}
+}
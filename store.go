@@ -0,0 +1,392 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store errors
+var (
+	ErrJobNotFound = errors.New("job not found")
+	ErrJobExists   = errors.New("job already exists")
+	// ErrIdempotencyRecordNotFound is returned for unknown or expired
+	// idempotency keys
+	ErrIdempotencyRecordNotFound = errors.New("idempotency record not found")
+	ErrTemplateNotFound          = errors.New("template not found")
+)
+
+// JobUpdate modifies a job in place. Stores apply it atomically with respect
+// to other updates of the same job.
+type JobUpdate func(job *Job)
+
+// TemplateUpdate modifies a template in place. Stores apply it atomically
+// with respect to other updates of the same template.
+type TemplateUpdate func(tmpl *ChangeTemplate)
+
+// TemplateStore persists change templates
+type TemplateStore interface {
+	// SaveTemplate stores a new template
+	SaveTemplate(tmpl ChangeTemplate) error
+	// GetTemplate returns the template with the given ID, or
+	// ErrTemplateNotFound
+	GetTemplate(id string) (ChangeTemplate, error)
+	// ListTemplates returns every template, ordered by creation time
+	ListTemplates() ([]ChangeTemplate, error)
+	// UpdateTemplate applies update to the template with the given ID, or
+	// returns ErrTemplateNotFound
+	UpdateTemplate(id string, update TemplateUpdate) error
+	// DeleteTemplate removes the template with the given ID, or returns
+	// ErrTemplateNotFound
+	DeleteTemplate(id string) error
+}
+
+// Store persists jobs and change templates
+type Store interface {
+	TemplateStore
+
+	// Save stores a new job, enforcing that its metadata name is unique
+	// within its namespace
+	Save(job Job) error
+	// Get returns the job with the given ID, or ErrJobNotFound
+	Get(id string) (Job, error)
+	// List returns up to limit jobs matching filter starting at offset,
+	// ordered by creation time, along with the total number of matching jobs
+	List(offset, limit int, filter JobFilter) ([]Job, int, error)
+	// Update applies update to the job with the given ID, or returns
+	// ErrJobNotFound
+	Update(id string, update JobUpdate) error
+	// Delete removes the job with the given ID, or returns ErrJobNotFound
+	Delete(id string) error
+	// SaveIdempotencyRecord stores record, replacing any earlier record for
+	// its key, and drops records that have expired
+	SaveIdempotencyRecord(record IdempotencyRecord) error
+	// GetIdempotencyRecord returns the unexpired record for key, or
+	// ErrIdempotencyRecordNotFound
+	GetIdempotencyRecord(key string) (IdempotencyRecord, error)
+}
+
+var store Store = NewInMemoryStore()
+
+// JobFilter narrows the jobs returned by Store.List. Empty fields match every
+// job.
+type JobFilter struct {
+	// Category matches the job's spec.changeCategory
+	Category string
+	// Status matches the job's status
+	Status string
+	// Labels must all be present, with the same values, in the job's
+	// spec.labels
+	Labels map[string]string
+	// ContentHash matches the job's contentHash
+	ContentHash string
+	// CreatedAfter excludes jobs created at or before it
+	CreatedAfter time.Time
+	// ParentJobID matches the job's parentJobId
+	ParentJobID string
+}
+
+// matches reports whether job satisfies f
+func (f JobFilter) matches(job Job) bool {
+	if f.Status != "" && job.Status != f.Status {
+		return false
+	}
+	if !hasLabels(job.Change.Spec.Labels, f.Labels) {
+		return false
+	}
+	if f.ContentHash != "" && job.ContentHash != f.ContentHash {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && !job.CreatedAt.After(f.CreatedAfter) {
+		return false
+	}
+	if f.ParentJobID != "" && job.ParentJobID != f.ParentJobID {
+		return false
+	}
+	if f.Category == "" {
+		return true
+	}
+	category := job.Change.Spec.Category
+	if category == "" {
+		category = defaultCategory
+	}
+	return category == f.Category
+}
+
+// nameConflictError is returned when saving a job whose metadata name is
+// already held by another job in the same namespace
+type nameConflictError struct {
+	Name       string
+	Namespace  string
+	ExistingID string
+}
+
+func (e *nameConflictError) Error() string {
+	return fmt.Sprintf("a change named %q already exists in namespace %q (id %s)", e.Name, e.Namespace, e.ExistingID)
+}
+
+// nameHeldBy reports whether existing holds the metadata name of job,
+// preventing job from being saved
+func nameHeldBy(job, existing Job, reuseTerminal bool) bool {
+	meta, other := job.Change.Metadata, existing.Change.Metadata
+	if meta == nil || meta.Name == "" || other == nil {
+		return false
+	}
+	if other.Name != meta.Name || other.Namespace != meta.Namespace {
+		return false
+	}
+	return !reuseTerminal || !isTerminal(existing.Status)
+}
+
+// InMemoryStore is a thread-safe Store that keeps jobs in memory
+type InMemoryStore struct {
+	// ReuseTerminalNames allows a name held by a terminal job to be reused
+	ReuseTerminalNames bool
+
+	mu          sync.RWMutex
+	jobs        map[string]Job
+	idempotency map[string]IdempotencyRecord
+	templates   map[string]ChangeTemplate
+}
+
+// NewInMemoryStore creates an empty InMemoryStore
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{
+		ReuseTerminalNames: true,
+		jobs:               make(map[string]Job),
+		idempotency:        make(map[string]IdempotencyRecord),
+		templates:          make(map[string]ChangeTemplate),
+	}
+}
+
+// Save implements Store
+func (s *InMemoryStore) Save(job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.ID]; ok {
+		return ErrJobExists
+	}
+
+	for _, existing := range s.jobs {
+		if nameHeldBy(job, existing, s.ReuseTerminalNames) {
+			return &nameConflictError{
+				Name:       job.Change.Metadata.Name,
+				Namespace:  job.Change.Metadata.Namespace,
+				ExistingID: existing.ID,
+			}
+		}
+	}
+
+	s.jobs[job.ID] = job
+	return nil
+}
+
+// Get implements Store
+func (s *InMemoryStore) Get(id string) (Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+// List implements Store
+func (s *InMemoryStore) List(offset, limit int, filter JobFilter) ([]Job, int, error) {
+	s.mu.RLock()
+	all := make([]Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		if filter.matches(job) {
+			all = append(all, job)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].CreatedAt.Equal(all[j].CreatedAt) {
+			return all[i].CreatedAt.Before(all[j].CreatedAt)
+		}
+		return all[i].ID < all[j].ID
+	})
+
+	total := len(all)
+	if offset >= total {
+		return []Job{}, total, nil
+	}
+
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+
+	return all[offset:end], total, nil
+}
+
+// Update implements Store
+func (s *InMemoryStore) Update(id string, update JobUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	update(&job)
+	s.jobs[id] = job
+	return nil
+}
+
+// Delete implements Store
+func (s *InMemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return ErrJobNotFound
+	}
+	delete(s.jobs, id)
+	return nil
+}
+
+// SaveIdempotencyRecord implements Store
+func (s *InMemoryStore) SaveIdempotencyRecord(record IdempotencyRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, existing := range s.idempotency {
+		if !now.Before(existing.ExpiresAt) {
+			delete(s.idempotency, key)
+		}
+	}
+
+	s.idempotency[record.Key] = record
+	return nil
+}
+
+// GetIdempotencyRecord implements Store
+func (s *InMemoryStore) GetIdempotencyRecord(key string) (IdempotencyRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.idempotency[key]
+	if !ok || !time.Now().Before(record.ExpiresAt) {
+		return IdempotencyRecord{}, ErrIdempotencyRecordNotFound
+	}
+	return record, nil
+}
+
+// SaveTemplate implements TemplateStore
+func (s *InMemoryStore) SaveTemplate(tmpl ChangeTemplate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.templates[tmpl.ID] = tmpl
+	return nil
+}
+
+// GetTemplate implements TemplateStore
+func (s *InMemoryStore) GetTemplate(id string) (ChangeTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tmpl, ok := s.templates[id]
+	if !ok {
+		return ChangeTemplate{}, ErrTemplateNotFound
+	}
+	return tmpl, nil
+}
+
+// ListTemplates implements TemplateStore
+func (s *InMemoryStore) ListTemplates() ([]ChangeTemplate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	templates := make([]ChangeTemplate, 0, len(s.templates))
+	for _, tmpl := range s.templates {
+		templates = append(templates, tmpl)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if !templates[i].CreatedAt.Equal(templates[j].CreatedAt) {
+			return templates[i].CreatedAt.Before(templates[j].CreatedAt)
+		}
+		return templates[i].ID < templates[j].ID
+	})
+	return templates, nil
+}
+
+// UpdateTemplate implements TemplateStore
+func (s *InMemoryStore) UpdateTemplate(id string, update TemplateUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmpl, ok := s.templates[id]
+	if !ok {
+		return ErrTemplateNotFound
+	}
+	update(&tmpl)
+	s.templates[id] = tmpl
+	return nil
+}
+
+// DeleteTemplate implements TemplateStore
+func (s *InMemoryStore) DeleteTemplate(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.templates[id]; !ok {
+		return ErrTemplateNotFound
+	}
+	delete(s.templates, id)
+	return nil
+}
+
+// openStore creates the Store described by cfg: a SQLiteStore when
+// DatabaseURL or DBPath is set, otherwise an InMemoryStore
+func openStore(cfg Config) (Store, error) {
+	path := cfg.DBPath
+	if cfg.DatabaseURL != "" {
+		var err error
+		if path, err = sqlitePath(cfg.DatabaseURL); err != nil {
+			return nil, err
+		}
+	}
+
+	if path == "" {
+		s := NewInMemoryStore()
+		s.ReuseTerminalNames = cfg.ReuseTerminalNames
+		return s, nil
+	}
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		return nil, err
+	}
+	s.ReuseTerminalNames = cfg.ReuseTerminalNames
+	return s, nil
+}
+
+// sqlitePath returns the SQLite database a DATABASE_URL refers to. It accepts
+// sqlite://path and sqlite:path URLs, file: URIs, which SQLite opens itself,
+// and plain file paths.
+func sqlitePath(databaseURL string) (string, error) {
+	switch {
+	case strings.HasPrefix(databaseURL, "sqlite://"):
+		return strings.TrimPrefix(databaseURL, "sqlite://"), nil
+	case strings.HasPrefix(databaseURL, "sqlite:"):
+		return strings.TrimPrefix(databaseURL, "sqlite:"), nil
+	case strings.HasPrefix(databaseURL, "file:"):
+		return databaseURL, nil
+	}
+	if scheme, _, ok := strings.Cut(databaseURL, "://"); ok {
+		return "", fmt.Errorf("DATABASE_URL scheme %q is not supported, only SQLite databases are", scheme)
+	}
+	return databaseURL, nil
+}
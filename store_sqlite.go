@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// SQLiteStore is a Store that persists jobs in a SQLite database
+type SQLiteStore struct {
+	// ReuseTerminalNames allows a name held by a terminal job to be reused
+	ReuseTerminalNames bool
+
+	db *sql.DB
+}
+
+// NewSQLiteStore opens the SQLite database at path, creating it if needed,
+// and applies any pending schema migrations
+func NewSQLiteStore(path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer; serializing access through one
+	// connection avoids SQLITE_BUSY errors under concurrent requests
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return &SQLiteStore{ReuseTerminalNames: true, db: db}, nil
+}
+
+// migrate applies the embedded migrations that haven't been applied yet, in
+// filename order
+func migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version TEXT PRIMARY KEY)`); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var applied int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`, name).Scan(&applied); err != nil {
+			return err
+		}
+		if applied > 0 {
+			continue
+		}
+
+		script, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(string(script)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES (?)`, name); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		logger.Info("Applied database migration", "migration", name)
+	}
+
+	return nil
+}
+
+// Close closes the underlying database
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
+
+// Ping checks that the database is reachable
+func (s *SQLiteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Save implements Store
+func (s *SQLiteStore) Save(job Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if meta := job.Change.Metadata; meta != nil && meta.Name != "" {
+		rows, err := tx.Query(`SELECT data FROM jobs WHERE namespace = ? AND name = ?`, meta.Namespace, meta.Name)
+		if err != nil {
+			return err
+		}
+		existing, err := scanJobs(rows)
+		if err != nil {
+			return err
+		}
+		for _, other := range existing {
+			if nameHeldBy(job, other, s.ReuseTerminalNames) {
+				return &nameConflictError{Name: meta.Name, Namespace: meta.Namespace, ExistingID: other.ID}
+			}
+		}
+	}
+
+	name, namespace := "", ""
+	if meta := job.Change.Metadata; meta != nil {
+		name, namespace = meta.Name, meta.Namespace
+	}
+
+	var exists int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM jobs WHERE id = ?`, job.ID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists > 0 {
+		return ErrJobExists
+	}
+
+	category := job.Change.Spec.Category
+	if category == "" {
+		category = defaultCategory
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO jobs (id, status, name, namespace, category, content_hash, created_at, data) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Status, name, namespace, category, job.ContentHash, job.CreatedAt.UnixNano(), string(data),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get implements Store
+func (s *SQLiteStore) Get(id string) (Job, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM jobs WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Job{}, ErrJobNotFound
+	}
+	if err != nil {
+		return Job{}, err
+	}
+
+	var job Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return Job{}, err
+	}
+	return job, nil
+}
+
+// List implements Store
+func (s *SQLiteStore) List(offset, limit int, filter JobFilter) ([]Job, int, error) {
+	var conditions []string
+	var args []interface{}
+	if filter.Category != "" {
+		conditions = append(conditions, `category = ?`)
+		args = append(args, filter.Category)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, `status = ?`)
+		args = append(args, filter.Status)
+	}
+	if filter.ContentHash != "" {
+		conditions = append(conditions, `content_hash = ?`)
+		args = append(args, filter.ContentHash)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conditions = append(conditions, `created_at > ?`)
+		args = append(args, filter.CreatedAfter.UnixNano())
+	}
+	if filter.ParentJobID != "" {
+		conditions = append(conditions, `json_extract(data, '$.parentJobId') = ?`)
+		args = append(args, filter.ParentJobID)
+	}
+	// Label keys are validated by parseLabelSelectors and can't contain
+	// quotes, so they are safe to quote in a JSON path
+	for key, value := range filter.Labels {
+		conditions = append(conditions, `json_extract(data, ?) = ?`)
+		args = append(args, `$.change.spec.labels."`+key+`"`, value)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = ` WHERE ` + strings.Join(conditions, ` AND `)
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM jobs`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	args = append(args, limit, offset)
+	rows, err := s.db.Query(`SELECT data FROM jobs`+where+` ORDER BY created_at, id LIMIT ? OFFSET ?`, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	page, err := scanJobs(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return page, total, nil
+}
+
+// Update implements Store
+func (s *SQLiteStore) Update(id string, update JobUpdate) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var data string
+	err = tx.QueryRow(`SELECT data FROM jobs WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrJobNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var job Job
+	if err := json.Unmarshal([]byte(data), &job); err != nil {
+		return err
+	}
+
+	update(&job)
+
+	updated, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE jobs SET status = ?, data = ? WHERE id = ?`, job.Status, string(updated), id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete implements Store
+func (s *SQLiteStore) Delete(id string) error {
+	res, err := s.db.Exec(`DELETE FROM jobs WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrJobNotFound
+	}
+	return nil
+}
+
+// SaveIdempotencyRecord implements Store
+func (s *SQLiteStore) SaveIdempotencyRecord(record IdempotencyRecord) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= ?`, time.Now().UnixNano()); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`INSERT OR REPLACE INTO idempotency_keys (key, request_hash, status, body, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		record.Key, record.RequestHash, record.Status, record.Body, record.CreatedAt.UnixNano(), record.ExpiresAt.UnixNano(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetIdempotencyRecord implements Store
+func (s *SQLiteStore) GetIdempotencyRecord(key string) (IdempotencyRecord, error) {
+	record := IdempotencyRecord{Key: key}
+	var createdAt, expiresAt int64
+	err := s.db.QueryRow(
+		`SELECT request_hash, status, body, created_at, expires_at FROM idempotency_keys WHERE key = ? AND expires_at > ?`,
+		key, time.Now().UnixNano(),
+	).Scan(&record.RequestHash, &record.Status, &record.Body, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return IdempotencyRecord{}, ErrIdempotencyRecordNotFound
+	}
+	if err != nil {
+		return IdempotencyRecord{}, err
+	}
+
+	record.CreatedAt = time.Unix(0, createdAt).UTC()
+	record.ExpiresAt = time.Unix(0, expiresAt).UTC()
+	return record, nil
+}
+
+// SaveTemplate implements TemplateStore
+func (s *SQLiteStore) SaveTemplate(tmpl ChangeTemplate) error {
+	data, err := json.Marshal(tmpl)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO templates (id, created_at, data) VALUES (?, ?, ?)`,
+		tmpl.ID, tmpl.CreatedAt.UnixNano(), string(data),
+	)
+	return err
+}
+
+// GetTemplate implements TemplateStore
+func (s *SQLiteStore) GetTemplate(id string) (ChangeTemplate, error) {
+	var data string
+	err := s.db.QueryRow(`SELECT data FROM templates WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ChangeTemplate{}, ErrTemplateNotFound
+	}
+	if err != nil {
+		return ChangeTemplate{}, err
+	}
+
+	var tmpl ChangeTemplate
+	if err := json.Unmarshal([]byte(data), &tmpl); err != nil {
+		return ChangeTemplate{}, err
+	}
+	return tmpl, nil
+}
+
+// ListTemplates implements TemplateStore
+func (s *SQLiteStore) ListTemplates() ([]ChangeTemplate, error) {
+	rows, err := s.db.Query(`SELECT data FROM templates ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []ChangeTemplate{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var tmpl ChangeTemplate
+		if err := json.Unmarshal([]byte(data), &tmpl); err != nil {
+			return nil, err
+		}
+		templates = append(templates, tmpl)
+	}
+
+	return templates, rows.Err()
+}
+
+// UpdateTemplate implements TemplateStore
+func (s *SQLiteStore) UpdateTemplate(id string, update TemplateUpdate) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var data string
+	err = tx.QueryRow(`SELECT data FROM templates WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrTemplateNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	var tmpl ChangeTemplate
+	if err := json.Unmarshal([]byte(data), &tmpl); err != nil {
+		return err
+	}
+
+	update(&tmpl)
+
+	updated, err := json.Marshal(tmpl)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE templates SET data = ? WHERE id = ?`, string(updated), id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteTemplate implements TemplateStore
+func (s *SQLiteStore) DeleteTemplate(id string) error {
+	res, err := s.db.Exec(`DELETE FROM templates WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// scanJobs decodes the JSON job in each row and closes rows
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var job Job
+		if err := json.Unmarshal([]byte(data), &job); err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
@@ -0,0 +1,489 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// storeFactories creates a fresh instance of each Store implementation
+var storeFactories = map[string]func(t *testing.T) Store{
+	"memory": func(t *testing.T) Store {
+		return NewInMemoryStore()
+	},
+	"sqlite": func(t *testing.T) Store {
+		s, err := NewSQLiteStore(filepath.Join(t.TempDir(), "jobs.db"))
+		if err != nil {
+			t.Fatalf("Failed to open SQLite store: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	},
+}
+
+// forEachStore runs test against every Store implementation
+func forEachStore(t *testing.T, test func(t *testing.T, s Store)) {
+	for name, factory := range storeFactories {
+		t.Run(name, func(t *testing.T) {
+			test(t, factory(t))
+		})
+	}
+}
+
+func TestStoreSaveAndGet(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		job := newJob(Change{Kind: "Change", APIVersion: "v1", Spec: ChangeSpec{Prompt: "Test"}})
+		if err := s.Save(job); err != nil {
+			t.Fatalf("Failed to save job: %v", err)
+		}
+
+		got, err := s.Get(job.ID)
+		if err != nil {
+			t.Fatalf("Failed to get job: %v", err)
+		}
+		if got.Status != statusPending || got.Change.Spec.Prompt != "Test" {
+			t.Errorf("Unexpected job: %+v", got)
+		}
+		if !got.CreatedAt.Equal(job.CreatedAt) {
+			t.Errorf("Expected createdAt %v, got %v", job.CreatedAt, got.CreatedAt)
+		}
+
+		if err := s.Save(job); !errors.Is(err, ErrJobExists) {
+			t.Errorf("Expected ErrJobExists for duplicate ID, got %v", err)
+		}
+
+		if _, err := s.Get("missing"); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("Expected ErrJobNotFound, got %v", err)
+		}
+	})
+}
+
+func TestStoreUpdate(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		job := newJob(Change{})
+		if err := s.Save(job); err != nil {
+			t.Fatalf("Failed to save job: %v", err)
+		}
+
+		err := s.Update(job.ID, func(j *Job) {
+			j.Status = statusFailed
+			j.Error = "agent_failed"
+		})
+		if err != nil {
+			t.Fatalf("Failed to update job: %v", err)
+		}
+
+		got, _ := s.Get(job.ID)
+		if got.Status != statusFailed || got.Error != "agent_failed" {
+			t.Errorf("Expected update to be persisted, got %+v", got)
+		}
+
+		if err := s.Update("missing", func(j *Job) {}); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("Expected ErrJobNotFound, got %v", err)
+		}
+	})
+}
+
+func TestStoreListOrdersByCreationTime(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		base := time.Now()
+		var ids []string
+		for i := 0; i < 5; i++ {
+			job := newJob(Change{})
+			job.CreatedAt = base.Add(time.Duration(4-i) * -time.Second)
+			ids = append(ids, job.ID)
+			if err := s.Save(job); err != nil {
+				t.Fatalf("Failed to save job: %v", err)
+			}
+		}
+
+		page, total, err := s.List(1, 3, JobFilter{})
+		if err != nil {
+			t.Fatalf("Failed to list jobs: %v", err)
+		}
+		if total != 5 {
+			t.Errorf("Expected total 5, got %d", total)
+		}
+		if len(page) != 3 {
+			t.Fatalf("Expected 3 jobs, got %d", len(page))
+		}
+		for i, job := range page {
+			if job.ID != ids[i+1] {
+				t.Errorf("Expected job %d to be '%s', got '%s'", i, ids[i+1], job.ID)
+			}
+		}
+
+		if page, _, _ := s.List(5, 3, JobFilter{}); len(page) != 0 {
+			t.Errorf("Expected empty page past the end, got %d jobs", len(page))
+		}
+	})
+}
+
+func TestStoreListFiltersByCategory(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		for _, category := range []string{"security", "", "security", "refactor"} {
+			if err := s.Save(newJob(Change{Spec: ChangeSpec{Category: category}})); err != nil {
+				t.Fatalf("Failed to save job: %v", err)
+			}
+		}
+
+		page, total, err := s.List(0, 10, JobFilter{Category: "security"})
+		if err != nil {
+			t.Fatalf("Failed to list jobs: %v", err)
+		}
+		if total != 2 || len(page) != 2 {
+			t.Errorf("Expected 2 security jobs, got total %d with %d jobs", total, len(page))
+		}
+		for _, job := range page {
+			if job.Change.Spec.Category != "security" {
+				t.Errorf("Expected category 'security', got '%s'", job.Change.Spec.Category)
+			}
+		}
+
+		if _, total, _ := s.List(0, 10, JobFilter{Category: "uncategorized"}); total != 1 {
+			t.Errorf("Expected a job without a category to be uncategorized, got %d", total)
+		}
+		if _, total, _ := s.List(0, 10, JobFilter{}); total != 4 {
+			t.Errorf("Expected an empty filter to match all 4 jobs, got %d", total)
+		}
+	})
+}
+
+func TestStoreListFiltersByStatus(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		for _, category := range []string{"security", "security", "refactor"} {
+			job := newJob(Change{Spec: ChangeSpec{Category: category}})
+			job.Status = statusScheduled
+			if err := s.Save(job); err != nil {
+				t.Fatalf("Failed to save job: %v", err)
+			}
+		}
+		if err := s.Save(newJob(Change{Spec: ChangeSpec{Category: "security"}})); err != nil {
+			t.Fatalf("Failed to save job: %v", err)
+		}
+
+		if _, total, _ := s.List(0, 10, JobFilter{Status: statusScheduled}); total != 3 {
+			t.Errorf("Expected 3 scheduled jobs, got %d", total)
+		}
+		page, total, err := s.List(0, 10, JobFilter{Status: statusScheduled, Category: "security"})
+		if err != nil {
+			t.Fatalf("Failed to list jobs: %v", err)
+		}
+		if total != 2 || len(page) != 2 {
+			t.Errorf("Expected 2 scheduled security jobs, got total %d with %d jobs", total, len(page))
+		}
+	})
+}
+
+func TestStoreListFiltersByLabels(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		for _, labels := range []map[string]string{
+			{"team": "payments", "env": "prod"},
+			{"team": "payments", "env": "staging"},
+			{"team": "search"},
+			nil,
+		} {
+			if err := s.Save(newJob(Change{Spec: ChangeSpec{Labels: labels}})); err != nil {
+				t.Fatalf("Failed to save job: %v", err)
+			}
+		}
+
+		if _, total, _ := s.List(0, 10, JobFilter{Labels: map[string]string{"team": "payments"}}); total != 2 {
+			t.Errorf("Expected 2 payments jobs, got %d", total)
+		}
+		page, total, err := s.List(0, 10, JobFilter{Labels: map[string]string{"team": "payments", "env": "prod"}})
+		if err != nil {
+			t.Fatalf("Failed to list jobs: %v", err)
+		}
+		if total != 1 || len(page) != 1 || page[0].Change.Spec.Labels["env"] != "prod" {
+			t.Errorf("Expected the payments prod job, got total %d: %+v", total, page)
+		}
+		if _, total, _ := s.List(0, 10, JobFilter{Labels: map[string]string{"env": ""}}); total != 0 {
+			t.Errorf("Expected an empty value not to match a missing label, got %d jobs", total)
+		}
+	})
+}
+
+func TestStoreEnforcesUniqueNames(t *testing.T) {
+	named := func(name, namespace string) Job {
+		return newJob(Change{Metadata: &ObjectMeta{Name: name, Namespace: namespace}})
+	}
+
+	forEachStore(t, func(t *testing.T, s Store) {
+		first := named("fix-auth", "default")
+		if err := s.Save(first); err != nil {
+			t.Fatalf("Expected first save to succeed, got %v", err)
+		}
+
+		err := s.Save(named("fix-auth", "default"))
+		var conflict *nameConflictError
+		if !errors.As(err, &conflict) {
+			t.Fatalf("Expected name conflict, got %v", err)
+		}
+		if conflict.ExistingID != first.ID {
+			t.Errorf("Expected conflict with '%s', got '%s'", first.ID, conflict.ExistingID)
+		}
+
+		if err := s.Save(named("fix-auth", "team-a")); err != nil {
+			t.Errorf("Expected same name in another namespace to succeed, got %v", err)
+		}
+		if err := s.Save(newJob(Change{})); err != nil {
+			t.Errorf("Expected unnamed job to succeed, got %v", err)
+		}
+
+		s.Update(first.ID, func(j *Job) { j.Status = statusDone })
+		if err := s.Save(named("fix-auth", "default")); err != nil {
+			t.Errorf("Expected terminal name to be reusable, got %v", err)
+		}
+	})
+}
+
+func TestStoreTerminalNameReuseDisabled(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		switch s := s.(type) {
+		case *InMemoryStore:
+			s.ReuseTerminalNames = false
+		case *SQLiteStore:
+			s.ReuseTerminalNames = false
+		}
+
+		first := newJob(Change{Metadata: &ObjectMeta{Name: "fix-auth", Namespace: "default"}})
+		s.Save(first)
+		s.Update(first.ID, func(j *Job) { j.Status = statusDone })
+
+		second := newJob(Change{Metadata: &ObjectMeta{Name: "fix-auth", Namespace: "default"}})
+		if err := s.Save(second); err == nil {
+			t.Error("Expected terminal name not to be reusable when reuse is disabled")
+		}
+	})
+}
+
+func TestStoreConcurrentAccess(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(2)
+			job := newJob(Change{})
+			go func() {
+				defer wg.Done()
+				if err := s.Save(job); err != nil {
+					t.Errorf("Failed to save job: %v", err)
+				}
+				s.Update(job.ID, func(j *Job) { j.Status = statusRunning })
+			}()
+			go func() {
+				defer wg.Done()
+				s.Get(job.ID)
+				s.List(0, 10, JobFilter{})
+			}()
+		}
+		wg.Wait()
+
+		if _, total, _ := s.List(0, 1, JobFilter{}); total != 50 {
+			t.Errorf("Expected 50 jobs, got %d", total)
+		}
+	})
+}
+
+func TestStoreDelete(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		job := newJob(Change{Kind: "Change", APIVersion: "v1", Spec: ChangeSpec{Prompt: "Test"}})
+		if err := s.Save(job); err != nil {
+			t.Fatalf("Failed to save job: %v", err)
+		}
+
+		if err := s.Delete(job.ID); err != nil {
+			t.Fatalf("Failed to delete job: %v", err)
+		}
+		if _, err := s.Get(job.ID); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("Expected ErrJobNotFound after delete, got %v", err)
+		}
+		if err := s.Delete(job.ID); !errors.Is(err, ErrJobNotFound) {
+			t.Errorf("Expected ErrJobNotFound deleting twice, got %v", err)
+		}
+	})
+}
+
+func TestStoreConcurrentDelete(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		job := newJob(Change{})
+		if err := s.Save(job); err != nil {
+			t.Fatalf("Failed to save job: %v", err)
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		deleted := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				err := s.Delete(job.ID)
+				if err != nil && !errors.Is(err, ErrJobNotFound) {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				s.Update(job.ID, func(j *Job) { j.Status = statusRunning })
+				if err == nil {
+					mu.Lock()
+					deleted++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if deleted != 1 {
+			t.Errorf("Expected exactly one successful delete, got %d", deleted)
+		}
+	})
+}
+
+func TestStoreIdempotencyRecords(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		now := time.Now().UTC()
+		record := IdempotencyRecord{
+			Key:         "retry-1",
+			RequestHash: "5d41402abc4b2a76b9719d911017c592",
+			Status:      202,
+			Body:        []byte(`{"id":"abc"}`),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(time.Hour),
+		}
+		if err := s.SaveIdempotencyRecord(record); err != nil {
+			t.Fatalf("Failed to save idempotency record: %v", err)
+		}
+
+		got, err := s.GetIdempotencyRecord("retry-1")
+		if err != nil {
+			t.Fatalf("Failed to get idempotency record: %v", err)
+		}
+		if got.Status != record.Status || got.RequestHash != record.RequestHash || string(got.Body) != string(record.Body) {
+			t.Errorf("Unexpected record: %+v", got)
+		}
+
+		expired := IdempotencyRecord{Key: "retry-2", Status: 202, Body: []byte(`{}`), CreatedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)}
+		if err := s.SaveIdempotencyRecord(expired); err != nil {
+			t.Fatalf("Failed to save idempotency record: %v", err)
+		}
+		if _, err := s.GetIdempotencyRecord("retry-2"); !errors.Is(err, ErrIdempotencyRecordNotFound) {
+			t.Errorf("Expected ErrIdempotencyRecordNotFound for an expired record, got %v", err)
+		}
+		if _, err := s.GetIdempotencyRecord("missing"); !errors.Is(err, ErrIdempotencyRecordNotFound) {
+			t.Errorf("Expected ErrIdempotencyRecordNotFound, got %v", err)
+		}
+	})
+}
+
+func TestStoreTemplates(t *testing.T) {
+	forEachStore(t, func(t *testing.T, s Store) {
+		base := time.Now().UTC()
+		first := ChangeTemplate{ID: newID(), CreatedAt: base.Add(time.Second), Change: Change{Spec: ChangeSpec{Prompt: "Second"}}}
+		second := ChangeTemplate{ID: newID(), CreatedAt: base, Change: Change{Spec: ChangeSpec{Prompt: "First"}}}
+		for _, tmpl := range []ChangeTemplate{first, second} {
+			if err := s.SaveTemplate(tmpl); err != nil {
+				t.Fatalf("Failed to save template: %v", err)
+			}
+		}
+
+		templates, err := s.ListTemplates()
+		if err != nil {
+			t.Fatalf("Failed to list templates: %v", err)
+		}
+		if len(templates) != 2 || templates[0].ID != second.ID || templates[1].ID != first.ID {
+			t.Errorf("Expected templates ordered by creation time, got %+v", templates)
+		}
+
+		if err := s.UpdateTemplate(first.ID, func(tmpl *ChangeTemplate) { tmpl.Spec.Prompt = "Updated" }); err != nil {
+			t.Fatalf("Failed to update template: %v", err)
+		}
+		got, err := s.GetTemplate(first.ID)
+		if err != nil {
+			t.Fatalf("Failed to get template: %v", err)
+		}
+		if got.Spec.Prompt != "Updated" {
+			t.Errorf("Expected updated prompt, got %q", got.Spec.Prompt)
+		}
+
+		if err := s.DeleteTemplate(first.ID); err != nil {
+			t.Fatalf("Failed to delete template: %v", err)
+		}
+		if _, err := s.GetTemplate(first.ID); !errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("Expected ErrTemplateNotFound after delete, got %v", err)
+		}
+		if err := s.UpdateTemplate(first.ID, func(*ChangeTemplate) {}); !errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("Expected ErrTemplateNotFound updating a deleted template, got %v", err)
+		}
+		if err := s.DeleteTemplate(first.ID); !errors.Is(err, ErrTemplateNotFound) {
+			t.Errorf("Expected ErrTemplateNotFound deleting twice, got %v", err)
+		}
+	})
+}
+
+func TestSQLiteStorePersistsAcrossReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+
+	s, err := NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open SQLite store: %v", err)
+	}
+	job := newJob(Change{Spec: ChangeSpec{Prompt: "Durable"}})
+	if err := s.Save(job); err != nil {
+		t.Fatalf("Failed to save job: %v", err)
+	}
+	s.Close()
+
+	// Reopening must not re-run migrations against the existing schema
+	s, err = NewSQLiteStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen SQLite store: %v", err)
+	}
+	defer s.Close()
+
+	got, err := s.Get(job.ID)
+	if err != nil {
+		t.Fatalf("Failed to get job after reopen: %v", err)
+	}
+	if got.Change.Spec.Prompt != "Durable" {
+		t.Errorf("Expected persisted prompt, got '%s'", got.Change.Spec.Prompt)
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := openStore(Config{})
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if _, ok := s.(*InMemoryStore); !ok {
+		t.Errorf("Expected an InMemoryStore without a database, got %T", s)
+	}
+
+	for _, cfg := range []Config{
+		{DBPath: filepath.Join(dir, "path.db")},
+		{DatabaseURL: "sqlite://" + filepath.Join(dir, "url.db")},
+		{DatabaseURL: "sqlite:" + filepath.Join(dir, "opaque.db")},
+		{DatabaseURL: "file:" + filepath.Join(dir, "uri.db")},
+		{DatabaseURL: filepath.Join(dir, "plain.db"), DBPath: filepath.Join(dir, "ignored.db")},
+	} {
+		s, err := openStore(cfg)
+		if err != nil {
+			t.Fatalf("%+v: failed to open store: %v", cfg, err)
+		}
+		sqliteStore, ok := s.(*SQLiteStore)
+		if !ok {
+			t.Fatalf("%+v: expected a SQLiteStore, got %T", cfg, s)
+		}
+		sqliteStore.Close()
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ignored.db")); !os.IsNotExist(err) {
+		t.Error("Expected DATABASE_URL to take precedence over DB_PATH")
+	}
+
+	if _, err := openStore(Config{DatabaseURL: "postgres://db.example.com/jobs"}); err == nil {
+		t.Error("Expected an unsupported DATABASE_URL scheme to be an error")
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ChangeTemplate is a reusable change whose spec.prompt may contain
+// {{variable}} placeholders, filled in when the template is instantiated
+type ChangeTemplate struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	Change
+}
+
+// templateVariable matches a {{variable}} placeholder, allowing whitespace
+// inside the braces
+var templateVariable = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// renderPrompt replaces the placeholders in prompt with their values from
+// vars, returning the sorted names of any variables that weren't provided
+func renderPrompt(prompt string, vars map[string]string) (string, []string) {
+	missing := make(map[string]bool)
+	rendered := templateVariable.ReplaceAllStringFunc(prompt, func(placeholder string) string {
+		name := templateVariable.FindStringSubmatch(placeholder)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing[name] = true
+			return placeholder
+		}
+		return value
+	})
+
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return rendered, names
+}
+
+// validateTemplate checks that change is valid as the body of a template.
+// Placeholders are left in place, so a template must be a valid change
+// before it is rendered.
+func validateTemplate(change Change) *ErrorResponse {
+	applyChangeDefaults(&change)
+	return validateChange(change)
+}
+
+// bindTemplate binds and validates the template body of c, writing the error
+// response and returning false when it is invalid
+func bindTemplate(c *gin.Context) (Change, bool) {
+	log := requestLogger(c)
+
+	var change Change
+	if err := c.ShouldBindJSON(&change); err != nil {
+		log.Error("Failed to bind template", "error", err)
+		respondBindError(c, err)
+		return Change{}, false
+	}
+
+	if errResp := validateTemplate(change); errResp != nil {
+		log.Warn("Invalid template", "error", errResp.Error, "message", errResp.Message)
+		respondError(c, http.StatusBadRequest, *errResp)
+		return Change{}, false
+	}
+	return change, true
+}
+
+// handleCreateTemplate handles requests to store a new change template
+func handleCreateTemplate(c *gin.Context) {
+	log := requestLogger(c)
+
+	change, ok := bindTemplate(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now().UTC()
+	tmpl := ChangeTemplate{ID: newID(), CreatedAt: now, UpdatedAt: now, Change: change}
+	if err := store.SaveTemplate(tmpl); err != nil {
+		respondTemplateError(c, tmpl.ID, err)
+		return
+	}
+
+	log.Info("Template created", "id", tmpl.ID)
+
+	c.JSON(http.StatusCreated, tmpl)
+}
+
+// handleListTemplates handles requests for every stored change template
+func handleListTemplates(c *gin.Context) {
+	templates, err := store.ListTemplates()
+	if err != nil {
+		requestLogger(c).Error("Failed to list templates", "error", err)
+		respondError(c, http.StatusInternalServerError, ErrorResponse{
+			Error:   "internal_error",
+			Message: "failed to list templates",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"templates": templates,
+	})
+}
+
+// handleGetTemplate handles requests for a single change template
+func handleGetTemplate(c *gin.Context) {
+	id := c.Param("id")
+
+	tmpl, err := store.GetTemplate(id)
+	if err != nil {
+		respondTemplateError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// handleUpdateTemplate handles requests to replace the body of a change
+// template, keeping its ID and creation time
+func handleUpdateTemplate(c *gin.Context) {
+	log := requestLogger(c)
+
+	id := c.Param("id")
+
+	change, ok := bindTemplate(c)
+	if !ok {
+		return
+	}
+
+	var tmpl ChangeTemplate
+	err := store.UpdateTemplate(id, func(t *ChangeTemplate) {
+		t.Change = change
+		t.UpdatedAt = time.Now().UTC()
+		tmpl = *t
+	})
+	if err != nil {
+		respondTemplateError(c, id, err)
+		return
+	}
+
+	log.Info("Template updated", "id", id)
+
+	c.JSON(http.StatusOK, tmpl)
+}
+
+// handleDeleteTemplate handles requests to remove a change template. Changes
+// already instantiated from it are unaffected.
+func handleDeleteTemplate(c *gin.Context) {
+	log := requestLogger(c)
+
+	id := c.Param("id")
+
+	if err := store.DeleteTemplate(id); err != nil {
+		respondTemplateError(c, id, err)
+		return
+	}
+
+	log.Info("Template deleted", "id", id)
+
+	c.Status(http.StatusNoContent)
+}
+
+// handleInstantiateTemplate handles requests to submit a change rendered from
+// a template. The body maps placeholder names to their values.
+func handleInstantiateTemplate(c *gin.Context) {
+	markReceived(c)
+	log := requestLogger(c)
+
+	id := c.Param("id")
+
+	tmpl, err := store.GetTemplate(id)
+	if err != nil {
+		respondTemplateError(c, id, err)
+		return
+	}
+
+	var vars map[string]string
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&vars); err != nil {
+			log.Error("Failed to bind template variables", "error", err)
+			respondBindError(c, err)
+			return
+		}
+	}
+
+	change := tmpl.Change
+	prompt, missing := renderPrompt(change.Spec.Prompt, vars)
+	if len(missing) > 0 {
+		log.Warn("Missing template variables", "id", id, "missing", missing)
+		respondError(c, http.StatusBadRequest, ErrorResponse{
+			Error:   "missing_template_variables",
+			Message: fmt.Sprintf("no value provided for template variables: %s", strings.Join(missing, ", ")),
+		})
+		return
+	}
+	change.Spec.Prompt = prompt
+
+	log.Info("Instantiating template", "template", id)
+
+	submitChange(c, change)
+}
+
+// respondTemplateError writes the error response for a failed store
+// operation on the template with the given ID
+func respondTemplateError(c *gin.Context, id string, err error) {
+	if errors.Is(err, ErrTemplateNotFound) {
+		requestLogger(c).Warn("Template not found", "id", id)
+		respondError(c, http.StatusNotFound, ErrorResponse{
+			Error:   "template_not_found",
+			Message: fmt.Sprintf("no template with id %q", id),
+		})
+		return
+	}
+
+	requestLogger(c).Error("Failed to access template", "id", id, "error", err)
+	respondError(c, http.StatusInternalServerError, ErrorResponse{
+		Error:   "internal_error",
+		Message: "failed to access template",
+	})
+}
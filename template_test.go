@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// templateRouter creates a router serving the template endpoints
+func templateRouter() *gin.Engine {
+	router := gin.New()
+	router.POST("/templates", handleCreateTemplate)
+	router.GET("/templates", handleListTemplates)
+	router.GET("/templates/:id", handleGetTemplate)
+	router.PUT("/templates/:id", handleUpdateTemplate)
+	router.DELETE("/templates/:id", handleDeleteTemplate)
+	router.POST("/templates/:id/instantiate", handleInstantiateTemplate)
+	return router
+}
+
+// createTestTemplate stores a template with the given prompt through the API
+func createTestTemplate(t *testing.T, router *gin.Engine, prompt string) ChangeTemplate {
+	t.Helper()
+
+	change := validTestChange()
+	change.Spec.Prompt = prompt
+	w := postJSON(router, "/templates", change)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var tmpl ChangeTemplate
+	if err := json.Unmarshal(w.Body.Bytes(), &tmpl); err != nil {
+		t.Fatalf("Failed to parse template: %v", err)
+	}
+	return tmpl
+}
+
+func TestRenderPrompt(t *testing.T) {
+	tests := []struct {
+		name        string
+		prompt      string
+		vars        map[string]string
+		want        string
+		wantMissing []string
+	}{
+		{"no placeholders", "Bump Go", nil, "Bump Go", []string{}},
+		{"single", "Bump {{module}}", map[string]string{"module": "gin"}, "Bump gin", []string{}},
+		{"whitespace and repeats", "{{ a }} and {{a}}", map[string]string{"a": "x"}, "x and x", []string{}},
+		{"extra vars ignored", "Bump {{module}}", map[string]string{"module": "gin", "other": "y"}, "Bump gin", []string{}},
+		{"missing sorted", "{{b}} {{a}} {{b}}", nil, "{{b}} {{a}} {{b}}", []string{"a", "b"}},
+		{"not a placeholder", "{{1x}} {{}}", nil, "{{1x}} {{}}", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, missing := renderPrompt(tt.prompt, tt.vars)
+			if got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("Expected missing %v, got %v", tt.wantMissing, missing)
+			}
+		})
+	}
+}
+
+func TestTemplateEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	router := templateRouter()
+
+	tmpl := createTestTemplate(t, router, "Upgrade {{module}} to {{version}}")
+	if tmpl.ID == "" || tmpl.CreatedAt.IsZero() || tmpl.Spec.Prompt != "Upgrade {{module}} to {{version}}" {
+		t.Fatalf("Unexpected template: %+v", tmpl)
+	}
+
+	req, _ := http.NewRequest("GET", "/templates/"+tmpl.ID, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	updated := validTestChange()
+	updated.Spec.Prompt = "Remove {{module}}"
+	body, _ := json.Marshal(updated)
+	req, _ = http.NewRequest("PUT", "/templates/"+tmpl.ID, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var got ChangeTemplate
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if got.ID != tmpl.ID || !got.CreatedAt.Equal(tmpl.CreatedAt) || got.Spec.Prompt != "Remove {{module}}" {
+		t.Errorf("Unexpected updated template: %+v", got)
+	}
+
+	req, _ = http.NewRequest("GET", "/templates", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var list struct {
+		Templates []ChangeTemplate `json:"templates"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Templates) != 1 || list.Templates[0].Spec.Prompt != "Remove {{module}}" {
+		t.Errorf("Unexpected template list: %s", w.Body.String())
+	}
+
+	req, _ = http.NewRequest("DELETE", "/templates/"+tmpl.ID, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204, got %d", w.Code)
+	}
+
+	for _, method := range []string{"GET", "PUT", "DELETE"} {
+		req, _ = http.NewRequest(method, "/templates/"+tmpl.ID, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status 404 after delete, got %d", method, w.Code)
+		}
+		var response ErrorResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		if response.Error != "template_not_found" {
+			t.Errorf("%s: expected error 'template_not_found', got '%s'", method, response.Error)
+		}
+	}
+}
+
+func TestCreateTemplateValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	router := templateRouter()
+
+	change := validTestChange()
+	change.Spec.Repos = nil
+	w := postJSON(router, "/templates", change)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+	var response ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	if response.Error != "missing_repos" {
+		t.Errorf("Expected error 'missing_repos', got '%s'", response.Error)
+	}
+}
+
+func TestInstantiateTemplate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	router := templateRouter()
+	router.GET("/changes/:id", handleGetChange)
+
+	tmpl := createTestTemplate(t, router, "Upgrade {{module}} to {{version}}")
+
+	w := postJSON(router, "/templates/"+tmpl.ID+"/instantiate", map[string]string{"module": "gin"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400, got %d", w.Code)
+	}
+	var errResp ErrorResponse
+	json.Unmarshal(w.Body.Bytes(), &errResp)
+	if errResp.Error != "missing_template_variables" || errResp.Message != "no value provided for template variables: version" {
+		t.Errorf("Unexpected error: %+v", errResp)
+	}
+
+	w = postJSON(router, "/templates/"+tmpl.ID+"/instantiate", map[string]string{"module": "gin", "version": "v1.10.0"})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+
+	job, err := store.Get(created.ID)
+	if err != nil {
+		t.Fatalf("Expected the change to be stored: %v", err)
+	}
+	if job.Change.Spec.Prompt != "Upgrade gin to v1.10.0" {
+		t.Errorf("Expected rendered prompt, got %q", job.Change.Spec.Prompt)
+	}
+
+	if stored, _ := store.GetTemplate(tmpl.ID); stored.Spec.Prompt != "Upgrade {{module}} to {{version}}" {
+		t.Errorf("Expected the template to be unchanged, got %q", stored.Spec.Prompt)
+	}
+
+	w = postJSON(router, "/templates/missing/instantiate", map[string]string{})
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown template, got %d", w.Code)
+	}
+}
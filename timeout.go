@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ginTimeout is a middleware that gives each request a deadline of timeout.
+// Handlers see the request context cancelled when it passes, and the client
+// receives a 503 request_timeout straight away rather than waiting for the
+// handler to notice. The handler's own response is buffered and sent only if
+// it finishes in time. A timeout of 0 disables the middleware. Submissions
+// waiting for their change with ?wait=true are exempt, since changes may
+// run far longer; respondWhenFinished bounds them instead.
+func ginTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 || waitRequested(c) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		log := requestLogger(c)
+		// Start from the status gin has already chosen, such as the 404 for
+		// an unknown route, which it sets before running the middleware
+		tw := &timeoutWriter{ResponseWriter: c.Writer, limit: timeout, header: make(http.Header), status: c.Writer.Status()}
+		c.Writer = tw
+
+		// The handler runs on this goroutine, since gin contexts aren't safe
+		// for concurrent use; only the 503 is written from the watcher
+		done := make(chan struct{})
+		watched := make(chan struct{})
+		go func() {
+			defer close(watched)
+			select {
+			case <-ctx.Done():
+				if ctx.Err() == context.DeadlineExceeded {
+					tw.timeout()
+				}
+			case <-done:
+			}
+		}()
+
+		defer func() {
+			close(done)
+			<-watched
+			c.Writer = tw.ResponseWriter
+		}()
+
+		c.Next()
+
+		// The handler may return as soon as it sees the deadline, before the
+		// watcher has written the 503
+		if !tw.finish(ctx.Err() == context.DeadlineExceeded) {
+			log.Warn("Request timed out", "timeout", timeout.String())
+			c.Set(errorCodeContextKey, "request_timeout")
+			c.Abort()
+		}
+	}
+}
+
+// timeoutWriter buffers a handler's response so ginTimeout can replace it
+// with a 503 if the deadline passes first
+type timeoutWriter struct {
+	gin.ResponseWriter
+
+	limit    time.Duration
+	mu       sync.Mutex
+	header   http.Header
+	body     bytes.Buffer
+	status   int
+	written  bool
+	timedOut bool
+	finished bool
+}
+
+// Header implements http.ResponseWriter
+func (w *timeoutWriter) Header() http.Header {
+	return w.header
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *timeoutWriter) WriteHeader(code int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.written {
+		w.status = code
+	}
+}
+
+// WriteHeaderNow implements gin.ResponseWriter
+func (w *timeoutWriter) WriteHeaderNow() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.written = true
+}
+
+// Write implements http.ResponseWriter. Writes after a timeout are dropped.
+func (w *timeoutWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	w.written = true
+	return w.body.Write(data)
+}
+
+// WriteString implements gin.ResponseWriter
+func (w *timeoutWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Status implements gin.ResponseWriter
+func (w *timeoutWriter) Status() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.status
+}
+
+// Size implements gin.ResponseWriter
+func (w *timeoutWriter) Size() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.written {
+		return -1
+	}
+	return w.body.Len()
+}
+
+// Written implements gin.ResponseWriter
+func (w *timeoutWriter) Written() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.written
+}
+
+// Flush implements http.Flusher as a no-op, since the response is only sent
+// once the handler finishes
+func (w *timeoutWriter) Flush() {}
+
+// timeout writes the 503 to the underlying writer unless the handler has
+// already finished or it has already been written
+func (w *timeoutWriter) timeout() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.finished && !w.timedOut {
+		w.writeTimeout()
+	}
+}
+
+// finish sends the buffered response to the underlying writer and reports
+// whether it did so. When the handler outlived the deadline, expired is set
+// and the 503 is sent instead, if the watcher hasn't already sent it.
+func (w *timeoutWriter) finish(expired bool) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.timedOut {
+		return false
+	}
+	if expired {
+		w.writeTimeout()
+		return false
+	}
+	w.finished = true
+
+	dst := w.ResponseWriter.Header()
+	for key, values := range w.header {
+		dst[key] = values
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+	if w.written {
+		w.ResponseWriter.WriteHeaderNow()
+		w.ResponseWriter.Write(w.body.Bytes())
+	}
+	return true
+}
+
+// writeTimeout writes the 503 to the underlying writer and drops any later
+// writes by the handler. w.mu must be held.
+func (w *timeoutWriter) writeTimeout() {
+	w.timedOut = true
+
+	body, _ := json.Marshal(ErrorResponse{
+		Error:   "request_timeout",
+		Message: "request did not complete within " + w.limit.String(),
+		HelpURL: errorHelpURL("request_timeout"),
+	})
+	w.ResponseWriter.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.ResponseWriter.WriteHeader(http.StatusServiceUnavailable)
+	w.ResponseWriter.Write(body)
+	w.ResponseWriter.Flush()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGinTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	cancelled := make(chan error, 1)
+	router := gin.New()
+	router.Use(ginTimeout(50 * time.Millisecond))
+	router.GET("/slow", func(c *gin.Context) {
+		select {
+		case <-c.Request.Context().Done():
+			cancelled <- c.Request.Context().Err()
+		case <-time.After(5 * time.Second):
+			cancelled <- nil
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "too late"})
+	})
+
+	req := httptest.NewRequest("GET", "/slow", nil)
+	w := httptest.NewRecorder()
+	start := time.Now()
+	router.ServeHTTP(w, req)
+
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the request to time out after 50ms, took %v", elapsed)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected status 503, got %d", w.Code)
+	}
+	var response ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response %q: %v", w.Body.String(), err)
+	}
+	if response.Error != "request_timeout" {
+		t.Errorf("Expected error 'request_timeout', got '%s'", response.Error)
+	}
+	if err := <-cancelled; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected the handler to see its context cancelled, got %v", err)
+	}
+}
+
+func TestGinTimeoutFastHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(ginTimeout(time.Second))
+	router.GET("/fast", func(c *gin.Context) {
+		if _, ok := c.Request.Context().Deadline(); !ok {
+			t.Error("Expected the request context to have a deadline")
+		}
+		c.Header("X-Test", "yes")
+		c.JSON(http.StatusCreated, gin.H{"status": "ok"})
+	})
+	router.DELETE("/fast", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	req := httptest.NewRequest("GET", "/fast", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", w.Code)
+	}
+	if w.Header().Get("X-Test") != "yes" {
+		t.Errorf("Expected handler headers to be kept, got %v", w.Header())
+	}
+	if w.Body.String() != `{"status":"ok"}` {
+		t.Errorf("Unexpected body %q", w.Body.String())
+	}
+
+	req = httptest.NewRequest("DELETE", "/fast", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || w.Body.Len() != 0 {
+		t.Errorf("Expected an empty 204, got %d %q", w.Code, w.Body.String())
+	}
+}
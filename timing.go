@@ -0,0 +1,32 @@
+package main
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// receivedAtContextKey is the gin.Context key holding when a submission
+// reached its handler
+const receivedAtContextKey = "receivedAt"
+
+// markReceived records that the request reached its handler now. Handlers
+// call it on entry so the duration reported by withServerTiming covers
+// binding and validating the body.
+func markReceived(c *gin.Context) {
+	c.Set(receivedAtContextKey, time.Now().UTC())
+}
+
+// withServerTiming adds to body when the request reached its handler, as
+// receivedAt, and the milliseconds spent handling it so far, as durationMs,
+// for client-side latency tracking. body is returned unchanged when the
+// handler didn't call markReceived.
+func withServerTiming(c *gin.Context, body gin.H) gin.H {
+	received, ok := c.Value(receivedAtContextKey).(time.Time)
+	if !ok {
+		return body
+	}
+	body["receivedAt"] = received.Format(time.RFC3339Nano)
+	body["durationMs"] = float64(time.Since(received).Microseconds()) / 1000
+	return body
+}
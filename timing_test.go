@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChangeResponseServerTiming(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	dryRun := validTestChange()
+	dryRun.Spec.DryRun = true
+
+	tests := []struct {
+		name       string
+		change     Change
+		wantStatus int
+	}{
+		{"accepted", validTestChange(), http.StatusAccepted},
+		{"dry run", dryRun, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := time.Now()
+			w := postJSON(router, "/change", tt.change)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantStatus, w.Code, w.Body.String())
+			}
+
+			var response struct {
+				ReceivedAt *string  `json:"receivedAt"`
+				DurationMs *float64 `json:"durationMs"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to unmarshal response: %v", err)
+			}
+			if response.ReceivedAt == nil || response.DurationMs == nil {
+				t.Fatalf("Expected receivedAt and durationMs, got %s", w.Body.String())
+			}
+
+			received, err := time.Parse(time.RFC3339, *response.ReceivedAt)
+			if err != nil {
+				t.Fatalf("Expected an RFC3339 receivedAt, got %q: %v", *response.ReceivedAt, err)
+			}
+			if received.Before(before.Add(-time.Second)) || received.After(time.Now()) {
+				t.Errorf("Expected receivedAt around %v, got %v", before, received)
+			}
+			if *response.DurationMs < 0 {
+				t.Errorf("Expected a non-negative durationMs, got %v", *response.DurationMs)
+			}
+		})
+	}
+
+	// Errors keep the ErrorResponse shape
+	invalid := validTestChange()
+	invalid.Spec.Prompt = ""
+	w := postJSON(router, "/change", invalid)
+	var errResp map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &errResp); err != nil {
+		t.Fatalf("Failed to unmarshal error: %v", err)
+	}
+	if _, ok := errResp["receivedAt"]; ok {
+		t.Errorf("Expected no receivedAt in an error response, got %v", errResp)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// defaultTLSMinVersion is the oldest TLS version accepted when
+// TLS_MIN_VERSION is unset
+const defaultTLSMinVersion = "Tls12"
+
+// tlsVersions maps the lowercased TLS_MIN_VERSION values to TLS versions
+var tlsVersions = map[string]uint16{
+	"tls10": tls.VersionTLS10,
+	"tls11": tls.VersionTLS11,
+	"tls12": tls.VersionTLS12,
+	"tls13": tls.VersionTLS13,
+}
+
+// serverTLSConfig returns the TLS settings the server is started with, or
+// nil when cfg doesn't configure TLS. Setting only one of the certificate and
+// key files is an error, as is an unknown minimum version.
+func serverTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" && cfg.TLSKeyFile == "" {
+		return nil, nil
+	}
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	version, ok := tlsVersions[strings.ToLower(cfg.TLSMinVersion)]
+	if !ok {
+		return nil, fmt.Errorf("TLS_MIN_VERSION %q is not supported, must be one of Tls10, Tls11, Tls12 or Tls13", cfg.TLSMinVersion)
+	}
+
+	return &tls.Config{MinVersion: version}, nil
+}
+
+// serve accepts connections on listener until srv is shut down, terminating
+// TLS with cfg's certificate and key when srv has a TLS config and serving
+// plain HTTP otherwise
+func serve(srv *http.Server, listener net.Listener, cfg Config) error {
+	if srv.TLSConfig != nil {
+		return srv.ServeTLS(listener, cfg.TLSCertFile, cfg.TLSKeyFile)
+	}
+	return srv.Serve(listener)
+}
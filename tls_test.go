@@ -0,0 +1,151 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestServerTLSConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         Config
+		wantTLS     bool
+		wantVersion uint16
+		wantErr     bool
+	}{
+		{name: "disabled", cfg: Config{TLSMinVersion: defaultTLSMinVersion}},
+		{name: "default version", cfg: Config{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", TLSMinVersion: defaultTLSMinVersion}, wantTLS: true, wantVersion: tls.VersionTLS12},
+		{name: "tls 1.3", cfg: Config{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", TLSMinVersion: "Tls13"}, wantTLS: true, wantVersion: tls.VersionTLS13},
+		{name: "case insensitive", cfg: Config{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", TLSMinVersion: "TLS11"}, wantTLS: true, wantVersion: tls.VersionTLS11},
+		{name: "cert only", cfg: Config{TLSCertFile: "cert.pem", TLSMinVersion: defaultTLSMinVersion}, wantErr: true},
+		{name: "key only", cfg: Config{TLSKeyFile: "key.pem", TLSMinVersion: defaultTLSMinVersion}, wantErr: true},
+		{name: "unknown version", cfg: Config{TLSCertFile: "cert.pem", TLSKeyFile: "key.pem", TLSMinVersion: "1.2"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := serverTLSConfig(tt.cfg)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("Expected an error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (got != nil) != tt.wantTLS {
+				t.Fatalf("Expected TLS enabled %v, got %v", tt.wantTLS, got != nil)
+			}
+			if got != nil && got.MinVersion != tt.wantVersion {
+				t.Errorf("Expected minimum version %x, got %x", tt.wantVersion, got.MinVersion)
+			}
+		})
+	}
+}
+
+// writeSelfSignedCert writes a self-signed certificate for 127.0.0.1 and its
+// key to dir as PEM files, returning their paths and a pool trusting the
+// certificate
+func writeSelfSignedCert(t *testing.T, dir string) (certFile, keyFile string, pool *x509.CertPool) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "demo-app test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func TestServeTLS(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	certFile, keyFile, pool := writeSelfSignedCert(t, t.TempDir())
+	cfg := Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: defaultTLSMinVersion}
+	tlsConfig, err := serverTLSConfig(cfg)
+	if err != nil {
+		t.Fatalf("Failed to build TLS config: %v", err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	srv := &http.Server{Handler: newRouter(), TLSConfig: tlsConfig}
+	served := make(chan error, 1)
+	go func() { served <- serve(srv, listener, cfg) }()
+	t.Cleanup(func() {
+		shutdownServer(srv, time.Second)
+		<-served
+	})
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	resp, err := client.Get("https://" + listener.Addr().String() + "/health")
+	if err != nil {
+		t.Fatalf("Failed to reach server over HTTPS: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if resp.TLS == nil || resp.TLS.Version < tls.VersionTLS12 {
+		t.Errorf("Expected a TLS 1.2+ connection, got %+v", resp.TLS)
+	}
+
+	// Plain HTTP isn't served alongside HTTPS
+	plain, err := http.Get("http://" + listener.Addr().String() + "/health")
+	if err == nil {
+		defer plain.Body.Close()
+		if plain.StatusCode == http.StatusOK {
+			t.Error("Expected plain HTTP requests to be refused")
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recordSpans installs a tracer provider that records finished spans for the
+// duration of a test
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previousProvider, previousPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previousProvider)
+		otel.SetTextMapPropagator(previousPropagator)
+	})
+
+	return recorder
+}
+
+// spanAttribute returns the value of key on span, or an invalid value if it
+// isn't set
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestOtelMiddlewareContinuesIncomingTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := recordSpans(t)
+
+	router := gin.New()
+	router.Use(otelMiddleware())
+	router.GET("/changes/:id", func(c *gin.Context) {
+		c.Status(http.StatusNotFound)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/changes/abc", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+
+	if span.Name() != "GET /changes/:id" {
+		t.Errorf("Expected span name 'GET /changes/:id', got '%s'", span.Name())
+	}
+	if got := span.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("Expected span to continue trace %s, got %s", traceID, got)
+	}
+	if got := span.Parent().SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("Expected parent span 00f067aa0ba902b7, got %s", got)
+	}
+	if got := spanAttribute(span, "http.request.method").AsString(); got != "GET" {
+		t.Errorf("Expected method attribute 'GET', got '%s'", got)
+	}
+	if got := spanAttribute(span, "http.route").AsString(); got != "/changes/:id" {
+		t.Errorf("Expected route attribute '/changes/:id', got '%s'", got)
+	}
+	if got := spanAttribute(span, "http.response.status_code").AsInt64(); got != http.StatusNotFound {
+		t.Errorf("Expected status code attribute 404, got %d", got)
+	}
+}
+
+func TestProcessJobContinuesSubmissionTrace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	recorder := recordSpans(t)
+
+	router := gin.New()
+	router.Use(otelMiddleware())
+	router.POST("/change", handleChange)
+
+	w := postJSON(router, "/change", Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Trace me",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "gemini-cli",
+		},
+	})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	id, _ := queue.pop(context.Background())
+	processJob(context.Background(), id)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected request and job spans, got %d spans", len(spans))
+	}
+	request, job := spans[0], spans[1]
+	if job.Name() != "processJob" {
+		t.Fatalf("Expected job span 'processJob', got '%s'", job.Name())
+	}
+	if job.SpanContext().TraceID() != request.SpanContext().TraceID() {
+		t.Error("Expected the job span to join the submitting request's trace")
+	}
+	if job.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Error("Expected the job span to be a child of the request span")
+	}
+	if got := spanAttribute(job, "change.id").AsString(); got != id {
+		t.Errorf("Expected change.id attribute '%s', got '%s'", id, got)
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// FieldError describes one validation failure in a submitted change
+type FieldError struct {
+	// Field is the path of the offending field, such as "spec.repos[1]"
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// applyChangeDefaults fills in the fields of change that may be omitted:
+// the metadata namespace, the category and the branch
+func applyChangeDefaults(change *Change) {
+	if change.Metadata != nil && change.Metadata.Namespace == "" {
+		change.Metadata.Namespace = config.DefaultNamespace
+	}
+	if change.Spec.Category == "" {
+		change.Spec.Category = defaultCategory
+	}
+	if change.Spec.Branch == "" {
+		change.Spec.Branch = config.DefaultBranch
+	}
+	if change.Spec.Priority == 0 {
+		change.Spec.Priority = defaultPriority
+	}
+	if change.Spec.TimeoutSeconds == 0 {
+		change.Spec.TimeoutSeconds = defaultTimeoutSeconds
+	}
+	if change.Spec.Execution == "" {
+		change.Spec.Execution = executionParallel
+	}
+	for i := range change.Spec.Repos {
+		change.Spec.Repos[i].URL = normalizeRepoURL(change.Spec.Repos[i].URL)
+	}
+}
+
+// validateChange checks change against the rules every submission endpoint
+// enforces, returning nil when it is valid. Every violation is listed in
+// Errors; Error and Message describe the first, for clients that only read
+// those. Defaults are expected to have been applied with
+// applyChangeDefaults. The hotfix reason travels in a request header, so
+// hotfix changes are checked separately by validateHotfix.
+func validateChange(change Change) *ErrorResponse {
+	var errs []FieldError
+	add := func(field, code, message string) {
+		errs = append(errs, FieldError{Field: field, Code: code, Message: message})
+	}
+	addResponse := func(field string, errResp *ErrorResponse) {
+		if errResp != nil {
+			add(field, errResp.Error, errResp.Message)
+		}
+	}
+
+	// Validate kind field
+	if change.Kind != "Change" {
+		add("kind", "invalid_kind", "kind must be 'Change'")
+	}
+
+	// Validate API version
+	if change.APIVersion == "" {
+		add("apiVersion", "missing_api_version", "apiVersion is required")
+	} else if !supportedAPIVersions[change.APIVersion] {
+		add("apiVersion", "unsupported_api_version",
+			fmt.Sprintf("apiVersion %q is not supported, must be one of %s", change.APIVersion, describeAPIVersions()))
+	}
+
+	// Validate metadata
+	if change.Metadata != nil {
+		fields := []struct {
+			name  string
+			value string
+		}{
+			{"name", change.Metadata.Name},
+			{"namespace", change.Metadata.Namespace},
+		}
+		for _, field := range fields {
+			if !metadataNamePattern.MatchString(field.value) {
+				add("metadata."+field.name, "invalid_metadata",
+					fmt.Sprintf("metadata.%s %q must be a lowercase DNS label of at most 63 characters", field.name, field.value))
+			}
+		}
+	}
+
+	// Validate spec fields
+	if change.Spec.Prompt == "" {
+		add("spec.prompt", "missing_prompt", "spec.prompt is required")
+	} else if promptLength := utf8.RuneCountInString(change.Spec.Prompt); promptLength > config.MaxPromptLength {
+		add("spec.prompt", "prompt_too_long",
+			fmt.Sprintf("spec.prompt is %d characters long, maximum allowed is %d", promptLength, config.MaxPromptLength))
+	}
+
+	if len(change.Spec.Repos) == 0 {
+		add("spec.repos", "missing_repos", "spec.repos must contain at least one repository")
+	} else if len(change.Spec.Repos) > config.MaxRepos {
+		add("spec.repos", "too_many_repos",
+			fmt.Sprintf("spec.repos has %d repositories, maximum allowed is %d", len(change.Spec.Repos), config.MaxRepos))
+	}
+
+	// Validate each repository URL
+	seenRepos := make(map[string]int, len(change.Spec.Repos))
+	for i, repo := range change.Spec.Repos {
+		field := fmt.Sprintf("spec.repos[%d]", i)
+		if repo.Branch != "" {
+			if err := validateBranchName(repo.Branch); err != nil {
+				add(field+".branch", "invalid_branch",
+					fmt.Sprintf("%s.branch %q is not a valid branch name: %v", field, repo.Branch, err))
+			}
+		}
+		if err := validateRepoURL(repo.URL); err != nil {
+			add(field, "invalid_repo", fmt.Sprintf("%s %q is not a valid repository URL: %v", field, repo.URL, err))
+			continue
+		}
+		normalized := normalizeRepoURL(repo.URL)
+		if first, ok := seenRepos[normalized]; ok {
+			add(field, "duplicate_repo", fmt.Sprintf("%s %q duplicates spec.repos[%d]", field, repo.URL, first))
+			continue
+		}
+		seenRepos[normalized] = i
+	}
+
+	// Validate agent value
+	if change.Spec.Agent == "" {
+		add("spec.agent", "missing_agent", "spec.agent is required")
+	} else if !isValidAgent(change.Spec.Agent) {
+		add("spec.agent", "invalid_agent", "spec.agent must be one of "+describeAgents())
+	} else if !isAgentEnabled(change.Spec.Agent) {
+		add("spec.agent", "agent_disabled", fmt.Sprintf("spec.agent %q is disabled", change.Spec.Agent))
+	} else {
+		errs = append(errs, validateOptions(change.Spec.Agent, change.Spec.Options)...)
+	}
+
+	// Validate output size cap
+	if change.Spec.MaxOutputSizeKB < 0 || change.Spec.MaxOutputSizeKB > maxOutputSizeKBLimit {
+		add("spec.maxOutputSizeKB", "invalid_max_output_size",
+			fmt.Sprintf("spec.maxOutputSizeKB must be between 1 and %d, or 0 for no cap", maxOutputSizeKBLimit))
+	}
+
+	// Validate token budget
+	if change.Spec.MaxTokens < 0 || change.Spec.MaxTokens > maxTokensLimit {
+		add("spec.maxTokens", "invalid_max_tokens",
+			fmt.Sprintf("spec.maxTokens must be between 1 and %d, or 0 for the agent's default", maxTokensLimit))
+	}
+
+	// Validate priority
+	if change.Spec.Priority < minPriority || change.Spec.Priority > maxPriority {
+		add("spec.priority", "invalid_priority",
+			fmt.Sprintf("spec.priority must be between %d and %d", minPriority, maxPriority))
+	}
+
+	// Validate execution timeout
+	if change.Spec.TimeoutSeconds < 1 || change.Spec.TimeoutSeconds > maxTimeoutSeconds {
+		add("spec.timeoutSeconds", "invalid_timeout",
+			fmt.Sprintf("spec.timeoutSeconds must be between 1 and %d", maxTimeoutSeconds))
+	}
+
+	addResponse("spec.execution", validateExecution(change.Spec.Execution))
+
+	// Validate impact scope
+	if change.Spec.ImpactScope != nil && change.Spec.ImpactScope.MaxDownstreamServices < 0 {
+		add("spec.impactScope.maxDownstreamServices", "invalid_impact_scope",
+			"spec.impactScope.maxDownstreamServices must not be negative")
+	}
+
+	// Validate the nested spec sections
+	addResponse("spec.observabilityIntegration", validateObservabilityIntegration(change.Spec.ObservabilityIntegration))
+	addResponse("spec.linkedIssue", validateLinkedIssue(change.Spec.LinkedIssue))
+	addResponse("spec.signCommits", validateCommitSigning(change.Spec.SignCommits))
+	addResponse("spec.progressWebhook", validateProgressWebhook(change.Spec.ProgressWebhook))
+	addResponse("spec.lockFiles", validateLockFiles(change.Spec.LockFiles))
+	addResponse("spec.webhookURL", validateWebhookURL(change.Spec.WebhookURL))
+	addResponse("spec.runAt", validateRunAt(change.Spec.RunAt))
+	addResponse("spec.labels", validateLabels(change.Spec.Labels))
+
+	// Validate category
+	if !categories.Contains(change.Spec.Category) {
+		add("spec.changeCategory", "unknown_category",
+			fmt.Sprintf("spec.changeCategory %q is not a registered category; see GET /categories", change.Spec.Category))
+	}
+
+	// Validate branch name
+	if err := validateBranchName(change.Spec.Branch); err != nil {
+		add("spec.branch", "invalid_branch",
+			fmt.Sprintf("spec.branch %q is not a valid branch name: %v", change.Spec.Branch, err))
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ErrorResponse{
+		Error:   errs[0].Code,
+		Message: errs[0].Message,
+		Errors:  errs,
+	}
+}
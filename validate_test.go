@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validTestChange returns a change that passes validateChange
+func validTestChange() Change {
+	return Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt:         "Add comprehensive error handling to all HTTP handlers",
+			Repos:          repoRefs("https://github.com/myorg/repo1"),
+			Agent:          "copilot-cli",
+			Branch:         "main",
+			Category:       defaultCategory,
+			Priority:       defaultPriority,
+			TimeoutSeconds: defaultTimeoutSeconds,
+			Execution:      executionParallel,
+		},
+	}
+}
+
+func TestValidateChange(t *testing.T) {
+	tooManyRepos := make([]RepoRef, config.MaxRepos+1)
+	for i := range tooManyRepos {
+		tooManyRepos[i] = RepoRef{URL: "https://github.com/myorg/repo" + strings.Repeat("x", i+1)}
+	}
+
+	tests := []struct {
+		name      string
+		mutate    func(c *Change)
+		wantError string
+	}{
+		{"valid", func(c *Change) {}, ""},
+		{"valid with metadata", func(c *Change) { c.Metadata = &ObjectMeta{Name: "add-retries", Namespace: "team-a"} }, ""},
+		{"invalid kind", func(c *Change) { c.Kind = "Other" }, "invalid_kind"},
+		{"missing api version", func(c *Change) { c.APIVersion = "" }, "missing_api_version"},
+		{"unsupported api version", func(c *Change) { c.APIVersion = "v9" }, "unsupported_api_version"},
+		{"invalid metadata name", func(c *Change) { c.Metadata = &ObjectMeta{Name: "Not_Valid", Namespace: "default"} }, "invalid_metadata"},
+		{"invalid metadata namespace", func(c *Change) { c.Metadata = &ObjectMeta{Name: "ok", Namespace: "-bad"} }, "invalid_metadata"},
+		{"missing prompt", func(c *Change) { c.Spec.Prompt = "" }, "missing_prompt"},
+		{"prompt too long", func(c *Change) { c.Spec.Prompt = strings.Repeat("x", config.MaxPromptLength+1) }, "prompt_too_long"},
+		{"missing repos", func(c *Change) { c.Spec.Repos = nil }, "missing_repos"},
+		{"max repos", func(c *Change) { c.Spec.Repos = tooManyRepos[:config.MaxRepos] }, ""},
+		{"too many repos", func(c *Change) { c.Spec.Repos = tooManyRepos }, "too_many_repos"},
+		{"invalid repo", func(c *Change) { c.Spec.Repos = repoRefs("not a url") }, "invalid_repo"},
+		{"duplicate repo", func(c *Change) { c.Spec.Repos = append(c.Spec.Repos, c.Spec.Repos[0]) }, "duplicate_repo"},
+		{"duplicate repo with .git", func(c *Change) {
+			c.Spec.Repos = repoRefs("https://github.com/myorg/repo", "https://github.com/myorg/repo.git")
+		}, "duplicate_repo"},
+		{"duplicate repo with trailing slash", func(c *Change) {
+			c.Spec.Repos = repoRefs("https://github.com/myorg/repo.git", "https://github.com/myorg/repo/")
+		}, "duplicate_repo"},
+		{"distinct repos", func(c *Change) {
+			c.Spec.Repos = repoRefs("https://github.com/myorg/repo", "https://github.com/myorg/repo-git")
+		}, ""},
+		{"duplicate repo with host case", func(c *Change) {
+			c.Spec.Repos = repoRefs("https://github.com/myorg/repo", "https://GitHub.com/myorg/repo/")
+		}, "duplicate_repo"},
+		{"repo branch override", func(c *Change) { c.Spec.Repos[0].Branch = "release/1.2" }, ""},
+		{"invalid repo branch", func(c *Change) { c.Spec.Repos[0].Branch = "feature..x" }, "invalid_branch"},
+		{"missing agent", func(c *Change) { c.Spec.Agent = "" }, "missing_agent"},
+		{"invalid agent", func(c *Change) { c.Spec.Agent = "unknown-agent" }, "invalid_agent"},
+		{"negative output size", func(c *Change) { c.Spec.MaxOutputSizeKB = -1 }, "invalid_max_output_size"},
+		{"output size over limit", func(c *Change) { c.Spec.MaxOutputSizeKB = maxOutputSizeKBLimit + 1 }, "invalid_max_output_size"},
+		{"negative max tokens", func(c *Change) { c.Spec.MaxTokens = -1 }, "invalid_max_tokens"},
+		{"max tokens over limit", func(c *Change) { c.Spec.MaxTokens = maxTokensLimit + 1 }, "invalid_max_tokens"},
+		{"invalid impact scope", func(c *Change) { c.Spec.ImpactScope = &ImpactScopeConfig{MaxDownstreamServices: -1} }, "invalid_impact_scope"},
+		{"invalid observability", func(c *Change) { c.Spec.ObservabilityIntegration = &OIConfig{Type: "nagios"} }, "unsupported_observability_type"},
+		{"invalid linked issue", func(c *Change) {
+			c.Spec.LinkedIssue = &LinkedIssueConfig{URL: "https://github.com/myorg/repo1/issues/1", Action: "mentions"}
+		}, "invalid_issue_action"},
+		{"invalid signing", func(c *Change) { c.Spec.SignCommits = &CommitSigningConfig{Method: "pgp"} }, "invalid_signing_method"},
+		{"invalid progress webhook", func(c *Change) { c.Spec.ProgressWebhook = &ProgressWebhookConfig{URL: "http://example.com/hook"} }, "invalid_progress_webhook"},
+		{"priority too low", func(c *Change) { c.Spec.Priority = -1 }, "invalid_priority"},
+		{"priority too high", func(c *Change) { c.Spec.Priority = maxPriority + 1 }, "invalid_priority"},
+		{"negative timeout", func(c *Change) { c.Spec.TimeoutSeconds = -1 }, "invalid_timeout"},
+		{"timeout over limit", func(c *Change) { c.Spec.TimeoutSeconds = maxTimeoutSeconds + 1 }, "invalid_timeout"},
+		{"max timeout", func(c *Change) { c.Spec.TimeoutSeconds = maxTimeoutSeconds }, ""},
+		{"sequential execution", func(c *Change) { c.Spec.Execution = executionSequential; c.Spec.FailFast = true }, ""},
+		{"unknown execution", func(c *Change) { c.Spec.Execution = "batched" }, "invalid_execution"},
+		{"valid labels", func(c *Change) { c.Spec.Labels = map[string]string{"team": "payments", "ticket": "PAY-123"} }, ""},
+		{"too many labels", func(c *Change) {
+			c.Spec.Labels = make(map[string]string)
+			for i := 0; i <= maxLabels; i++ {
+				c.Spec.Labels[fmt.Sprintf("key%d", i)] = "value"
+			}
+		}, "invalid_labels"},
+		{"invalid label key", func(c *Change) { c.Spec.Labels = map[string]string{"-team": "payments"} }, "invalid_labels"},
+		{"label key too long", func(c *Change) { c.Spec.Labels = map[string]string{strings.Repeat("k", maxLabelKeyLength+1): "v"} }, "invalid_labels"},
+		{"label value too long", func(c *Change) { c.Spec.Labels = map[string]string{"team": strings.Repeat("v", maxLabelValueLength+1)} }, "invalid_labels"},
+		{"invalid webhook url", func(c *Change) { c.Spec.WebhookURL = "http://hooks.example.com/done" }, "invalid_webhook_url"},
+		{"run at in the past", func(c *Change) { runAt := time.Now().Add(-time.Hour); c.Spec.RunAt = &runAt }, ""},
+		{"run at too far ahead", func(c *Change) { runAt := time.Now().Add(31 * 24 * time.Hour); c.Spec.RunAt = &runAt }, "invalid_run_at"},
+		{"invalid lock files", func(c *Change) { c.Spec.LockFiles = []string{"../outside"} }, "invalid_lock_files"},
+		{"unknown category", func(c *Change) { c.Spec.Category = "not-registered" }, "unknown_category"},
+		{"invalid branch", func(c *Change) { c.Spec.Branch = "feature..x" }, "invalid_branch"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			change := validTestChange()
+			tt.mutate(&change)
+
+			errResp := validateChange(change)
+			if tt.wantError == "" {
+				if errResp != nil {
+					t.Fatalf("Expected change to be valid, got %s: %s", errResp.Error, errResp.Message)
+				}
+				return
+			}
+			if errResp == nil {
+				t.Fatalf("Expected error '%s', got nil", tt.wantError)
+			}
+			if errResp.Error != tt.wantError {
+				t.Errorf("Expected error '%s', got '%s'", tt.wantError, errResp.Error)
+			}
+			if errResp.Message == "" {
+				t.Error("Expected a message")
+			}
+			if len(errResp.Errors) != 1 || errResp.Errors[0].Code != tt.wantError {
+				t.Errorf("Expected a single '%s' field error, got %+v", tt.wantError, errResp.Errors)
+			}
+		})
+	}
+}
+
+func TestValidateChangeCollectsAllErrors(t *testing.T) {
+	change := validTestChange()
+	change.Kind = ""
+	change.Spec.Prompt = ""
+	change.Spec.Repos = repoRefs("https://github.com/myorg/repo1", "not a url", "https://github.com/myorg/repo1")
+	change.Spec.Agent = ""
+	change.Spec.MaxTokens = -1
+
+	errResp := validateChange(change)
+	if errResp == nil {
+		t.Fatal("Expected errors, got nil")
+	}
+
+	want := []FieldError{
+		{Field: "kind", Code: "invalid_kind"},
+		{Field: "spec.prompt", Code: "missing_prompt"},
+		{Field: "spec.repos[1]", Code: "invalid_repo"},
+		{Field: "spec.repos[2]", Code: "duplicate_repo"},
+		{Field: "spec.agent", Code: "missing_agent"},
+		{Field: "spec.maxTokens", Code: "invalid_max_tokens"},
+	}
+	if len(errResp.Errors) != len(want) {
+		t.Fatalf("Expected %d errors, got %d: %+v", len(want), len(errResp.Errors), errResp.Errors)
+	}
+	for i, got := range errResp.Errors {
+		if got.Field != want[i].Field || got.Code != want[i].Code {
+			t.Errorf("Error %d: expected %s on %s, got %s on %s", i, want[i].Code, want[i].Field, got.Code, got.Field)
+		}
+	}
+	if errResp.Error != "invalid_kind" {
+		t.Errorf("Expected top-level error 'invalid_kind', got '%s'", errResp.Error)
+	}
+}
+
+func TestApplyChangeDefaults(t *testing.T) {
+	change := Change{Metadata: &ObjectMeta{Name: "add-retries"}}
+	applyChangeDefaults(&change)
+
+	if change.Metadata.Namespace != config.DefaultNamespace {
+		t.Errorf("Expected namespace '%s', got '%s'", config.DefaultNamespace, change.Metadata.Namespace)
+	}
+	if change.Spec.Category != defaultCategory {
+		t.Errorf("Expected category '%s', got '%s'", defaultCategory, change.Spec.Category)
+	}
+	if change.Spec.Branch != config.DefaultBranch {
+		t.Errorf("Expected branch '%s', got '%s'", config.DefaultBranch, change.Spec.Branch)
+	}
+	if change.Spec.Priority != defaultPriority {
+		t.Errorf("Expected priority %d, got %d", defaultPriority, change.Spec.Priority)
+	}
+	if change.Spec.Execution != executionParallel {
+		t.Errorf("Expected execution '%s', got '%s'", executionParallel, change.Spec.Execution)
+	}
+	if change.Spec.TimeoutSeconds != defaultTimeoutSeconds {
+		t.Errorf("Expected timeoutSeconds %d, got %d", defaultTimeoutSeconds, change.Spec.TimeoutSeconds)
+	}
+
+	change = Change{Spec: ChangeSpec{Branch: "develop"}}
+	applyChangeDefaults(&change)
+	if change.Metadata != nil {
+		t.Error("Expected metadata to stay unset")
+	}
+	if change.Spec.Branch != "develop" {
+		t.Errorf("Expected branch 'develop' to be kept, got '%s'", change.Spec.Branch)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Build metadata, set at build time by make build, or by hand with
+//
+//	go build -ldflags "-X main.Version=1.2.3 -X main.Commit=$(git rev-parse HEAD) -X main.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version   = "dev"
+	Commit    = "none"
+	BuildTime = "unknown"
+)
+
+// handleVersion handles requests for the build metadata of the running binary
+func handleVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":   Version,
+		"commit":    Commit,
+		"buildTime": BuildTime,
+		"goVersion": runtime.Version(),
+	})
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestVersionEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/version", handleVersion)
+
+	req, _ := http.NewRequest("GET", "/version", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+
+	var response map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	for _, key := range []string{"version", "commit", "buildTime", "goVersion"} {
+		if _, ok := response[key]; !ok {
+			t.Errorf("Expected key '%s' in response %v", key, response)
+		}
+	}
+
+	// Without ldflags the placeholders are reported
+	if response["version"] != "dev" || response["commit"] != "none" || response["buildTime"] != "unknown" {
+		t.Errorf("Expected dev/none/unknown, got %v", response)
+	}
+	if response["goVersion"] != runtime.Version() {
+		t.Errorf("Expected goVersion %q, got %q", runtime.Version(), response["goVersion"])
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// waitContextKey is the gin.Context key set when a submission asked, with
+// ?wait=true, to hold the request open until the change finishes
+const waitContextKey = "wait"
+
+// waitRequested reports whether the request asks, with ?wait=true, to be held
+// open until its change finishes. Invalid values are reported by the handler.
+func waitRequested(c *gin.Context) bool {
+	wait, err := strconv.ParseBool(c.Query("wait"))
+	return err == nil && wait
+}
+
+// waitPollInterval is how often a waiting submission checks whether its
+// change has finished. Tests shorten it.
+var waitPollInterval = 100 * time.Millisecond
+
+// waitForJob blocks until the job with the given ID reaches a terminal state
+// and returns it, or returns ctx's error if ctx ends first. When the client
+// disconnected, cancelling ctx, the change is cancelled too, since nobody
+// is waiting for its outcome any more. A request deadline leaves the change
+// running so it can still be followed through GET /change/:id.
+func waitForJob(ctx context.Context, id string) (Job, error) {
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+
+	for {
+		job, err := store.Get(id)
+		if err != nil {
+			return Job{}, err
+		}
+		if isTerminal(job.Status) && (job.Status != statusCancelled || job.FinishedAt != nil) {
+			return job, nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.Canceled) {
+				contextLogger(ctx).Info("Client disconnected, cancelling change", "id", id)
+				if _, _, err := cancelJob(id, "client disconnected"); err != nil {
+					contextLogger(ctx).Error("Failed to cancel change", "id", id, "error", err)
+				}
+			}
+			return Job{}, ctx.Err()
+		}
+	}
+}
+
+// respondWhenFinished waits for job to finish and responds with its final
+// state, as GET /change/:id reports it. The wait lasts as long as the change
+// may run, plus config.RequestTimeout for it to reach a worker, after which
+// the client gets a 503 and the change keeps running. Nothing is written
+// when the client disconnects first.
+func respondWhenFinished(c *gin.Context, job Job) {
+	limit := time.Duration(timeoutSeconds(job.Change.Spec))*timeoutUnit + config.RequestTimeout
+	ctx, cancel := context.WithTimeout(c.Request.Context(), limit)
+	defer cancel()
+
+	finished, err := waitForJob(ctx, job.ID)
+	if err != nil && c.Request.Context().Err() != nil {
+		requestLogger(c).Warn("Stopped waiting for change", "id", job.ID, "error", err)
+		return
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		requestLogger(c).Warn("Change did not finish while waiting", "id", job.ID, "limit", limit.String())
+		respondError(c, http.StatusServiceUnavailable, ErrorResponse{
+			Error:   "request_timeout",
+			Message: fmt.Sprintf("change %s did not finish within %s, follow it with GET /change/%s", job.ID, limit, job.ID),
+		})
+		return
+	}
+	if err != nil {
+		respondJobError(c, job.ID, err)
+		return
+	}
+	c.JSON(http.StatusOK, finished)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startTestWorkers runs a worker for the duration of a test, polling waiting
+// submissions quickly
+func startTestWorkers(t *testing.T) {
+	t.Helper()
+
+	previous := waitPollInterval
+	waitPollInterval = 5 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	workers := startWorkers(ctx, 1)
+	t.Cleanup(func() {
+		cancel()
+		workers.Wait()
+		waitPollInterval = previous
+	})
+}
+
+// waitTestBody is a change body for the wait tests
+const waitTestBody = `{"kind": "Change", "apiVersion": "v1", "spec": {"prompt": "Add retries", "repos": ["https://github.com/myorg/repo1"], "agent": "copilot-cli"}}`
+
+func TestChangeEndpointWait(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	startTestWorkers(t)
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		return ChangeResult{Diff: "+retry"}, nil
+	})
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	req, _ := http.NewRequest("POST", "/change?wait=true", strings.NewReader(waitTestBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var job Job
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if job.Status != statusDone || job.Result == nil || job.Result.Diff != "+retry" {
+		t.Errorf("Expected the finished change, got '%s' %+v", job.Status, job.Result)
+	}
+
+	req, _ = http.NewRequest("POST", "/change?wait=soon", strings.NewReader(waitTestBody))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_wait") {
+		t.Errorf("Expected 400 invalid_wait, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestChangeEndpointWaitClientDisconnect(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	startTestWorkers(t)
+	started := make(chan string, 1)
+	stopped := make(chan struct{})
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		started <- req.JobID
+		<-ctx.Done()
+		close(stopped)
+		return ChangeResult{}, ctx.Err()
+	})
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	ctx, disconnect := context.WithCancel(context.Background())
+	defer disconnect()
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/change?wait=true", strings.NewReader(waitTestBody))
+	req.Header.Set("Content-Type", "application/json")
+	served := make(chan struct{})
+	go func() {
+		router.ServeHTTP(httptest.NewRecorder(), req)
+		close(served)
+	}()
+
+	var id string
+	select {
+	case id = <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for the change to start")
+	}
+	disconnect()
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected the agent to be stopped when the client disconnected")
+	}
+	<-served
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got, _ := store.Get(id)
+		if got.Status == statusCancelled && got.FinishedAt != nil {
+			if got.Reason != "client disconnected" {
+				t.Errorf("Expected the disconnect to be recorded, got reason %q", got.Reason)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the change to be cancelled, got '%s'", got.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestChangeEndpointWaitOutlastsRequestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	startTestWorkers(t)
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		time.Sleep(100 * time.Millisecond)
+		return ChangeResult{Diff: "+retry"}, nil
+	})
+	router := gin.New()
+	router.Use(ginTimeout(20 * time.Millisecond))
+	router.POST("/change", handleChange)
+
+	req, _ := http.NewRequest("POST", "/change?wait=true", strings.NewReader(waitTestBody))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"status":"done"`) {
+		t.Errorf("Expected the finished change despite REQUEST_TIMEOUT, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestChangeEndpointWaitBoundedByChangeTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+	cfg := config
+	cfg.RequestTimeout = 0
+	setConfig(t, cfg)
+	previous := timeoutUnit
+	timeoutUnit = time.Millisecond
+	t.Cleanup(func() { timeoutUnit = previous })
+	router := gin.New()
+	router.POST("/change", handleChange)
+
+	// No workers run, so the change never finishes
+	body := strings.Replace(waitTestBody, `"agent": "copilot-cli"`, `"agent": "copilot-cli", "timeoutSeconds": 20`, 1)
+	req, _ := http.NewRequest("POST", "/change?wait=true", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "request_timeout") {
+		t.Errorf("Expected 503 request_timeout once the change's timeout passed, got %d: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,535 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+)
+
+// ChangeRequest is the input an agent runner receives for one attempt at a
+// change
+type ChangeRequest struct {
+	JobID string
+	Spec  ChangeSpec
+	// Workspace is the directory the agent works in. It is kept across
+	// attempts when spec.persistWorkspace is set.
+	Workspace string
+	Attempt   int
+	// MaxTokens is the token budget passed to the agent; 0 means the
+	// agent's default
+	MaxTokens int
+	// LinkedIssue is the line, such as "Closes #123", the agent adds to the
+	// PR description for spec.linkedIssue; empty when it is unset
+	LinkedIssue string
+}
+
+// Bounds and default for spec.timeoutSeconds
+const (
+	maxTimeoutSeconds     = 3600
+	defaultTimeoutSeconds = 300
+)
+
+// timeoutUnit is the length of one second of spec.timeoutSeconds. Tests
+// shorten it.
+var timeoutUnit = time.Second
+
+// timeoutSeconds returns how many seconds the agent may run for spec. Jobs
+// stored before spec.timeoutSeconds existed have it unset and get the
+// default.
+func timeoutSeconds(spec ChangeSpec) int {
+	if spec.TimeoutSeconds <= 0 {
+		return defaultTimeoutSeconds
+	}
+	return spec.TimeoutSeconds
+}
+
+// agentRunner executes a change with a specific agent, returning the
+// artifacts it produced
+type agentRunner func(ctx context.Context, req ChangeRequest) (ChangeResult, error)
+
+// agentRunners maps agent names to the runners that execute them. Agents
+// allowed via VALID_AGENTS that have no runner of their own are dispatched
+// with dispatchToAgent.
+var agentRunners = map[string]agentRunner{
+	"claude-cli":  dispatchToAgent,
+	"copilot-cli": dispatchToAgent,
+	"gemini-cli":  dispatchToAgent,
+}
+
+// defaultAgents returns the agents with a registered runner in sorted order,
+// used when VALID_AGENTS is unset
+func defaultAgents() []string {
+	names := make([]string, 0, len(agentRunners))
+	for name := range agentRunners {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isValidAgent reports whether agent is registered in agentRegistry,
+// whether or not it is enabled
+func isValidAgent(agent string) bool {
+	_, ok := agentRegistry.Config(agent)
+	return ok
+}
+
+// describeAgents lists the agents in agentRegistry for error messages, e.g.
+// "'a', 'b' or 'c'"
+func describeAgents() string {
+	names := agentRegistry.Names()
+	for i, name := range names {
+		names[i] = "'" + name + "'"
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// dispatchToAgent is the default agentRunner. Agent execution is not wired
+// up yet, so it only logs the dispatch and reports an empty result.
+func dispatchToAgent(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+	logger.Info("Dispatching change to agent",
+		"id", req.JobID,
+		"agent", req.Spec.Agent,
+		"repos", req.Spec.repoBranches(),
+		"workspace", req.Workspace,
+		"attempt", req.Attempt,
+		"maxTokens", req.MaxTokens,
+		"linkedIssue", req.LinkedIssue,
+	)
+
+	return ChangeResult{IssueLinked: req.LinkedIssue != ""}, nil
+}
+
+// runningJobs holds the cancel functions of jobs currently being executed
+var runningJobs = struct {
+	sync.Mutex
+	cancels map[string]context.CancelFunc
+}{cancels: make(map[string]context.CancelFunc)}
+
+// cancelRunningJob signals the worker executing the job with the given ID to
+// stop, returning false if the job isn't running
+func cancelRunningJob(id string) bool {
+	runningJobs.Lock()
+	defer runningJobs.Unlock()
+
+	cancel, ok := runningJobs.cancels[id]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// cancelJob cancels the job with the given ID unless it has already finished,
+// stopping its worker if it is running. reason, if given, is recorded on the
+// job. It reports whether the job was cancelled along with its updated state.
+func cancelJob(id, reason string) (Job, bool, error) {
+	var job Job
+	cancelled := false
+	cancelledAt := time.Now().UTC()
+	err := store.Update(id, func(j *Job) {
+		if !isTerminal(j.Status) {
+			// Jobs that never started finish as soon as they're cancelled;
+			// running jobs finish once their worker stops
+			if j.Status != statusRunning {
+				j.FinishedAt = &cancelledAt
+			}
+			j.Status = statusCancelled
+			j.CancelledAt = &cancelledAt
+			j.Reason = reason
+			cancelled = true
+		}
+		job = *j
+	})
+	if err != nil || !cancelled {
+		return job, false, err
+	}
+
+	// Running jobs are reported once their worker has stopped
+	if job.FinishedAt != nil {
+		notifyCompletion(job)
+	}
+
+	if cancelRunningJob(id) {
+		logger.Info("Stopping running change", "id", id)
+	}
+	return job, true, nil
+}
+
+// cancelQueuedJobs cancels every job that is queued or waiting on file locks
+// but hasn't started, recording reason, and returns how many were cancelled
+func cancelQueuedJobs(reason string) int {
+	n := 0
+	for _, id := range append(queue.drain(), fileLocks.takeWaiters()...) {
+		_, cancelled, err := cancelJob(id, reason)
+		if err != nil {
+			logger.Error("Failed to cancel queued change", "id", id, "error", err)
+			continue
+		}
+		if cancelled {
+			n++
+		}
+	}
+	return n
+}
+
+// maxWorkerPoolSize is the largest WORKER_POOL_SIZE the server starts with
+const maxWorkerPoolSize = 32
+
+// validateWorkerPoolSize checks WORKER_POOL_SIZE, returning nil when it is
+// between 1 and maxWorkerPoolSize
+func validateWorkerPoolSize(n int) error {
+	if n < 1 || n > maxWorkerPoolSize {
+		return fmt.Errorf("worker pool size must be between 1 and %d, got %d", maxWorkerPoolSize, n)
+	}
+	return nil
+}
+
+// workerPool counts the running workers and how many of them are processing
+// a change, for the workers_active and workers_idle metrics
+var workerPool struct {
+	running atomic.Int64
+	active  atomic.Int64
+}
+
+// activeWorkers returns how many workers are processing a change
+func activeWorkers() int {
+	return int(workerPool.active.Load())
+}
+
+// idleWorkers returns how many workers are waiting for a change
+func idleWorkers() int {
+	return int(workerPool.running.Load() - workerPool.active.Load())
+}
+
+// startWorkers launches a fixed pool of n workers that process queued jobs
+// until ctx is done. The returned WaitGroup completes once every worker has
+// exited.
+func startWorkers(ctx context.Context, n int) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		workerPool.running.Add(1)
+		go func() {
+			defer wg.Done()
+			defer workerPool.running.Add(-1)
+			runWorker(ctx)
+		}()
+	}
+	return &wg
+}
+
+// runWorker processes jobs from the queue until ctx is done
+func runWorker(ctx context.Context) {
+	for {
+		id, ok := queue.pop(ctx)
+		if !ok {
+			return
+		}
+		workerPool.active.Add(1)
+		processJob(ctx, id)
+		workerPool.active.Add(-1)
+	}
+}
+
+// processJob runs the job with the given ID through its agent and records
+// the outcome
+func processJob(ctx context.Context, id string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Register the cancel function before the job is marked running so a
+	// cancellation request can always reach it
+	runningJobs.Lock()
+	runningJobs.cancels[id] = cancel
+	runningJobs.Unlock()
+	defer func() {
+		runningJobs.Lock()
+		delete(runningJobs.cancels, id)
+		runningJobs.Unlock()
+	}()
+
+	// Jobs cancelled while queued are skipped, jobs that require approval
+	// are parked until they are approved, and jobs whose lock files are held
+	// by another change wait until those locks are released
+	var job Job
+	started, locked, parked := false, false, false
+	startedAt := time.Now().UTC()
+	err := store.Update(id, func(j *Job) {
+		if j.Status != statusPending && j.Status != statusAwaitingLock {
+			return
+		}
+		if j.Change.Spec.RequireApproval && j.ApprovedAt == nil {
+			j.Status = statusPendingApproval
+			parked = true
+			return
+		}
+		if len(j.Change.Spec.LockFiles) > 0 {
+			if !fileLocks.Acquire(j.Change.Spec.LockFiles, id) {
+				j.Status = statusAwaitingLock
+				return
+			}
+			locked = true
+		}
+		j.Status = statusRunning
+		j.StartedAt = &startedAt
+		job = *j
+		started = true
+	})
+	if locked {
+		defer releaseLocks(id)
+	}
+	if errors.Is(err, ErrJobNotFound) {
+		logger.Info("Skipping deleted change", "id", id)
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to start change", "id", id, "error", err)
+		return
+	}
+	if parked {
+		logger.Info("Change awaiting approval", "id", id)
+		return
+	}
+	if !started {
+		return
+	}
+	logger.Info("Change started", "id", id, "agent", job.Change.Spec.Agent)
+
+	ctx, span := tracer().Start(extractTraceContext(ctx, job.TraceContext), "processJob", jobSpanAttributes(job))
+	defer span.End()
+
+	stopProgress := func() {}
+	if cfg := job.Change.Spec.ProgressWebhook; cfg != nil {
+		stopProgress = startProgressWebhook(ctx, id, *cfg)
+	}
+
+	var result ChangeResult
+	var repoResults []RepoResult
+	agent := job.Change.Spec.Agent
+	agentConfig, _ := agentRegistry.Config(agent)
+	if !isAgentEnabled(agent) {
+		// Changes queued before the agent was disabled don't run either
+		logger.Warn("Agent disabled, failing change", "id", id, "agent", agent)
+		err = &codedError{Code: "agent_disabled", Message: fmt.Sprintf("agent %q is disabled", agent)}
+	} else if breaker := agentBreakers.get(agent); !breaker.allow() {
+		logger.Warn("Agent circuit open, failing change", "id", id, "agent", agent)
+		err = &codedError{
+			Code:    "agent_circuit_open",
+			Message: fmt.Sprintf("agent %q failed repeatedly and is not accepting changes until %s", agent, breaker.retryAt().UTC().Format(time.RFC3339)),
+		}
+	} else {
+		timeout := timeoutSeconds(job.Change.Spec)
+		if limit := int(agentConfig.Timeout / time.Second); limit > 0 && limit < timeout {
+			timeout = limit
+		}
+		runCtx, cancelRun := context.WithTimeout(ctx, time.Duration(timeout)*timeoutUnit)
+		// The timeout covers waiting for one of the agent's MaxConcurrency
+		// slots as well as running
+		var releaseSlot func()
+		if releaseSlot, err = agentRegistry.acquire(runCtx, agent); err == nil {
+			result, repoResults, err = runRepos(runCtx, job)
+			releaseSlot()
+		}
+		// A deadline on runCtx alone means the change ran out of time, rather
+		// than being cancelled or shut down
+		if err != nil && errors.Is(runCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			logger.Warn("Change timed out", "id", id, "timeoutSeconds", timeout)
+			err = &codedError{Code: "timeout", Message: fmt.Sprintf("change did not finish within %d seconds", timeout)}
+		}
+		cancelRun()
+		// Cancelled and shut down changes say nothing about the agent
+		if ctx.Err() != nil {
+			breaker.release()
+		} else {
+			breaker.record(err)
+		}
+	}
+	if err == nil {
+		err = checkResult(job.Change.Spec, &result)
+	}
+	stopProgress()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, errorCode(err))
+	}
+
+	finishedAt := time.Now().UTC()
+	cancelled := false
+	var finished Job
+	updateErr := store.Update(id, func(job *Job) {
+		job.Result = &result
+		job.RepoResults = repoResults
+		job.FinishedAt = &finishedAt
+		switch {
+		case job.Status == statusCancelled:
+			cancelled = true
+		case err != nil:
+			job.Status = statusFailed
+			job.Error, job.Message = errorCode(err), err.Error()
+		default:
+			job.Status = statusDone
+		}
+		finished = *job
+	})
+
+	if errors.Is(updateErr, ErrJobNotFound) {
+		logger.Info("Change deleted while running", "id", id)
+		return
+	}
+	if updateErr != nil {
+		logger.Error("Failed to record change outcome", "id", id, "error", updateErr)
+		return
+	}
+	notifyCompletion(finished)
+	if cancelled {
+		logger.Info("Change cancelled while running", "id", id)
+		return
+	}
+	if err != nil {
+		logger.Warn("Change failed", "id", id, "error", errorCode(err), "message", err.Error())
+		return
+	}
+	resultCache.Set(job.ContentHash, result, config.ResultCacheTTL)
+	logger.Info("Change completed", "id", id, "outputSizeKB", result.OutputSizeKB)
+}
+
+// releaseLocks frees the file locks held by the change id and requeues the
+// changes that were waiting on locks so they can try again
+func releaseLocks(id string) {
+	fileLocks.Release(id)
+	for _, waiter := range fileLocks.takeWaiters() {
+		// A waiter that can't be looked up is requeued at the default
+		// priority; processJob skips it if it has been deleted
+		job, err := store.Get(waiter)
+		if err != nil {
+			job = Job{ID: waiter}
+		}
+		enqueue(job)
+	}
+}
+
+// runAttempts runs job through its agent, retrying failed runs up to
+// config.AgentMaxAttempts times. Each attempt gets a fresh workspace, named
+// after workspace and the attempt, unless the spec asks for it to be
+// persisted, in which case the workspace named workspace is kept until the
+// final attempt finishes.
+func runAttempts(ctx context.Context, job Job, workspace string) (ChangeResult, error) {
+	persist := job.Change.Spec.PersistWorkspace
+	if persist {
+		defer freeWorkspace(workspace)
+	}
+
+	linkedIssue := changeLinkedIssue(job.Change.Spec)
+	var result ChangeResult
+	var err error
+	for attempt := 1; attempt <= config.AgentMaxAttempts; attempt++ {
+		workspaceID := workspace
+		if !persist {
+			workspaceID = fmt.Sprintf("%s-%d", workspace, attempt)
+		}
+
+		dir, allocErr := workspaces.Allocate(workspaceID)
+		if allocErr != nil {
+			return ChangeResult{}, &codedError{Code: "workspace_unavailable", Message: allocErr.Error()}
+		}
+		if updateErr := store.Update(job.ID, func(j *Job) { j.WorkspaceID = workspaceID }); updateErr != nil {
+			logger.Warn("Failed to record workspace", "id", job.ID, "error", updateErr)
+		}
+
+		result, err = runAgent(ctx, ChangeRequest{
+			JobID:       job.ID,
+			Spec:        job.Change.Spec,
+			Workspace:   dir,
+			Attempt:     attempt,
+			MaxTokens:   job.Change.Spec.MaxTokens,
+			LinkedIssue: linkedIssue,
+		})
+
+		if !persist {
+			freeWorkspace(workspaceID)
+		}
+
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+		logger.Warn("Agent attempt failed", "id", job.ID, "attempt", attempt, "error", err)
+	}
+
+	return result, err
+}
+
+// freeWorkspace releases the workspace with the given ID, logging failures
+func freeWorkspace(id string) {
+	if err := workspaces.Free(id); err != nil {
+		logger.Warn("Failed to free workspace", "workspace", id, "error", err)
+	}
+}
+
+// recoverJobs requeues jobs that were pending when the server last stopped
+// and fails those that were interrupted while running
+func recoverJobs() error {
+	const pageSize = 100
+
+	for offset := 0; ; offset += pageSize {
+		page, total, err := store.List(offset, pageSize, JobFilter{})
+		if err != nil {
+			return err
+		}
+
+		for _, job := range page {
+			switch job.Status {
+			case statusPending, statusAwaitingLock:
+				enqueue(job)
+				logger.Info("Requeued pending change", "id", job.ID, "status", job.Status)
+			case statusRunning:
+				finishedAt := time.Now().UTC()
+				var failed Job
+				err := store.Update(job.ID, func(j *Job) {
+					j.Status = statusFailed
+					j.FinishedAt = &finishedAt
+					j.Error, j.Message = "interrupted", "server restarted while the change was running"
+					failed = *j
+				})
+				if err != nil {
+					return err
+				}
+				logger.Warn("Failed interrupted change", "id", job.ID)
+				notifyCompletion(failed)
+			}
+		}
+
+		if offset+pageSize >= total {
+			return nil
+		}
+	}
+}
+
+// runAgent executes req with the runner registered for its agent, falling
+// back to dispatchToAgent for agents without one
+func runAgent(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+	runner, ok := agentRunners[req.Spec.Agent]
+	if !ok {
+		runner = dispatchToAgent
+	}
+
+	return runner(ctx, req)
+}
+
+// errorCode returns the machine-readable code for err
+func errorCode(err error) string {
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce.Code
+	}
+	return "agent_failed"
+}
@@ -0,0 +1,636 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// isolateJobs gives the test its own job store, queue, workspaces, result
+// cache and file locks. The store is in memory unless TEST_STORE names
+// another of storeFactories, such as "sqlite", so the whole suite can be run
+// against it.
+func isolateJobs(t *testing.T) {
+	t.Helper()
+
+	newStore, ok := storeFactories[os.Getenv("TEST_STORE")]
+	if !ok {
+		newStore = storeFactories["memory"]
+	}
+
+	previousStore, previousQueue, previousWorkspaces, previousCache, previousLocks, previousBreakers := store, queue, workspaces, resultCache, fileLocks, agentBreakers
+	store, queue, workspaces, resultCache, fileLocks, agentBreakers = newStore(t), newJobQueue(), newDirWorkspaceStore(t.TempDir(), 0), NewResultCache(), NewFileLockManager(), newCircuitBreakers()
+	t.Cleanup(func() {
+		store, queue, workspaces, resultCache, fileLocks, agentBreakers = previousStore, previousQueue, previousWorkspaces, previousCache, previousLocks, previousBreakers
+	})
+}
+
+// slowListStore delays List results so that concurrent requests checking the
+// store before saving overlap
+type slowListStore struct {
+	Store
+}
+
+func (s slowListStore) List(offset, limit int, filter JobFilter) ([]Job, int, error) {
+	jobs, total, err := s.Store.List(offset, limit, filter)
+	time.Sleep(10 * time.Millisecond)
+	return jobs, total, err
+}
+
+// slowListing wraps the test's store in a slowListStore
+func slowListing(t *testing.T) {
+	t.Helper()
+
+	previous := store
+	store = slowListStore{store}
+	t.Cleanup(func() { store = previous })
+}
+
+// setAgentRunner replaces the runner for agent for the duration of a test
+func setAgentRunner(t *testing.T, agent string, runner agentRunner) {
+	t.Helper()
+
+	previous, existed := agentRunners[agent]
+	agentRunners[agent] = runner
+	t.Cleanup(func() {
+		if existed {
+			agentRunners[agent] = previous
+		} else {
+			delete(agentRunners, agent)
+		}
+	})
+}
+
+// submitTestJob stores and enqueues a pending job for spec
+func submitTestJob(t *testing.T, spec ChangeSpec) Job {
+	t.Helper()
+
+	job := newJob(Change{Kind: "Change", APIVersion: "v1", Spec: spec})
+	if err := store.Save(job); err != nil {
+		t.Fatalf("Failed to save job: %v", err)
+	}
+	enqueue(job)
+	return job
+}
+
+func TestProcessJobSuccess(t *testing.T) {
+	isolateJobs(t)
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		return ChangeResult{Diff: strings.Repeat("x", 2048)}, nil
+	})
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	processJob(context.Background(), job.ID)
+
+	got, _ := store.Get(job.ID)
+	if got.Status != statusDone {
+		t.Fatalf("Expected status '%s', got '%s'", statusDone, got.Status)
+	}
+	if got.StartedAt == nil || got.FinishedAt == nil {
+		t.Error("Expected startedAt and finishedAt to be set")
+	}
+	if got.Result == nil || got.Result.OutputSizeKB != 2 {
+		t.Errorf("Expected result with OutputSizeKB 2, got %+v", got.Result)
+	}
+}
+
+func TestProcessJobAgentError(t *testing.T) {
+	isolateJobs(t)
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		return ChangeResult{}, errors.New("clone failed")
+	})
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	processJob(context.Background(), job.ID)
+
+	got, _ := store.Get(job.ID)
+	if got.Status != statusFailed {
+		t.Fatalf("Expected status '%s', got '%s'", statusFailed, got.Status)
+	}
+	if got.Error != "agent_failed" || got.Message != "clone failed" {
+		t.Errorf("Expected agent_failed error, got '%s': '%s'", got.Error, got.Message)
+	}
+}
+
+func TestProcessJobFailsResultGate(t *testing.T) {
+	isolateJobs(t)
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		return ChangeResult{Logs: strings.Repeat("x", 2048)}, nil
+	})
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli", MaxOutputSizeKB: 1})
+	processJob(context.Background(), job.ID)
+
+	got, _ := store.Get(job.ID)
+	if got.Status != statusFailed || got.Error != "output_size_exceeded" {
+		t.Errorf("Expected output_size_exceeded failure, got '%s' '%s'", got.Status, got.Error)
+	}
+	if got.Result == nil || got.Result.OutputSizeKB != 2 {
+		t.Errorf("Expected actual output size to be reported, got %+v", got.Result)
+	}
+}
+
+func TestProcessJobTokenBudget(t *testing.T) {
+	tests := []struct {
+		name       string
+		used       int
+		maxTokens  int
+		wantStatus string
+	}{
+		{name: "within budget", used: 800, maxTokens: 1000, wantStatus: statusDone},
+		{name: "over budget", used: 1200, maxTokens: 1000, wantStatus: statusFailed},
+		{name: "agent default budget", used: 1200, maxTokens: 0, wantStatus: statusDone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isolateJobs(t)
+			setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+				if req.MaxTokens != tt.maxTokens {
+					t.Errorf("Expected the agent to receive maxTokens %d, got %d", tt.maxTokens, req.MaxTokens)
+				}
+				return ChangeResult{Diff: "+line\n", TokensUsed: tt.used}, nil
+			})
+
+			job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli", MaxTokens: tt.maxTokens})
+			processJob(context.Background(), job.ID)
+
+			got, _ := store.Get(job.ID)
+			if got.Status != tt.wantStatus {
+				t.Fatalf("Expected status '%s', got '%s' (%s)", tt.wantStatus, got.Status, got.Error)
+			}
+			if tt.wantStatus == statusFailed && got.Error != "token_budget_exceeded" {
+				t.Errorf("Expected token_budget_exceeded, got '%s'", got.Error)
+			}
+			if got.Result == nil || got.Result.TokensUsed != tt.used {
+				t.Errorf("Expected reported token usage to be stored, got %+v", got.Result)
+			}
+		})
+	}
+}
+
+func TestWorkersDrainQueue(t *testing.T) {
+	isolateJobs(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	workers := startWorkers(ctx, 2)
+	defer workers.Wait()
+	defer cancel()
+
+	var submitted []Job
+	for i := 0; i < 5; i++ {
+		submitted = append(submitted, submitTestJob(t, ChangeSpec{Agent: "gemini-cli"}))
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for _, job := range submitted {
+		for {
+			got, _ := store.Get(job.ID)
+			if got.Status == statusDone {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for job %s, status '%s'", job.ID, got.Status)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	if queue.len() != 0 {
+		t.Errorf("Expected queue to be drained, got %d entries", queue.len())
+	}
+}
+
+func TestWorkerPoolCounts(t *testing.T) {
+	isolateJobs(t)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		started <- struct{}{}
+		<-release
+		return ChangeResult{}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	workers := startWorkers(ctx, 3)
+
+	// waitForCounts polls until the pool reports active and idle workers
+	waitForCounts := func(active, idle int) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for activeWorkers() != active || idleWorkers() != idle {
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected %d active and %d idle workers, got %d and %d", active, idle, activeWorkers(), idleWorkers())
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	waitForCounts(0, 3)
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	<-started
+	waitForCounts(1, 2)
+
+	close(release)
+	waitForCounts(0, 3)
+	if got, _ := store.Get(job.ID); got.Status != statusDone {
+		t.Errorf("Expected status '%s', got '%s'", statusDone, got.Status)
+	}
+
+	cancel()
+	workers.Wait()
+	waitForCounts(0, 0)
+}
+
+func TestChangeEndpointAsyncStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	release := make(chan struct{})
+	setAgentRunner(t, "claude-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		select {
+		case <-release:
+			return ChangeResult{Diff: "async diff"}, nil
+		case <-ctx.Done():
+			return ChangeResult{}, ctx.Err()
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	workers := startWorkers(ctx, 2)
+	defer workers.Wait()
+	defer cancel()
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+	router.GET("/changes/:id", handleGetChange)
+
+	w := postJSON(router, "/change", Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Run asynchronously",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "claude-cli",
+		},
+	})
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected status 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var accepted struct {
+		Status string `json:"status"`
+		ID     string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &accepted); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if accepted.Status != statusPending || accepted.ID == "" {
+		t.Fatalf("Expected a pending change with an id, got %s", w.Body.String())
+	}
+
+	// waitFor polls the status endpoint until the change reaches status
+	type statusResponse struct {
+		Status string        `json:"status"`
+		Result *ChangeResult `json:"result"`
+	}
+	waitFor := func(status string) statusResponse {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			req, _ := http.NewRequest("GET", "/changes/"+accepted.ID, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var job statusResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+				t.Fatalf("Failed to unmarshal status: %v", err)
+			}
+			if job.Status == status {
+				return job
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for status '%s', got '%s'", status, job.Status)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	waitFor(statusRunning)
+	close(release)
+	if job := waitFor(statusDone); job.Result == nil || job.Result.Diff != "async diff" {
+		t.Errorf("Expected the agent's result on the completed change, got %+v", job.Result)
+	}
+}
+
+func TestProcessJobSkipsCancelledJob(t *testing.T) {
+	isolateJobs(t)
+
+	ran := false
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		ran = true
+		return ChangeResult{}, nil
+	})
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	store.Update(job.ID, func(j *Job) { j.Status = statusCancelled })
+	processJob(context.Background(), job.ID)
+
+	if ran {
+		t.Error("Expected cancelled job not to be executed")
+	}
+}
+
+func TestCancelRunningJob(t *testing.T) {
+	isolateJobs(t)
+
+	started := make(chan struct{})
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		close(started)
+		<-ctx.Done()
+		return ChangeResult{}, ctx.Err()
+	})
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	done := make(chan struct{})
+	go func() {
+		processJob(context.Background(), job.ID)
+		close(done)
+	}()
+
+	<-started
+	store.Update(job.ID, func(j *Job) { j.Status = statusCancelled })
+	if !cancelRunningJob(job.ID) {
+		t.Fatal("Expected running job to be cancelled")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for worker to stop")
+	}
+
+	got, _ := store.Get(job.ID)
+	if got.Status != statusCancelled {
+		t.Errorf("Expected status '%s', got '%s'", statusCancelled, got.Status)
+	}
+	if got.FinishedAt == nil {
+		t.Error("Expected finishedAt to be set once the worker stopped")
+	}
+	if cancelRunningJob(job.ID) {
+		t.Error("Expected job to no longer be registered as running")
+	}
+}
+
+func TestProcessJobTimeout(t *testing.T) {
+	isolateJobs(t)
+	previousUnit := timeoutUnit
+	t.Cleanup(func() { timeoutUnit = previousUnit })
+	timeoutUnit = time.Millisecond
+
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		<-ctx.Done()
+		return ChangeResult{}, ctx.Err()
+	})
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli", TimeoutSeconds: 20})
+	done := make(chan struct{})
+	go func() {
+		processJob(context.Background(), job.ID)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Timed out waiting for the change to time out")
+	}
+
+	got, _ := store.Get(job.ID)
+	if got.Status != statusFailed || got.Error != "timeout" {
+		t.Errorf("Expected status '%s' with error 'timeout', got '%s' with '%s'", statusFailed, got.Status, got.Error)
+	}
+	if got.Message != "change did not finish within 20 seconds" {
+		t.Errorf("Unexpected message %q", got.Message)
+	}
+}
+
+func TestCancelQueuedJobs(t *testing.T) {
+	isolateJobs(t)
+
+	queued := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	waiting := newJob(Change{Spec: ChangeSpec{Agent: "copilot-cli", LockFiles: []string{"go.mod"}}})
+	waiting.Status = statusAwaitingLock
+	if err := store.Save(waiting); err != nil {
+		t.Fatalf("Failed to save job: %v", err)
+	}
+	fileLocks.Acquire([]string{"go.mod"}, "holder")
+	fileLocks.Acquire([]string{"go.mod"}, waiting.ID)
+
+	if n := cancelQueuedJobs("shutting down"); n != 2 {
+		t.Errorf("Expected 2 changes to be cancelled, got %d", n)
+	}
+	if queue.len() != 0 {
+		t.Errorf("Expected the queue to be drained, got %d entries", queue.len())
+	}
+
+	for _, id := range []string{queued.ID, waiting.ID} {
+		got, _ := store.Get(id)
+		if got.Status != statusCancelled || got.Reason != "shutting down" {
+			t.Errorf("Expected %s to be cancelled with the shutdown reason, got '%s' '%s'", id, got.Status, got.Reason)
+		}
+	}
+}
+
+func TestRecoverJobs(t *testing.T) {
+	isolateJobs(t)
+
+	pending := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	running := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	store.Update(running.ID, func(j *Job) { j.Status = statusRunning })
+
+	// Simulate a restart with an empty queue
+	queue = newJobQueue()
+	if err := recoverJobs(); err != nil {
+		t.Fatalf("Failed to recover jobs: %v", err)
+	}
+
+	if id, _ := queue.pop(context.Background()); id != pending.ID || queue.len() != 0 {
+		t.Errorf("Expected only the pending job to be requeued, got '%s' with %d remaining", id, queue.len())
+	}
+
+	got, _ := store.Get(running.ID)
+	if got.Status != statusFailed || got.Error != "interrupted" {
+		t.Errorf("Expected interrupted job to be failed, got '%s' '%s'", got.Status, got.Error)
+	}
+}
+
+func TestRunAttemptsPersistsWorkspaceAcrossRetries(t *testing.T) {
+	isolateJobs(t)
+	cfg := config
+	cfg.AgentMaxAttempts = 3
+	setConfig(t, cfg)
+
+	var dirs []string
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		dirs = append(dirs, req.Workspace)
+		marker := filepath.Join(req.Workspace, "clone")
+		if _, err := os.Stat(marker); err == nil {
+			return ChangeResult{}, nil
+		}
+		os.WriteFile(marker, []byte("cloned"), 0o644)
+		return ChangeResult{}, errors.New("transient failure")
+	})
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli", PersistWorkspace: true})
+	processJob(context.Background(), job.ID)
+
+	got, _ := store.Get(job.ID)
+	if got.Status != statusDone {
+		t.Fatalf("Expected retry to reuse the workspace and succeed, got '%s' '%s'", got.Status, got.Error)
+	}
+	if len(dirs) != 2 || dirs[0] != dirs[1] {
+		t.Errorf("Expected both attempts to share a workspace, got %v", dirs)
+	}
+	if got.WorkspaceID != job.ID {
+		t.Errorf("Expected workspace ID '%s', got '%s'", job.ID, got.WorkspaceID)
+	}
+	if _, err := os.Stat(dirs[0]); !os.IsNotExist(err) {
+		t.Error("Expected workspace to be freed after the final attempt")
+	}
+}
+
+func TestRunAttemptsFreshWorkspacePerAttempt(t *testing.T) {
+	isolateJobs(t)
+	cfg := config
+	cfg.AgentMaxAttempts = 3
+	setConfig(t, cfg)
+
+	var dirs []string
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		dirs = append(dirs, req.Workspace)
+		return ChangeResult{}, errors.New("permanent failure")
+	})
+
+	job := submitTestJob(t, ChangeSpec{Agent: "copilot-cli"})
+	processJob(context.Background(), job.ID)
+
+	got, _ := store.Get(job.ID)
+	if got.Status != statusFailed {
+		t.Fatalf("Expected job to fail after exhausting retries, got '%s'", got.Status)
+	}
+	if len(dirs) != 3 {
+		t.Fatalf("Expected 3 attempts, got %d", len(dirs))
+	}
+	if dirs[0] == dirs[1] || dirs[1] == dirs[2] {
+		t.Errorf("Expected a fresh workspace per attempt, got %v", dirs)
+	}
+	for _, dir := range dirs {
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("Expected workspace %s to be freed", dir)
+		}
+	}
+}
+
+func TestSubmitServesCachedResult(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	isolateJobs(t)
+
+	runs := 0
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		runs++
+		return ChangeResult{Diff: "cached diff"}, nil
+	})
+
+	router := gin.New()
+	router.POST("/change", handleChange)
+	change := Change{
+		Kind:       "Change",
+		APIVersion: "v1",
+		Spec: ChangeSpec{
+			Prompt: "Add retries",
+			Repos:  repoRefs("https://github.com/myorg/repo1"),
+			Agent:  "copilot-cli",
+		},
+	}
+
+	postJSON(router, "/change", change)
+	id, _ := queue.pop(context.Background())
+	processJob(context.Background(), id)
+
+	w := postJSON(router, "/change", change)
+	var response struct {
+		Status string       `json:"status"`
+		ID     string       `json:"id"`
+		Result ChangeResult `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response: %v", err)
+	}
+	if response.Status != statusDone || response.Result.Diff != "cached diff" {
+		t.Fatalf("Expected cached result to be returned as done, got %s", w.Body.String())
+	}
+	if queue.len() != 0 {
+		t.Error("Expected a cache hit not to be queued")
+	}
+	if runs != 1 {
+		t.Errorf("Expected the agent to run once, ran %d times", runs)
+	}
+
+	got, _ := store.Get(response.ID)
+	if got.Status != statusDone || got.Result == nil {
+		t.Errorf("Expected stored job to be done with a result, got '%s'", got.Status)
+	}
+}
+
+func TestProcessJobWaitsForLockFiles(t *testing.T) {
+	isolateJobs(t)
+
+	first := submitTestJob(t, ChangeSpec{Agent: "copilot-cli", LockFiles: []string{"go.mod", "docs/api.md"}})
+	second := submitTestJob(t, ChangeSpec{Agent: "copilot-cli", LockFiles: []string{"./go.mod"}})
+	queue = newJobQueue()
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	setAgentRunner(t, "copilot-cli", func(ctx context.Context, req ChangeRequest) (ChangeResult, error) {
+		if req.JobID == first.ID {
+			close(started)
+			<-release
+		}
+		return ChangeResult{}, nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		processJob(context.Background(), first.ID)
+		close(done)
+	}()
+	<-started
+
+	processJob(context.Background(), second.ID)
+	got, _ := store.Get(second.ID)
+	if got.Status != statusAwaitingLock {
+		t.Fatalf("Expected status '%s' while the lock is held, got '%s'", statusAwaitingLock, got.Status)
+	}
+
+	close(release)
+	<-done
+	id, _ := queue.pop(context.Background())
+	if id != second.ID {
+		t.Fatalf("Expected waiting job to be requeued once the lock was released, got '%s'", id)
+	}
+
+	processJob(context.Background(), second.ID)
+	got, _ = store.Get(second.ID)
+	if got.Status != statusDone {
+		t.Errorf("Expected waiting job to run once the lock was free, got '%s'", got.Status)
+	}
+}
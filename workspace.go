@@ -0,0 +1,133 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WorkspaceStore hands out working directories for agents
+type WorkspaceStore interface {
+	// Allocate returns the directory for the workspace with the given ID,
+	// creating it if it doesn't exist yet
+	Allocate(id string) (string, error)
+	// Free deletes the workspace with the given ID
+	Free(id string) error
+}
+
+var workspaces WorkspaceStore
+
+// dirWorkspaceStore is a WorkspaceStore that keeps each workspace in its own
+// directory under root. When the workspaces use more than maxBytes of disk,
+// the least recently allocated ones are evicted.
+type dirWorkspaceStore struct {
+	root     string
+	maxBytes int64
+
+	mu       sync.Mutex
+	lastUsed map[string]time.Time
+	now      func() time.Time
+}
+
+// newDirWorkspaceStore creates a dirWorkspaceStore under root. A maxBytes of
+// 0 disables eviction.
+func newDirWorkspaceStore(root string, maxBytes int64) *dirWorkspaceStore {
+	return &dirWorkspaceStore{
+		root:     root,
+		maxBytes: maxBytes,
+		lastUsed: make(map[string]time.Time),
+		now:      time.Now,
+	}
+}
+
+// Allocate implements WorkspaceStore
+func (s *dirWorkspaceStore) Allocate(id string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir := filepath.Join(s.root, id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	s.lastUsed[id] = s.now()
+
+	if err := s.evict(id); err != nil {
+		logger.Warn("Failed to evict workspaces", "error", err)
+	}
+
+	return dir, nil
+}
+
+// Free implements WorkspaceStore
+func (s *dirWorkspaceStore) Free(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.lastUsed, id)
+	return os.RemoveAll(filepath.Join(s.root, id))
+}
+
+// evict removes least recently used workspaces other than keep until disk
+// usage is within maxBytes. The caller must hold s.mu.
+func (s *dirWorkspaceStore) evict(keep string) error {
+	if s.maxBytes <= 0 {
+		return nil
+	}
+
+	usage := make(map[string]int64, len(s.lastUsed))
+	var total int64
+	for id := range s.lastUsed {
+		size, err := dirSize(filepath.Join(s.root, id))
+		if err != nil {
+			return err
+		}
+		usage[id] = size
+		total += size
+	}
+
+	candidates := make([]string, 0, len(s.lastUsed))
+	for id := range s.lastUsed {
+		if id != keep {
+			candidates = append(candidates, id)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return s.lastUsed[candidates[i]].Before(s.lastUsed[candidates[j]])
+	})
+
+	for _, id := range candidates {
+		if total <= s.maxBytes {
+			break
+		}
+		if err := os.RemoveAll(filepath.Join(s.root, id)); err != nil {
+			return err
+		}
+		delete(s.lastUsed, id)
+		total -= usage[id]
+		logger.Info("Evicted workspace", "workspace", id, "bytes", usage[id])
+	}
+
+	return nil
+}
+
+// dirSize returns the total size of the regular files under dir
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDirWorkspaceStoreAllocateReusesDirectory(t *testing.T) {
+	s := newDirWorkspaceStore(t.TempDir(), 0)
+
+	dir, err := s.Allocate("job-1")
+	if err != nil {
+		t.Fatalf("Failed to allocate workspace: %v", err)
+	}
+	os.WriteFile(filepath.Join(dir, "file"), []byte("data"), 0o644)
+
+	again, err := s.Allocate("job-1")
+	if err != nil {
+		t.Fatalf("Failed to reallocate workspace: %v", err)
+	}
+	if again != dir {
+		t.Errorf("Expected the same directory, got '%s' and '%s'", dir, again)
+	}
+	if _, err := os.Stat(filepath.Join(again, "file")); err != nil {
+		t.Errorf("Expected workspace contents to be retained: %v", err)
+	}
+
+	if err := s.Free("job-1"); err != nil {
+		t.Fatalf("Failed to free workspace: %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("Expected workspace to be removed")
+	}
+}
+
+func TestDirWorkspaceStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	now := time.Now()
+	s := newDirWorkspaceStore(t.TempDir(), 2048)
+	s.now = func() time.Time { return now }
+
+	fill := func(id string) string {
+		t.Helper()
+		now = now.Add(time.Second)
+		dir, err := s.Allocate(id)
+		if err != nil {
+			t.Fatalf("Failed to allocate workspace: %v", err)
+		}
+		os.WriteFile(filepath.Join(dir, "data"), make([]byte, 1024), 0o644)
+		return dir
+	}
+
+	oldest := fill("a")
+	middle := fill("b")
+
+	// Touch "a" so "b" becomes the least recently used
+	now = now.Add(time.Second)
+	s.Allocate("a")
+
+	newest := fill("c")
+	// Eviction runs on allocation, so allocate once more now that "c" has data
+	now = now.Add(time.Second)
+	s.Allocate("c")
+
+	if _, err := os.Stat(middle); !os.IsNotExist(err) {
+		t.Error("Expected least recently used workspace to be evicted")
+	}
+	for _, dir := range []string{oldest, newest} {
+		if _, err := os.Stat(dir); err != nil {
+			t.Errorf("Expected workspace %s to be retained: %v", dir, err)
+		}
+	}
+}
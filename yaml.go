@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/gin-gonic/gin/binding"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlContentTypes are the content types accepted for YAML request bodies
+var yamlContentTypes = map[string]bool{
+	"application/yaml":   true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+}
+
+// bindYAML decodes a YAML document from r into obj and validates it. The
+// document is converted to JSON first so that obj's json tags and binding
+// rules apply exactly as they do for JSON bodies.
+func bindYAML(r io.Reader, obj interface{}) error {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var doc interface{}
+	if err := yaml.Unmarshal(body, &doc); err != nil {
+		return err
+	}
+
+	jsonData, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	return binding.JSON.BindBody(jsonData, obj)
+}